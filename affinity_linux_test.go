@@ -0,0 +1,48 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestWorkersArePinnedToDistinctCPUs(t *testing.T) {
+	cpus := allowedCPUs()
+	assert.NotEmpty(t, cpus)
+
+	p := newTestPool(t, 0, WithCPUAffinity(true), WithMinWorkers(uint32(len(cpus))))
+
+	pinned := make(map[uint32]int)
+	var mu sync.Mutex
+	for i := 0; i < 64; i++ {
+		p.SubmitTaskCtx(context.Background(), func(ctx context.Context) {
+			var set unix.CPUSet
+			assert.NoError(t, unix.SchedGetaffinity(0, &set))
+			assert.Equal(t, 1, set.Count())
+
+			id, _ := WorkerIDFromContext(ctx)
+			for _, cpu := range cpus {
+				if set.IsSet(cpu) {
+					mu.Lock()
+					pinned[id] = cpu
+					mu.Unlock()
+				}
+			}
+		})
+	}
+	p.Wait()
+
+	for id, cpu := range pinned {
+		assert.Equal(t, cpus[int(id)%len(cpus)], cpu)
+	}
+
+	// Threads of the test itself are not affected.
+	var set unix.CPUSet
+	assert.NoError(t, unix.SchedGetaffinity(0, &set))
+	assert.Equal(t, len(cpus), set.Count())
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+// Pinning is not supported, so workers are never pinned.
+func allowedCPUs() []int {
+	return nil
+}
+
+func pinThread(cpu int) error {
+	return nil
+}
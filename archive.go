@@ -0,0 +1,381 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type archiveOptions struct {
+	op         string // hash, extract or search
+	pattern    string // searched for by the search operation
+	outDir     string // members are extracted into it
+	maxThreads uint32 // maximum number of workers processing members
+
+	poolOptions []Option
+}
+
+// A member of a zip or tar archive.
+type archiveMember struct {
+	name string
+	mode fs.FileMode
+	open func() (io.ReadCloser, error)
+}
+
+// Processes a regular file member, returns the output for it.
+type archiveOp func(m archiveMember, r io.Reader) ([]byte, error)
+
+type archiveReader struct {
+	// Calls fn for every member in the order of the archive.
+	each  func(fn func(m archiveMember)) error
+	close func() error
+}
+
+// Opens a zip, tar, or gzipped tar (.tar.gz, .tgz) archive, the format is chosen by the extension.
+// Members of zip archives are read by the workers concurrently, members of tar archives can only be read
+// one after another, so they are read up front, into memory or a temporary file if they are big.
+func openArchive(path string) (*archiveReader, error) {
+	name := strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		r, err := zip.OpenReader(path)
+		if err != nil {
+			return nil, err
+		}
+		return &archiveReader{
+			each: func(fn func(m archiveMember)) error {
+				for _, f := range r.File {
+					fn(archiveMember{name: f.Name, mode: f.Mode(), open: f.Open})
+				}
+				return nil
+			},
+			close: r.Close,
+		}, nil
+
+	case strings.HasSuffix(name, ".tar"), strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		var in io.Reader = f
+		if !strings.HasSuffix(name, ".tar") {
+			gz, err := gzip.NewReader(f)
+			if err != nil {
+				f.Close()
+				return nil, err
+			}
+			in = gz
+		}
+		spool := &memberSpool{threshold: maxBufferedMember}
+		return &archiveReader{
+			each: func(fn func(m archiveMember)) error { return eachTarMember(tar.NewReader(in), spool, fn) },
+			close: func() error {
+				spool.close()
+				return f.Close()
+			},
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: unknown archive format of %q, expected .zip, .tar, .tar.gz or .tgz", errBadArguments, path)
+}
+
+// Tar members up to this size are held in memory until a worker processes them, bigger ones are spooled
+// to temporary files, the number of members held at once is limited, but not their size.
+const maxBufferedMember = 8 << 20
+
+// Temporary files of big tar members, the space is created for the first of them.
+type memberSpool struct {
+	threshold int64
+	space     *TempSpace
+	count     int
+}
+
+// Reads the member, returns the function opening it. A spooled member's file is removed once it is closed.
+func (s *memberSpool) store(hdr *tar.Header, r io.Reader) (func() (io.ReadCloser, error), error) {
+	if hdr.Size <= s.threshold {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(data)), nil
+		}, nil
+	}
+
+	if s.space == nil {
+		space, err := NewTempSpace("", 0)
+		if err != nil {
+			return nil, err
+		}
+		s.space = space
+	}
+
+	name := fmt.Sprintf("member-%05d", s.count)
+	s.count++
+	f, err := s.space.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	space := s.space
+	return func() (io.ReadCloser, error) {
+		f, err := os.Open(filepath.Join(space.Dir(), name))
+		if err != nil {
+			return nil, err
+		}
+		return &spooledMember{File: f, remove: func() { space.Remove(name) }}, nil
+	}, nil
+}
+
+// Removes the files of members which haven't been processed.
+func (s *memberSpool) close() {
+	if s.space != nil {
+		s.space.Close()
+	}
+}
+
+type spooledMember struct {
+	*os.File
+	remove func()
+}
+
+func (m *spooledMember) Close() error {
+	err := m.File.Close()
+	m.remove()
+	return err
+}
+
+func eachTarMember(tr *tar.Reader, spool *memberSpool, fn func(m archiveMember)) error {
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		m := archiveMember{name: hdr.Name, mode: hdr.FileInfo().Mode()}
+		if m.mode.IsRegular() {
+			if m.open, err = spool.store(hdr, tr); err != nil {
+				return fmt.Errorf("%s: %w", hdr.Name, err)
+			}
+		}
+		fn(m)
+	}
+}
+
+func hashMember(m archiveMember, r io.Reader) ([]byte, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	return fmt.Appendf(nil, "%x  %s\n", h.Sum(nil), m.name), nil
+}
+
+// Reports the lines of members containing the pattern as name:line:text.
+func searchMembers(pattern string) archiveOp {
+	return func(m archiveMember, r io.Reader) ([]byte, error) {
+		var out []byte
+		s := bufio.NewScanner(r)
+		s.Buffer(nil, 1<<20)
+		for line := 1; s.Scan(); line++ {
+			if bytes.Contains(s.Bytes(), []byte(pattern)) {
+				out = fmt.Appendf(out, "%s:%d:%s\n", m.name, line, s.Bytes())
+			}
+		}
+		return out, s.Err()
+	}
+}
+
+// Writes members under dir, refusing names which would escape it.
+func extractMembers(dir string) archiveOp {
+	return func(m archiveMember, r io.Reader) ([]byte, error) {
+		target, err := memberPath(dir, m.name)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return nil, err
+		}
+
+		perm := m.mode.Perm()
+		if perm == 0 {
+			perm = 0o644
+		}
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(f, r); err != nil {
+			f.Close()
+			return nil, err
+		}
+		return nil, f.Close()
+	}
+}
+
+func memberPath(dir, name string) (string, error) {
+	local := filepath.FromSlash(strings.TrimSuffix(name, "/"))
+	if !filepath.IsLocal(local) {
+		return "", fmt.Errorf("%s: member path escapes the output directory", name)
+	}
+	return filepath.Join(dir, local), nil
+}
+
+type memberResult struct {
+	out     []byte
+	warning string
+	err     error
+}
+
+func processMember(m archiveMember, op archiveOp) memberResult {
+	r, err := m.open()
+	if err != nil {
+		return memberResult{err: fmt.Errorf("%s: %w", m.name, err)}
+	}
+	defer r.Close()
+
+	out, err := op(m, r)
+	if err != nil {
+		return memberResult{err: fmt.Errorf("%s: %w", m.name, err)}
+	}
+	return memberResult{out: out}
+}
+
+// Applies the operation to every regular file member of the archive on the pool and writes the outputs
+// to out in the order of the archive. Directories are only created by extract, other members are skipped
+// with a warning. Members failing to process don't stop the rest, their errors are returned together.
+func processArchive(path string, opts archiveOptions, out, warn io.Writer) error {
+	var op archiveOp
+	switch opts.op {
+	case "hash":
+		op = hashMember
+	case "search":
+		if opts.pattern == "" {
+			return fmt.Errorf("%w: -pattern is required by search", errBadArguments)
+		}
+		op = searchMembers(opts.pattern)
+	case "extract":
+		if opts.outDir == "" {
+			return fmt.Errorf("%w: -out is required by extract", errBadArguments)
+		}
+		op = extractMembers(opts.outDir)
+	default:
+		return fmt.Errorf("%w: unknown operation %q, expected hash, extract or search", errBadArguments, opts.op)
+	}
+
+	a, err := openArchive(path)
+	if err != nil {
+		return err
+	}
+	defer a.close()
+
+	p := NewPoolWithOptions(opts.maxThreads, opts.poolOptions...)
+
+	// Members in archive order, each delivering its output once processed. The capacity limits
+	// the members held in memory.
+	pending := make(chan chan memberResult, 2*p.maxThreads)
+	var listErr error
+	go func() {
+		defer close(pending)
+		listErr = a.each(func(m archiveMember) {
+			done := make(chan memberResult, 1)
+			pending <- done
+
+			switch {
+			case m.mode.IsDir():
+				if opts.op == "extract" {
+					err := p.SubmitTask(func() {
+						target, err := memberPath(opts.outDir, m.name)
+						if err == nil {
+							err = os.MkdirAll(target, 0o755)
+						}
+						done <- memberResult{err: err}
+					})
+					if err != nil {
+						done <- memberResult{err: fmt.Errorf("%s: %w", m.name, err)}
+					}
+					return
+				}
+				done <- memberResult{}
+			case !m.mode.IsRegular():
+				done <- memberResult{warning: fmt.Sprintf("skipping %s, not a regular file", m.name)}
+			default:
+				// A rejected member still delivers a result, so the output loop doesn't wait for it forever.
+				if err := p.SubmitTask(func() {
+					done <- processMember(m, op)
+				}); err != nil {
+					done <- memberResult{err: fmt.Errorf("%s: %w", m.name, err)}
+				}
+			}
+		})
+	}()
+
+	var errs []error
+	for done := range pending {
+		res := <-done
+		if res.err != nil {
+			errs = append(errs, res.err)
+			continue
+		}
+		if res.warning != "" {
+			fmt.Fprintf(warn, "warning: %s\n", res.warning)
+		}
+		out.Write(res.out)
+	}
+	p.Wait()
+
+	return errors.Join(append(errs, listErr)...)
+}
+
+// Processes members of an archive in parallel: prints their SHA-256 hashes, extracts them, or searches them for a pattern.
+func runArchive(args []string) error {
+	fs := flag.NewFlagSet("archive", flag.ContinueOnError)
+
+	input := fs.String("in", "", "Archive: .zip, .tar, .tar.gz or .tgz")
+	op := fs.String("op", "hash", "Operation applied to every member: hash, extract or search")
+	pattern := fs.String("pattern", "", "Text searched for by -op search")
+	outDir := fs.String("out", "", "Directory the members are written to by -op extract")
+	threads := fs.Uint("threads", 0, "Maximum number of workers, defaults to the number of CPUs")
+	output := addOutputFlags(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%w: %s", errBadArguments, err.Error())
+	}
+
+	if *input == "" {
+		return fmt.Errorf("%w: input archive is required", errBadArguments)
+	}
+
+	poolOptions, err := output.poolOptions()
+	if err != nil {
+		return err
+	}
+
+	return processArchive(*input, archiveOptions{
+		op:         *op,
+		pattern:    *pattern,
+		outDir:     *outDir,
+		maxThreads: uint32(*threads),
+
+		poolOptions: poolOptions,
+	}, output.stdout(), output.warnings())
+}
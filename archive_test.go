@@ -0,0 +1,165 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+var archiveTestMembers = []struct {
+	name string
+	data string
+}{
+	{"docs/", ""},
+	{"docs/notes.txt", "first line\nTODO: second line\nthird line\n"},
+	{"main.go", "package main\n\n// TODO: remove\nfunc main() {}\n"},
+	{"empty", ""},
+}
+
+func writeTestZip(t *testing.T, path string, extra ...string) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, m := range archiveTestMembers {
+		w, err := zw.Create(m.name)
+		assert.NoError(t, err)
+		w.Write([]byte(m.data))
+	}
+	for _, name := range extra {
+		w, err := zw.Create(name)
+		assert.NoError(t, err)
+		w.Write([]byte(name))
+	}
+	assert.NoError(t, zw.Close())
+	assert.NoError(t, os.WriteFile(path, buf.Bytes(), 0o644))
+}
+
+func writeTestTarGz(t *testing.T, path string) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, m := range archiveTestMembers {
+		hdr := &tar.Header{Name: m.name, Mode: 0o600, Size: int64(len(m.data)), Typeflag: tar.TypeReg}
+		if strings.HasSuffix(m.name, "/") {
+			hdr.Typeflag, hdr.Mode = tar.TypeDir, 0o755
+		}
+		assert.NoError(t, tw.WriteHeader(hdr))
+		tw.Write([]byte(m.data))
+	}
+	assert.NoError(t, tw.WriteHeader(&tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "main.go"}))
+	assert.NoError(t, tw.Close())
+	assert.NoError(t, gz.Close())
+	assert.NoError(t, os.WriteFile(path, buf.Bytes(), 0o644))
+}
+
+func TestProcessArchive(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	dir := t.TempDir()
+	zipPath, tarPath := filepath.Join(dir, "src.zip"), filepath.Join(dir, "src.tar.gz")
+	writeTestZip(t, zipPath)
+	writeTestTarGz(t, tarPath)
+
+	var wantHashes string
+	for _, m := range archiveTestMembers[1:] {
+		wantHashes += fmt.Sprintf("%x  %s\n", sha256.Sum256([]byte(m.data)), m.name)
+	}
+
+	for _, path := range []string{zipPath, tarPath} {
+		var out, warn bytes.Buffer
+		assert.NoError(t, processArchive(path, archiveOptions{op: "hash", maxThreads: 2}, &out, &warn))
+		assert.Equal(t, wantHashes, out.String())
+
+		out.Reset()
+		assert.NoError(t, processArchive(path, archiveOptions{op: "search", pattern: "TODO", maxThreads: 2}, &out, &warn))
+		assert.Equal(t, "docs/notes.txt:2:TODO: second line\nmain.go:3:// TODO: remove\n", out.String())
+
+		out.Reset()
+		extracted := filepath.Join(dir, "out-"+filepath.Base(path))
+		assert.NoError(t, processArchive(path, archiveOptions{op: "extract", outDir: extracted, maxThreads: 2}, &out, &warn))
+		assert.Empty(t, out.String())
+		for _, m := range archiveTestMembers[1:] {
+			data, err := os.ReadFile(filepath.Join(extracted, filepath.FromSlash(m.name)))
+			assert.NoError(t, err)
+			assert.Equal(t, m.data, string(data))
+		}
+	}
+
+	// The symlink of the tar archive is skipped with a warning each time.
+	var out, warn bytes.Buffer
+	assert.NoError(t, processArchive(tarPath, archiveOptions{op: "hash"}, &out, &warn))
+	assert.Equal(t, "warning: skipping link, not a regular file\n", warn.String())
+}
+
+func TestProcessArchiveErrors(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "evil.zip")
+	writeTestZip(t, path, "../escaped", "/etc/absolute")
+
+	// Members escaping the output directory fail, the rest are extracted.
+	extracted := filepath.Join(dir, "out")
+	err := processArchive(path, archiveOptions{op: "extract", outDir: extracted}, &bytes.Buffer{}, &bytes.Buffer{})
+	assert.ErrorContains(t, err, "../escaped: member path escapes the output directory")
+	assert.ErrorContains(t, err, "/etc/absolute: member path escapes the output directory")
+	assert.FileExists(t, filepath.Join(extracted, "main.go"))
+	assert.NoFileExists(t, filepath.Join(dir, "escaped"))
+
+	for _, opts := range []archiveOptions{{op: "compress"}, {op: "search"}, {op: "extract"}} {
+		assert.ErrorIs(t, processArchive(path, opts, &bytes.Buffer{}, &bytes.Buffer{}), errBadArguments)
+	}
+	assert.ErrorIs(t, processArchive(filepath.Join(dir, "src.rar"), archiveOptions{op: "hash"}, &bytes.Buffer{}, &bytes.Buffer{}), errBadArguments)
+
+	// A corrupt archive.
+	corrupt := filepath.Join(dir, "corrupt.tgz")
+	assert.NoError(t, os.WriteFile(corrupt, []byte("not gzip"), 0o644))
+	assert.Error(t, processArchive(corrupt, archiveOptions{op: "hash"}, &bytes.Buffer{}, &bytes.Buffer{}))
+}
+
+func TestTarMembersAboveThresholdAreSpooled(t *testing.T) {
+	big := strings.Repeat("0123456789", 100)
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, m := range []struct{ name, data string }{{"small", "tiny"}, {"big", big}, {"unread", big}} {
+		assert.NoError(t, tw.WriteHeader(&tar.Header{Name: m.name, Mode: 0o600, Size: int64(len(m.data)), Typeflag: tar.TypeReg}))
+		tw.Write([]byte(m.data))
+	}
+	assert.NoError(t, tw.Close())
+
+	spool := &memberSpool{threshold: 16}
+	members := make(map[string]archiveMember)
+	assert.NoError(t, eachTarMember(tar.NewReader(&buf), spool, func(m archiveMember) { members[m.name] = m }))
+
+	// Only the members above the threshold are written to the spool.
+	assert.NotNil(t, spool.space)
+	assert.EqualValues(t, 2*len(big), spool.space.Used())
+
+	read := func(name string) string {
+		r, err := members[name].open()
+		assert.NoError(t, err)
+		defer r.Close()
+		data, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		return string(data)
+	}
+	assert.Equal(t, "tiny", read("small"))
+	assert.Equal(t, big, read("big"))
+
+	// A processed member's file is removed once it is closed, the rest with the spool.
+	assert.EqualValues(t, len(big), spool.space.Used())
+	spool.close()
+	_, err := os.Stat(spool.space.Dir())
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Weight of the most recent task duration in the moving average, as a power of two: 1/8.
+const batchEWMAShift = 3
+
+// Groups tiny tasks into batches, so they are handed over to the workers and picked up by them at once.
+type batcher struct {
+	threshold time.Duration
+	size      int
+
+	// Exponentially weighted moving average of task durations in nanoseconds, 0 until the first task completes.
+	ewma int64
+}
+
+// WithBatching makes the dispatcher hand workers batches of up to size tasks while the moving average
+// of task durations is below threshold, which amortizes the queueing overhead for tiny tasks.
+// Tasks of a batch run one after another on the same worker, in the order of submission.
+func WithBatching(threshold time.Duration, size int) Option {
+	return func(p *ThreadPool) {
+		p.batcher = nil
+		if size > 1 {
+			p.batcher = &batcher{threshold: threshold, size: size}
+		}
+	}
+}
+
+func (b *batcher) observe(d time.Duration) {
+	// Updates racing with each other may get lost, which doesn't matter for an average.
+	avg := atomic.LoadInt64(&b.ewma)
+	if avg == 0 {
+		avg = int64(d)
+	} else {
+		avg += (int64(d) - avg) >> batchEWMAShift
+	}
+	atomic.StoreInt64(&b.ewma, max(avg, 1))
+}
+
+// Appends more tasks from q to the task if tasks are tiny, returns a task holding the whole batch.
+func (b *batcher) collect(task queuedTask, q taskQueue) queuedTask {
+	avg := atomic.LoadInt64(&b.ewma)
+	if avg == 0 || avg >= int64(b.threshold) {
+		return task
+	}
+
+	batch := []queuedTask{task}
+	var next queuedTask
+	for len(batch) < b.size && q.TryPop(&next) {
+		batch = append(batch, next)
+	}
+
+	if len(batch) == 1 {
+		return task
+	}
+	return queuedTask{batch: batch}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatcherCollect(t *testing.T) {
+	b := &batcher{threshold: time.Millisecond, size: 4}
+	q := NewQueue[queuedTask]()
+	for i := uint64(1); i <= 5; i++ {
+		q.Push(queuedTask{id: i})
+	}
+
+	var first queuedTask
+	q.TryPop(&first)
+
+	// Nothing is batched until the duration of tasks is known.
+	assert.Nil(t, b.collect(first, q).batch)
+
+	b.observe(10 * time.Microsecond)
+	batch := b.collect(first, q).batch
+	assert.Len(t, batch, 4)
+	for i, task := range batch {
+		assert.EqualValues(t, i+1, task.id)
+	}
+	assert.Equal(t, 1, q.Size())
+
+	// Slow tasks move the average above the threshold.
+	for i := 0; i < 64; i++ {
+		b.observe(10 * time.Millisecond)
+	}
+	assert.Nil(t, b.collect(first, q).batch)
+	assert.Equal(t, 1, q.Size())
+}
+
+func TestBatchedTasksRunInOrder(t *testing.T) {
+	p := newTestPool(t, 1, WithBatching(time.Second, 16))
+
+	const TASKS_COUNT = 1000
+	var order []int
+	var mu sync.Mutex
+	for i := 0; i < TASKS_COUNT; i++ {
+		index := i
+		p.SubmitTask(func() {
+			mu.Lock()
+			order = append(order, index)
+			mu.Unlock()
+		})
+	}
+	p.Wait()
+
+	assert.Len(t, order, TASKS_COUNT)
+	for i, index := range order {
+		if !assert.Equal(t, i, index) {
+			break
+		}
+	}
+	assertAllTasksDone(t, p, TASKS_COUNT)
+}
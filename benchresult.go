@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+	"time"
+)
+
+// Results of a loadtest run in a machine-readable form, see the -json flag of loadtest and bench-compare.
+type BenchResult struct {
+	Config struct {
+		Workload string `json:"workload"`
+		Tasks    int    `json:"tasks"`
+		Threads  uint32 `json:"threads"`
+		Seed     int64  `json:"seed"`
+	} `json:"config"`
+
+	Host struct {
+		OS        string `json:"os"`
+		Arch      string `json:"arch"`
+		CPUs      int    `json:"cpus"`
+		GoVersion string `json:"go_version"`
+		Hostname  string `json:"hostname"`
+	} `json:"host"`
+
+	Elapsed    time.Duration `json:"elapsed_ns"`
+	Throughput float64       `json:"throughput_tasks_per_sec"`
+
+	// Time tasks spent in the pool's queues before they started.
+	QueueWait LatencyStats `json:"queue_wait"`
+
+	GC struct {
+		Cycles    uint32        `json:"cycles"`
+		Pause     time.Duration `json:"pause_ns"`
+		Allocated uint64        `json:"allocated_bytes"`
+	} `json:"gc"`
+}
+
+type LatencyStats struct {
+	P50 time.Duration `json:"p50_ns"`
+	P90 time.Duration `json:"p90_ns"`
+	P99 time.Duration `json:"p99_ns"`
+	Max time.Duration `json:"max_ns"`
+}
+
+// Computes percentiles of the samples with the nearest-rank method, the samples are sorted in place.
+func computeLatencyStats(samples []time.Duration) LatencyStats {
+	if len(samples) == 0 {
+		return LatencyStats{}
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+
+	rank := func(p float64) time.Duration {
+		i := int(p*float64(len(samples))+0.999999) - 1
+		return samples[min(max(i, 0), len(samples)-1)]
+	}
+	return LatencyStats{P50: rank(0.5), P90: rank(0.9), P99: rank(0.99), Max: samples[len(samples)-1]}
+}
+
+func hostInfo(r *BenchResult) {
+	r.Host.OS = runtime.GOOS
+	r.Host.Arch = runtime.GOARCH
+	r.Host.CPUs = runtime.NumCPU()
+	r.Host.GoVersion = runtime.Version()
+	r.Host.Hostname, _ = os.Hostname()
+}
+
+// Returns descriptions of the metrics of cur which are worse than in base by more than threshold, a fraction.
+func benchRegressions(base, cur *BenchResult, threshold float64) []string {
+	var regressions []string
+
+	if base.Throughput > 0 && cur.Throughput < base.Throughput*(1-threshold) {
+		regressions = append(regressions, fmt.Sprintf("throughput: %.2f -> %.2f tasks/s (%+.1f%%)",
+			base.Throughput, cur.Throughput, 100*(cur.Throughput/base.Throughput-1)))
+	}
+
+	latencies := []struct {
+		name      string
+		base, cur time.Duration
+	}{
+		{"queue wait p50", base.QueueWait.P50, cur.QueueWait.P50},
+		{"queue wait p99", base.QueueWait.P99, cur.QueueWait.P99},
+	}
+	for _, l := range latencies {
+		if l.base > 0 && float64(l.cur) > float64(l.base)*(1+threshold) {
+			regressions = append(regressions, fmt.Sprintf("%s: %v -> %v (%+.1f%%)",
+				l.name, l.base, l.cur, 100*(float64(l.cur)/float64(l.base)-1)))
+		}
+	}
+	return regressions
+}
+
+func readBenchResult(path string) (*BenchResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var r BenchResult
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &r, nil
+}
+
+// Returned by runBenchCompare if the new results regressed.
+var errRegression = errors.New("performance regressed")
+
+// Compares results of two loadtest runs written with -json, and fails if the second one regressed.
+func runBenchCompare(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("bench-compare", flag.ContinueOnError)
+
+	threshold := fs.Float64("threshold", 0.05, "Tolerated relative change of a metric, 0.05 is 5%")
+
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%w: %s", errBadArguments, err.Error())
+	}
+	if fs.NArg() != 2 {
+		return fmt.Errorf("%w: expected the old and the new results", errBadArguments)
+	}
+	if *threshold < 0 {
+		return fmt.Errorf("%w: negative threshold", errBadArguments)
+	}
+
+	base, err := readBenchResult(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	cur, err := readBenchResult(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	if base.Config != cur.Config {
+		fmt.Fprintf(out, "warning: the runs used different configurations: %+v vs %+v\n", base.Config, cur.Config)
+	}
+	if base.Host != cur.Host {
+		fmt.Fprintf(out, "warning: the runs were made on different hosts\n")
+	}
+
+	fmt.Fprintf(out, "throughput:     %.2f -> %.2f tasks/s\n", base.Throughput, cur.Throughput)
+	fmt.Fprintf(out, "queue wait p50: %v -> %v\n", base.QueueWait.P50, cur.QueueWait.P50)
+	fmt.Fprintf(out, "queue wait p99: %v -> %v\n", base.QueueWait.P99, cur.QueueWait.P99)
+	fmt.Fprintf(out, "gc cycles:      %d -> %d\n", base.GC.Cycles, cur.GC.Cycles)
+
+	regressions := benchRegressions(base, cur, *threshold)
+	for _, r := range regressions {
+		fmt.Fprintf(out, "REGRESSION %s\n", r)
+	}
+	if len(regressions) != 0 {
+		return fmt.Errorf("%w: %d metrics beyond %.1f%%", errRegression, len(regressions), 100**threshold)
+	}
+	return nil
+}
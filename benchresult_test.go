@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComputeLatencyStats(t *testing.T) {
+	samples := make([]time.Duration, 100)
+	for i := range samples {
+		samples[i] = time.Duration(100-i) * time.Millisecond
+	}
+	s := computeLatencyStats(samples)
+	assert.Equal(t, 50*time.Millisecond, s.P50)
+	assert.Equal(t, 90*time.Millisecond, s.P90)
+	assert.Equal(t, 99*time.Millisecond, s.P99)
+	assert.Equal(t, 100*time.Millisecond, s.Max)
+
+	s = computeLatencyStats([]time.Duration{time.Second})
+	assert.Equal(t, LatencyStats{P50: time.Second, P90: time.Second, P99: time.Second, Max: time.Second}, s)
+
+	assert.Equal(t, LatencyStats{}, computeLatencyStats(nil))
+}
+
+func TestBenchRegressions(t *testing.T) {
+	base := &BenchResult{Throughput: 1000, QueueWait: LatencyStats{P50: time.Millisecond, P99: 10 * time.Millisecond}}
+
+	cur := *base
+	cur.Throughput = 960
+	cur.QueueWait.P99 = 10400 * time.Microsecond
+	assert.Empty(t, benchRegressions(base, &cur, 0.05))
+
+	cur.Throughput = 900
+	cur.QueueWait.P99 = 12 * time.Millisecond
+	assert.Len(t, benchRegressions(base, &cur, 0.05), 2)
+	assert.Empty(t, benchRegressions(base, &cur, 0.25))
+
+	// Improvements are never regressions.
+	cur = *base
+	cur.Throughput = 2000
+	cur.QueueWait.P50 = 0
+	assert.Empty(t, benchRegressions(base, &cur, 0))
+}
+
+func writeBenchResult(t *testing.T, r *BenchResult) string {
+	data, err := json.Marshal(r)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "bench.json")
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+	return path
+}
+
+func TestRunBenchCompare(t *testing.T) {
+	base := &BenchResult{Throughput: 1000}
+	cur := &BenchResult{Throughput: 800}
+	basePath, curPath := writeBenchResult(t, base), writeBenchResult(t, cur)
+
+	assert.NoError(t, runBenchCompare([]string{basePath, basePath}, io.Discard))
+	assert.ErrorIs(t, runBenchCompare([]string{basePath, curPath}, io.Discard), errRegression)
+	assert.NoError(t, runBenchCompare([]string{"-threshold", "0.5", basePath, curPath}, io.Discard))
+
+	assert.ErrorIs(t, runBenchCompare([]string{basePath}, io.Discard), errBadArguments)
+	assert.ErrorIs(t, runBenchCompare([]string{"-threshold", "-1", basePath, curPath}, io.Discard), errBadArguments)
+	assert.Error(t, runBenchCompare([]string{basePath, filepath.Join(t.TempDir(), "missing.json")}, io.Discard))
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Fields which are zero or out of range are replaced with the defaults given in parentheses.
+type BreakerConfig struct {
+	// Fraction of failed tasks within a window which opens the circuit, in range (0, 1] (0.5).
+	ErrorRate float64
+	// Minimum number of completed tasks within a window before the error rate is considered (10).
+	MinTasks int
+	// Length of the window the error rate is computed over (1 minute).
+	Window time.Duration
+	// How long submissions to a group fail fast once its circuit was opened (30 seconds).
+	Cooldown time.Duration
+}
+
+// Replaces zero and out of range fields with the defaults, so a partially filled config
+// doesn't open the circuit on the first failure.
+func (c BreakerConfig) withDefaults() BreakerConfig {
+	if c.ErrorRate <= 0 || c.ErrorRate > 1 {
+		c.ErrorRate = 0.5
+	}
+	if c.MinTasks < 1 {
+		c.MinTasks = 10
+	}
+	if c.Window <= 0 {
+		c.Window = time.Minute
+	}
+	if c.Cooldown <= 0 {
+		c.Cooldown = 30 * time.Second
+	}
+	return c
+}
+
+type groupBreaker struct {
+	windowStart time.Time
+	total       int
+	failed      int
+	openUntil   time.Time
+}
+
+// Tracks the error rate of each task group and rejects submissions to failing groups for a cooldown period.
+type circuitBreaker struct {
+	config BreakerConfig
+	groups map[string]*groupBreaker
+	mu     sync.Mutex
+}
+
+// WithCircuitBreaker enables a circuit breaker for tasks submitted with SubmitGroup.
+func WithCircuitBreaker(config BreakerConfig) Option {
+	return func(p *ThreadPool) {
+		p.breaker = &circuitBreaker{
+			config: config.withDefaults(),
+			groups: make(map[string]*groupBreaker),
+		}
+	}
+}
+
+func (b *circuitBreaker) allow(group string, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	g, exists := b.groups[group]
+	return !exists || !now.Before(g.openUntil)
+}
+
+func (b *circuitBreaker) record(group string, failed bool, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	g, exists := b.groups[group]
+	if !exists {
+		g = &groupBreaker{windowStart: now}
+		b.groups[group] = g
+	}
+
+	if now.Sub(g.windowStart) >= b.config.Window {
+		g.windowStart = now
+		g.total = 0
+		g.failed = 0
+	}
+
+	g.total++
+	if failed {
+		g.failed++
+	}
+
+	if g.total >= b.config.MinTasks && float64(g.failed)/float64(g.total) >= b.config.ErrorRate {
+		// Start counting from scratch once the cooldown expires.
+		g.openUntil = now.Add(b.config.Cooldown)
+		g.windowStart = g.openUntil
+		g.total = 0
+		g.failed = 0
+	}
+}
+
+// SubmitGroup submits a task belonging to the named group. The error returned by the task is used
+// by the circuit breaker (see WithCircuitBreaker): while the group's circuit is open, submissions fail with ErrCircuitOpen.
+// Queued tasks of a group can be cancelled with CancelGroup.
+func (p *ThreadPool) SubmitGroup(group string, task func() error) error {
+	if task == nil {
+		return p.SubmitTask(nil)
+	}
+	return p.submitGroup(queuedTask{
+		fn:      func() { p.recordGroupResult(group, task()) },
+		attempt: 1,
+		group:   group,
+	})
+}
+
+// SubmitGroupCtx submits a task belonging to the named group like SubmitGroup, the task receives a context
+// like with SubmitTaskCtx, which is additionally cancelled once CancelGroup is called for the group.
+func (p *ThreadPool) SubmitGroupCtx(ctx context.Context, group string, task func(ctx context.Context) error) error {
+	if task == nil {
+		return p.SubmitTask(nil)
+	}
+	return p.submitGroup(queuedTask{
+		ctxFn:   func(ctx context.Context) { p.recordGroupResult(group, task(ctx)) },
+		ctx:     ctx,
+		attempt: 1,
+		group:   group,
+	})
+}
+
+func (p *ThreadPool) submitGroup(task queuedTask) error {
+	if p.breaker != nil && !p.breaker.allow(task.group, p.clock.Now()) {
+		if p.logsEnabled {
+			p.logger.Info().Str("group", task.group).Msg("circuit open, task rejected")
+		}
+		p.reject(task, RejectCircuitOpen)
+		return ErrCircuitOpen
+	}
+	return p.submit(task)
+}
+
+func (p *ThreadPool) recordGroupResult(group string, err error) {
+	if p.breaker != nil {
+		p.breaker.record(group, err != nil, p.clock.Now())
+	}
+}
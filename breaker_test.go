@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestCircuitBreaker_OpensAndCloses(t *testing.T) {
+	const cooldown = 50 * time.Millisecond
+
+	b := &circuitBreaker{
+		config: BreakerConfig{ErrorRate: 0.5, MinTasks: 4, Window: time.Second, Cooldown: cooldown},
+		groups: make(map[string]*groupBreaker),
+	}
+
+	now := time.Now()
+	b.record("fetch", true, now)
+	b.record("fetch", false, now)
+	b.record("fetch", true, now)
+	assert.True(t, b.allow("fetch", now), "not enough tasks completed yet")
+
+	b.record("fetch", false, now)
+	assert.False(t, b.allow("fetch", now))
+	assert.True(t, b.allow("parse", now), "other groups are not affected")
+
+	assert.True(t, b.allow("fetch", now.Add(cooldown)))
+}
+
+func TestCircuitBreaker_WindowResetsCounters(t *testing.T) {
+	b := &circuitBreaker{
+		config: BreakerConfig{ErrorRate: 0.5, MinTasks: 2, Window: time.Second, Cooldown: time.Second},
+		groups: make(map[string]*groupBreaker),
+	}
+
+	now := time.Now()
+	b.record("fetch", true, now)
+	b.record("fetch", false, now.Add(time.Second))
+	b.record("fetch", false, now.Add(time.Second))
+	assert.True(t, b.allow("fetch", now.Add(time.Second)))
+}
+
+func TestCircuitBreaker_Defaults(t *testing.T) {
+	b := &circuitBreaker{
+		config: BreakerConfig{MinTasks: 2}.withDefaults(),
+		groups: make(map[string]*groupBreaker),
+	}
+	assert.Equal(t, BreakerConfig{ErrorRate: 0.5, MinTasks: 2, Window: time.Minute, Cooldown: 30 * time.Second}, b.config)
+
+	// A zero error rate would have opened the circuit on the first failure.
+	now := time.Now()
+	b.record("fetch", true, now)
+	assert.True(t, b.allow("fetch", now))
+	b.record("fetch", true, now)
+	assert.False(t, b.allow("fetch", now))
+
+	assert.Equal(t, 1.0, BreakerConfig{ErrorRate: 1}.withDefaults().ErrorRate)
+	assert.Equal(t, 0.5, BreakerConfig{ErrorRate: 1.5}.withDefaults().ErrorRate)
+}
+
+func TestSubmitGroupFailsFast(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	var executed uint32
+
+	p := NewPoolWithOptions(2, WithCircuitBreaker(BreakerConfig{
+		ErrorRate: 1,
+		MinTasks:  3,
+		Window:    time.Minute,
+		Cooldown:  time.Minute,
+	}))
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, p.SubmitGroup("dead-endpoint", func() error {
+			atomic.AddUint32(&executed, 1)
+			return errors.New("connection refused")
+		}))
+	}
+
+	// Wait until all the failures are recorded.
+	for p.breaker.allow("dead-endpoint", time.Now()) {
+		time.Sleep(time.Millisecond)
+	}
+
+	assert.ErrorIs(t, p.SubmitGroup("dead-endpoint", func() error { return nil }), ErrCircuitOpen)
+	assert.NoError(t, p.SubmitGroup("healthy", func() error {
+		atomic.AddUint32(&executed, 1)
+		return nil
+	}))
+
+	p.Wait()
+	assert.EqualValues(t, 4, atomic.LoadUint32(&executed))
+}
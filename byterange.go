@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/isnastish/workers_prototype/loadgen"
+)
+
+// Flags restricting a subcommand to a range of bytes of its input.
+type byteRangeFlags struct {
+	offset *string
+	length *string
+}
+
+func addByteRangeFlags(fs *flag.FlagSet) byteRangeFlags {
+	return byteRangeFlags{
+		offset: fs.String("offset", "0", "Process the input starting at this byte offset"),
+		length: fs.String("length", "", "Process at most this many bytes, up to the end of the input if empty"),
+	}
+}
+
+// Validates the range against the size of the input, returns its start and length.
+func (f byteRangeFlags) resolve(size int64) (start, length int64, err error) {
+	offset, err := loadgen.ParseSize(*f.offset)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: invalid offset: %q", errBadArguments, *f.offset)
+	}
+	start = int64(offset)
+	if start > size {
+		return 0, 0, fmt.Errorf("%w: offset %d is past the end of the input of %d bytes", errBadArguments, start, size)
+	}
+
+	if *f.length == "" {
+		return start, size - start, nil
+	}
+
+	n, err := loadgen.ParseSize(*f.length)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: invalid length: %q", errBadArguments, *f.length)
+	}
+	length = int64(n)
+	if length > size-start {
+		return 0, 0, fmt.Errorf("%w: range of %d bytes at offset %d is past the end of the input of %d bytes", errBadArguments, length, start, size)
+	}
+	return start, length, nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestByteRangeFlags(t *testing.T) {
+	resolve := func(size int64, args ...string) (int64, int64, error) {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		f := addByteRangeFlags(fs)
+		assert.NoError(t, fs.Parse(args))
+		return f.resolve(size)
+	}
+
+	start, length, err := resolve(1000)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, start)
+	assert.EqualValues(t, 1000, length)
+
+	start, length, err = resolve(4<<20, "-offset", "1MiB", "-length", "512KiB")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1<<20, start)
+	assert.EqualValues(t, 512<<10, length)
+
+	start, length, err = resolve(1000, "-offset", "1000")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1000, start)
+	assert.EqualValues(t, 0, length)
+
+	for _, args := range [][]string{
+		{"-offset", "1001"},
+		{"-offset", "900", "-length", "101"},
+		{"-offset", "-1"},
+		{"-length", "lots"},
+	} {
+		_, _, err := resolve(1000, args...)
+		assert.ErrorIs(t, err, errBadArguments, args)
+	}
+}
+
+func TestDiffResultShift(t *testing.T) {
+	res := &DiffResult{Ranges: []ByteRange{{0, 5}, {10, 12}}}
+	res.shift(100)
+	assert.Equal(t, []ByteRange{{100, 105}, {110, 112}}, res.Ranges)
+}
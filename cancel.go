@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+type groupTasks struct {
+	queued map[uint64]struct{}
+	// Cancel functions of running tasks, nil for tasks which don't receive a context.
+	running map[uint64]context.CancelFunc
+}
+
+// Keeps track of queued and running tasks of each group, so they can be cancelled with CancelGroup.
+type groupRegistry struct {
+	groups    map[string]*groupTasks
+	cancelled map[uint64]struct{}
+	mu        sync.Mutex
+}
+
+func newGroupRegistry() *groupRegistry {
+	return &groupRegistry{
+		groups:    make(map[string]*groupTasks),
+		cancelled: make(map[uint64]struct{}),
+	}
+}
+
+func (r *groupRegistry) group(name string) *groupTasks {
+	g, exists := r.groups[name]
+	if !exists {
+		g = &groupTasks{
+			queued:  make(map[uint64]struct{}),
+			running: make(map[uint64]context.CancelFunc),
+		}
+		r.groups[name] = g
+	}
+	return g
+}
+
+// Drops the group once it has no tasks, so the registry doesn't grow with every group ever submitted.
+func (r *groupRegistry) release(name string, g *groupTasks) {
+	if len(g.queued) == 0 && len(g.running) == 0 {
+		delete(r.groups, name)
+	}
+}
+
+func (r *groupRegistry) queue(name string, id uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.group(name).queued[id] = struct{}{}
+}
+
+// Marks a queued task as running, returns false if the task was cancelled and has to be skipped.
+func (r *groupRegistry) start(name string, id uint64, cancel context.CancelFunc) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, cancelled := r.cancelled[id]; cancelled {
+		delete(r.cancelled, id)
+		return false
+	}
+
+	g := r.group(name)
+	delete(g.queued, id)
+	g.running[id] = cancel
+	return true
+}
+
+func (r *groupRegistry) finish(name string, id uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	g := r.group(name)
+	delete(g.running, id)
+	r.release(name, g)
+}
+
+// Stops tracking a queued task which leaves the pool without running, returns false if the task was cancelled.
+func (r *groupRegistry) forget(name string, id uint64) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, cancelled := r.cancelled[id]; cancelled {
+		delete(r.cancelled, id)
+		return false
+	}
+
+	g := r.group(name)
+	delete(g.queued, id)
+	r.release(name, g)
+	return true
+}
+
+func (r *groupRegistry) cancel(name string) (skipped, signalled int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	g, exists := r.groups[name]
+	if !exists {
+		return 0, 0
+	}
+
+	for id := range g.queued {
+		r.cancelled[id] = struct{}{}
+		skipped++
+	}
+	clear(g.queued)
+
+	for _, cancel := range g.running {
+		if cancel != nil {
+			cancel()
+			signalled++
+		}
+	}
+
+	r.release(name, g)
+	return skipped, signalled
+}
+
+// CancelGroup cancels all the tasks of the group (see SubmitGroup and SubmitGroupCtx): queued tasks are skipped,
+// and running tasks submitted with SubmitGroupCtx have their contexts cancelled.
+// Returns the number of skipped and signalled tasks. Tasks submitted to the group afterwards run as usual.
+func (p *ThreadPool) CancelGroup(name string) (skipped, signalled int) {
+	return p.groups.cancel(name)
+}
+
+// Accounts for a cancelled task which won't run.
+func (p *ThreadPool) skipCancelled() {
+	atomic.AddUint32(&p.metrics.tasksCancelled, 1)
+	p.releasePending()
+}
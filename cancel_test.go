@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCancelGroup(t *testing.T) {
+	p := newTestPool(t, 1)
+
+	started := make(chan struct{})
+	var interrupted atomic.Bool
+	p.SubmitGroupCtx(context.Background(), "depth-3", func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		interrupted.Store(true)
+		return ctx.Err()
+	})
+	<-started
+
+	// The only worker is busy, so these stay queued.
+	const QUEUED_COUNT = 5
+	var executed uint32
+	for i := 0; i < QUEUED_COUNT; i++ {
+		p.SubmitGroup("depth-3", func() error {
+			atomic.AddUint32(&executed, 1)
+			return nil
+		})
+	}
+	p.SubmitGroup("depth-2", func() error {
+		atomic.AddUint32(&executed, 100)
+		return nil
+	})
+
+	skipped, signalled := p.CancelGroup("depth-3")
+	assert.Equal(t, QUEUED_COUNT, skipped)
+	assert.Equal(t, 1, signalled)
+
+	// Cancelling doesn't affect tasks submitted afterwards.
+	p.SubmitGroup("depth-3", func() error {
+		atomic.AddUint32(&executed, 1000)
+		return nil
+	})
+
+	p.Wait()
+
+	assert.True(t, interrupted.Load())
+	assert.EqualValues(t, 1100, atomic.LoadUint32(&executed))
+	assert.EqualValues(t, QUEUED_COUNT, p.Metrics().TasksCancelled)
+
+	skipped, signalled = p.CancelGroup("depth-3")
+	assert.Equal(t, 0, skipped+signalled)
+	assert.Empty(t, p.groups.groups)
+	assert.Empty(t, p.groups.cancelled)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Assignment of the chunks of a file to tasks.
+type chunkLayout int
+
+const (
+	// Every chunk is processed by a separate task, so consecutive chunks are read by different workers at once.
+	layoutInterleaved chunkLayout = iota
+	// The file is split into one contiguous shard per worker, and each worker reads its shard sequentially,
+	// which suits spinning disks better than jumping between distant offsets.
+	layoutSharded
+)
+
+var chunkLayouts = map[string]chunkLayout{
+	"interleaved": layoutInterleaved,
+	"sharded":     layoutSharded,
+}
+
+func parseChunkLayout(name string) (chunkLayout, error) {
+	layout, exists := chunkLayouts[name]
+	if !exists {
+		return 0, fmt.Errorf("%w: unknown layout: %q, expected one of: %s", errBadArguments, name, chunkLayoutNames())
+	}
+	return layout, nil
+}
+
+func chunkLayoutNames() string {
+	var names []string
+	for name := range chunkLayouts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// Split of an input into fixed-size chunks, computed once so all the chunk accounting agrees.
+// The last chunk, the tail, is shorter unless the size is a multiple of the chunk size. An empty input has no chunks.
+type chunkPlan struct {
+	size      int64
+	chunkSize int
+	count     int
+	tail      int
+}
+
+func newChunkPlan(size int64, chunkSize int) chunkPlan {
+	plan := chunkPlan{size: size, chunkSize: chunkSize}
+	plan.count = int((size + int64(chunkSize) - 1) / int64(chunkSize))
+	if plan.count > 0 {
+		plan.tail = int(size - int64(plan.count-1)*int64(chunkSize))
+	}
+	return plan
+}
+
+func (plan chunkPlan) offset(index int) int64 {
+	return int64(index) * int64(plan.chunkSize)
+}
+
+func (plan chunkPlan) length(index int) int {
+	if index == plan.count-1 {
+		return plan.tail
+	}
+	return plan.chunkSize
+}
+
+// Calls fn for every chunk index on the pool's workers according to the layout.
+// Shards differ in size by at most one chunk.
+func submitChunks(p *ThreadPool, nChunks int, layout chunkLayout, fn func(index int)) {
+	if layout == layoutInterleaved {
+		for i := 0; i < nChunks; i++ {
+			index := i
+			p.SubmitTask(func() { fn(index) })
+		}
+		return
+	}
+
+	shards := min(int(p.maxThreads), nChunks)
+	for i := 0; i < shards; i++ {
+		first, last := i*nChunks/shards, (i+1)*nChunks/shards
+		p.SubmitTask(func() {
+			for index := first; index < last; index++ {
+				fn(index)
+			}
+		})
+	}
+}
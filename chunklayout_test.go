@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubmitChunks(t *testing.T) {
+	for _, layout := range []chunkLayout{layoutInterleaved, layoutSharded} {
+		for _, nChunks := range []int{0, 1, 3, 17} {
+			p := newTestPool(t, 4)
+
+			visits := make([]int, nChunks)
+			var mu sync.Mutex
+			submitChunks(p, nChunks, layout, func(index int) {
+				mu.Lock()
+				visits[index]++
+				mu.Unlock()
+			})
+			p.Wait()
+
+			for index, n := range visits {
+				assert.Equal(t, 1, n, "layout %d, chunk %d of %d", layout, index, nChunks)
+			}
+		}
+	}
+}
+
+func TestMerkleTreeIsIndependentOfLayout(t *testing.T) {
+	data := make([]byte, 10000)
+	rand.New(rand.NewSource(0x5a4d)).Read(data)
+
+	interleaved, err := buildMerkleTree(bytes.NewReader(data), int64(len(data)), merkleOptions{chunkSize: 256, hash: "sha256", maxThreads: 4})
+	assert.NoError(t, err)
+	sharded, err := buildMerkleTree(bytes.NewReader(data), int64(len(data)), merkleOptions{chunkSize: 256, hash: "sha256", maxThreads: 4, layout: layoutSharded})
+	assert.NoError(t, err)
+	assert.Equal(t, interleaved.Root, sharded.Root)
+
+	_, err = parseChunkLayout("striped")
+	assert.ErrorIs(t, err, errBadArguments)
+}
+
+func TestChunkPlan(t *testing.T) {
+	plan := newChunkPlan(1000, 300)
+	assert.Equal(t, chunkPlan{size: 1000, chunkSize: 300, count: 4, tail: 100}, plan)
+	assert.Equal(t, int64(900), plan.offset(3))
+	assert.Equal(t, 300, plan.length(2))
+	assert.Equal(t, 100, plan.length(3))
+
+	// No empty chunk is planned past the end of an input which is a multiple of the chunk size.
+	plan = newChunkPlan(900, 300)
+	assert.Equal(t, 3, plan.count)
+	assert.Equal(t, 300, plan.length(2))
+
+	assert.Equal(t, chunkPlan{size: 0, chunkSize: 300}, newChunkPlan(0, 300))
+}
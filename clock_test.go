@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2024, 3, 24, 10, 32, 0, 0, time.UTC)
+	c := NewFakeClock(start)
+
+	after := c.After(time.Second)
+	timer := c.NewTimer(2 * time.Second)
+	stopped := c.NewTimer(time.Second)
+	assert.True(t, stopped.Stop())
+
+	c.Advance(999 * time.Millisecond)
+	assert.Equal(t, start.Add(999*time.Millisecond), c.Now())
+	assert.Empty(t, after)
+
+	c.Advance(time.Millisecond)
+	assert.Equal(t, start.Add(time.Second), <-after)
+	assert.Empty(t, stopped.C())
+
+	c.Advance(time.Second)
+	assert.Equal(t, start.Add(2*time.Second), <-timer.C())
+	assert.False(t, timer.Stop())
+
+	// Timers which already expired fire right away.
+	assert.Equal(t, c.Now(), <-c.After(0))
+}
+
+func TestCircuitBreakerCooldownWithFakeClock(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+
+	p := newTestPool(t, 0, WithClock(clock), WithCircuitBreaker(BreakerConfig{
+		ErrorRate: 1,
+		MinTasks:  1,
+		Window:    time.Minute,
+		Cooldown:  time.Hour,
+	}))
+
+	assert.NoError(t, p.SubmitGroup("flaky", func() error { return errors.New("timeout") }))
+	assert.NoError(t, p.WaitIdle(context.Background()))
+	assert.ErrorIs(t, p.SubmitGroup("flaky", func() error { return nil }), ErrCircuitOpen)
+
+	clock.Advance(time.Hour)
+	assert.NoError(t, p.SubmitGroup("flaky", func() error { return nil }))
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Served by the agent subcommand over net/rpc: hashes chunks of files on storage shared with the coordinator,
+// on a local pool. Experimental, the protocol is neither authenticated nor encrypted, so use it in trusted networks only.
+// Only files under the root directory are hashed.
+type Agent struct {
+	root       string // absolute, with symlinks resolved
+	maxThreads uint32
+}
+
+func newAgent(root string, maxThreads uint32) (*Agent, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return nil, err
+	}
+	return &Agent{root: root, maxThreads: maxThreads}, nil
+}
+
+// Resolves symlinks of an absolute path and checks that it stays under the root.
+func (a *Agent) resolve(path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		return "", fmt.Errorf("path is not absolute: %q", path)
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	if rel, err := filepath.Rel(a.root, resolved); err != nil || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("%s is outside of the agent root", path)
+	}
+	return resolved, nil
+}
+
+type HashChunksArgs struct {
+	Path string
+	// Range of the file the chunks are counted from, see the -offset and -length flags of merkle.
+	Offset    int64
+	Size      int64
+	ChunkSize int
+	Hash      string
+	// Chunks [First, Last) of the range are hashed.
+	First int
+	Last  int
+}
+
+type HashChunksReply struct {
+	Leaves [][]byte
+}
+
+func (a *Agent) HashChunks(args HashChunksArgs, reply *HashChunksReply) error {
+	newHash, exists := merkleHashes[args.Hash]
+	if !exists {
+		return fmt.Errorf("unknown hash function: %q", args.Hash)
+	}
+	if args.ChunkSize <= 0 {
+		return fmt.Errorf("invalid chunk size: %d", args.ChunkSize)
+	}
+
+	plan := newChunkPlan(args.Size, args.ChunkSize)
+	if args.First < 0 || args.First > args.Last || args.Last > plan.count {
+		return fmt.Errorf("chunks [%d, %d) are out of the %d chunks of the file", args.First, args.Last, plan.count)
+	}
+
+	path, err := a.resolve(args.Path)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	leaves, err := hashLeaves(io.NewSectionReader(f, args.Offset, args.Size), plan, args.First, args.Last, newHash,
+		merkleOptions{maxThreads: a.maxThreads})
+	if err != nil {
+		return err
+	}
+
+	reply.Leaves = make([][]byte, len(leaves))
+	for i, leaf := range leaves {
+		reply.Leaves[i] = leaf
+	}
+	return nil
+}
+
+// Health check answered while chunks are being hashed, replies with seq.
+func (a *Agent) Ping(seq int, reply *int) error {
+	*reply = seq
+	return nil
+}
+
+// Serves the agent, an *Agent outside of tests, on connections accepted by l until it is closed.
+func serveAgent(l net.Listener, a any) error {
+	s := rpc.NewServer()
+	if err := s.RegisterName("Agent", a); err != nil {
+		return err
+	}
+
+	for {
+		conn, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		go s.ServeConn(conn)
+	}
+}
+
+type clusterOptions struct {
+	agents    []string      // host:port of the agents
+	heartbeat time.Duration // interval of pings sent to busy agents
+	timeout   time.Duration // agents not heard of for this long are considered dead
+	warn      io.Writer     // unreachable and dead agents are reported here
+}
+
+// Range of chunks assigned to an agent at once.
+type chunkRange struct {
+	first, last int
+}
+
+// Splits the plan into ranges, several per agent, so faster agents take more of them.
+func chunkRanges(plan chunkPlan, agents int) []chunkRange {
+	size := max(1, plan.count/(4*agents))
+
+	var ranges []chunkRange
+	for first := 0; first < plan.count; first += size {
+		ranges = append(ranges, chunkRange{first, min(first+size, plan.count)})
+	}
+	return ranges
+}
+
+// Ranges waiting for an agent. Ranges of dead agents are put back, so a range can be hashed more than once,
+// results are stored only for the first completion of a range, keyed by its first chunk.
+type rangeQueue struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	ranges   []chunkRange
+	inFlight int
+	done     map[int]bool
+}
+
+func newRangeQueue(ranges []chunkRange) *rangeQueue {
+	q := &rangeQueue{ranges: ranges, done: make(map[int]bool, len(ranges))}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// Blocks until a range is available, returns false once all of them are done.
+func (q *rangeQueue) take() (chunkRange, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.ranges) == 0 && q.inFlight != 0 {
+		q.cond.Wait()
+	}
+	if len(q.ranges) == 0 {
+		return chunkRange{}, false
+	}
+
+	r := q.ranges[0]
+	q.ranges = q.ranges[1:]
+	q.inFlight++
+	return r, true
+}
+
+func (q *rangeQueue) complete(r chunkRange, store func()) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.done[r.first] {
+		q.done[r.first] = true
+		store()
+	}
+	q.inFlight--
+	q.cond.Broadcast()
+}
+
+func (q *rangeQueue) requeue(r chunkRange) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.ranges = append(q.ranges, r)
+	q.inFlight--
+	q.cond.Broadcast()
+}
+
+func (q *rangeQueue) remaining() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.ranges)
+}
+
+// Hashes the chunks of the range [offset, offset+size) of the file on the agents and builds the tree centrally.
+// The file has to be available to the agents under the same path, inside their -root. Agents take ranges of chunks from a shared queue,
+// ranges of agents which fail or stop answering heartbeats are reassigned to the rest.
+func buildMerkleTreeOnAgents(path string, offset, size int64, opts merkleOptions, cluster clusterOptions) (*MerkleTree, error) {
+	newHash, exists := merkleHashes[opts.hash]
+	if !exists {
+		return nil, fmt.Errorf("%w: unknown hash function: %q", errBadArguments, opts.hash)
+	}
+
+	plan := newChunkPlan(size, opts.chunkSize)
+	leaves := make([]hexDigest, plan.count)
+	queue := newRangeQueue(chunkRanges(plan, len(cluster.agents)))
+	args := HashChunksArgs{Path: path, Offset: offset, Size: size, ChunkSize: opts.chunkSize, Hash: opts.hash}
+
+	var errs []error
+	var mu sync.Mutex
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, err)
+		if cluster.warn != nil {
+			fmt.Fprintf(cluster.warn, "warning: %s\n", err.Error())
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, addr := range cluster.agents {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+
+			// Agents are dialed concurrently and with a timeout, so an unreachable one doesn't hold up the rest.
+			conn, err := net.DialTimeout("tcp", addr, cluster.timeout)
+			if err != nil {
+				fail(fmt.Errorf("agent %s: %w", addr, err))
+				return
+			}
+			client := rpc.NewClient(conn)
+			defer client.Close()
+
+			if err := hashRangesOnAgent(client, queue, args, leaves, cluster); err != nil {
+				fail(fmt.Errorf("agent %s: %w", addr, err))
+			}
+		}(addr)
+	}
+	wg.Wait()
+
+	if n := queue.remaining(); n != 0 || len(errs) == len(cluster.agents) {
+		return nil, fmt.Errorf("no agents left with %d ranges of chunks to hash: %w", n, errors.Join(errs...))
+	}
+	return newMerkleTree(leaves, size, opts, newHash), nil
+}
+
+// Hashes ranges taken from the queue on a single agent until the queue is drained.
+// Returns an error once the agent fails, putting its range back to the queue.
+func hashRangesOnAgent(client *rpc.Client, queue *rangeQueue, args HashChunksArgs, leaves []hexDigest, cluster clusterOptions) error {
+	heartbeat := time.NewTicker(cluster.heartbeat)
+	defer heartbeat.Stop()
+
+	lastSeen := time.Now()
+	var seq, pong int
+	var ping chan *rpc.Call // nil while no ping is in flight
+
+	for {
+		r, ok := queue.take()
+		if !ok {
+			return nil
+		}
+
+		args.First, args.Last = r.first, r.last
+		var reply HashChunksReply
+		call := client.Go("Agent.HashChunks", args, &reply, make(chan *rpc.Call, 1))
+
+	wait:
+		for {
+			select {
+			case <-call.Done:
+				break wait
+			case p := <-ping:
+				ping = nil
+				if p.Error == nil {
+					lastSeen = time.Now()
+				}
+			case <-heartbeat.C:
+				if time.Since(lastSeen) > cluster.timeout {
+					queue.requeue(r)
+					return fmt.Errorf("no heartbeat for %s, chunks [%d, %d) are reassigned", cluster.timeout, r.first, r.last)
+				}
+				if ping == nil {
+					seq++
+					ping = client.Go("Agent.Ping", seq, &pong, make(chan *rpc.Call, 1)).Done
+				}
+			}
+		}
+
+		err := call.Error
+		if err == nil && len(reply.Leaves) != r.last-r.first {
+			err = fmt.Errorf("got %d leaves", len(reply.Leaves))
+		}
+		if err != nil {
+			queue.requeue(r)
+			return fmt.Errorf("chunks [%d, %d) are reassigned: %w", r.first, r.last, err)
+		}
+		lastSeen = time.Now()
+
+		queue.complete(r, func() {
+			for i, leaf := range reply.Leaves {
+				leaves[r.first+i] = leaf
+			}
+		})
+	}
+}
+
+// Runs an agent hashing chunks for merkle -agents until the process is killed.
+func runAgent(args []string) error {
+	fs := flag.NewFlagSet("agent", flag.ContinueOnError)
+
+	listen := fs.String("listen", "127.0.0.1:7070", "Address to accept coordinators on")
+	root := fs.String("root", "", "Directory with the files coordinators may hash, required")
+	threads := fs.Uint("threads", 0, "Maximum number of workers, defaults to the number of CPUs")
+
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%w: %s", errBadArguments, err.Error())
+	}
+
+	if *root == "" {
+		return fmt.Errorf("%w: -root is required", errBadArguments)
+	}
+	agent, err := newAgent(*root, uint32(*threads))
+	if err != nil {
+		return fmt.Errorf("%w: invalid root: %s", errBadArguments, err.Error())
+	}
+
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "agent: listening on %s, serving files under %s\n", l.Addr(), agent.root)
+
+	return serveAgent(l, agent)
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"net"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Starts an agent serving files under root.
+func startAgent(t *testing.T, root string) string {
+	a, err := newAgent(root, 2)
+	assert.NoError(t, err)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	go serveAgent(l, a)
+	return l.Addr().String()
+}
+
+// Registered as "Agent" to simulate agents which hang or fail.
+type brokenAgent struct {
+	hang chan struct{} // calls block until it is closed, if set
+	err  error         // returned by HashChunks otherwise
+}
+
+func (a *brokenAgent) HashChunks(args HashChunksArgs, reply *HashChunksReply) error {
+	if a.hang != nil {
+		<-a.hang
+	}
+	return a.err
+}
+
+func (a *brokenAgent) Ping(seq int, reply *int) error {
+	if a.hang != nil {
+		<-a.hang
+	}
+	*reply = seq
+	return nil
+}
+
+func startBrokenAgent(t *testing.T, a *brokenAgent) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		if a.hang != nil {
+			close(a.hang)
+		}
+		l.Close()
+	})
+
+	go serveAgent(l, a)
+	return l.Addr().String()
+}
+
+func testCluster(agents ...string) clusterOptions {
+	return clusterOptions{agents: agents, heartbeat: 10 * time.Millisecond, timeout: 100 * time.Millisecond}
+}
+
+func TestMerkleTreeOnAgents(t *testing.T) {
+	const chunkSize = 64
+
+	data := make([]byte, 40*chunkSize+9)
+	rand.New(rand.NewSource(0xa9e7)).Read(data)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data")
+	assert.NoError(t, os.WriteFile(path, data, 0o644))
+
+	opts := merkleOptions{chunkSize: chunkSize, hash: "sha256", maxThreads: 2}
+	agents := []string{startAgent(t, dir), startAgent(t, dir)}
+
+	// A range of the file, starting in the middle of a chunk.
+	const offset = 100
+	size := int64(len(data) - offset)
+
+	want, err := buildMerkleTree(bytes.NewReader(data[offset:]), size, opts)
+	assert.NoError(t, err)
+
+	tree, err := buildMerkleTreeOnAgents(path, offset, size, opts, testCluster(agents...))
+	assert.NoError(t, err)
+	assert.Equal(t, want, tree)
+
+	// The whole file on a single agent.
+	want, err = buildMerkleTree(bytes.NewReader(data), int64(len(data)), opts)
+	assert.NoError(t, err)
+
+	tree, err = buildMerkleTreeOnAgents(path, 0, int64(len(data)), opts, testCluster(agents[0]))
+	assert.NoError(t, err)
+	assert.Equal(t, want, tree)
+}
+
+func TestMerkleTreeOnAgentsErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data")
+	assert.NoError(t, os.WriteFile(path, make([]byte, 1000), 0o644))
+
+	opts := merkleOptions{chunkSize: 100, hash: "sha256"}
+	addr := startAgent(t, dir)
+
+	// Without agents left the run fails.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	unreachable := l.Addr().String()
+	l.Close()
+
+	_, err = buildMerkleTreeOnAgents(path, 0, 1000, opts, testCluster(unreachable))
+	assert.ErrorContains(t, err, unreachable)
+
+	_, err = buildMerkleTreeOnAgents(path+".missing", 0, 1000, opts, testCluster(addr))
+	assert.ErrorContains(t, err, "no agents left")
+
+	// Agents reject chunks out of the range.
+	client, err := rpc.Dial("tcp", addr)
+	assert.NoError(t, err)
+	defer client.Close()
+
+	var reply HashChunksReply
+	err = client.Call("Agent.HashChunks", HashChunksArgs{Path: path, Size: 1000, ChunkSize: 100, Hash: "sha256", First: 5, Last: 11}, &reply)
+	assert.ErrorContains(t, err, "out of the 10 chunks")
+
+	err = client.Call("Agent.HashChunks", HashChunksArgs{Path: path, Size: 1000, ChunkSize: 100, Hash: "md4", Last: 1}, &reply)
+	assert.ErrorContains(t, err, "unknown hash function")
+}
+
+func TestAgentRejectsPathsOutsideRoot(t *testing.T) {
+	root, outside := t.TempDir(), t.TempDir()
+	secret := filepath.Join(outside, "secret")
+	assert.NoError(t, os.WriteFile(secret, make([]byte, 1000), 0o644))
+	assert.NoError(t, os.Symlink(secret, filepath.Join(root, "link")))
+
+	client, err := rpc.Dial("tcp", startAgent(t, root))
+	assert.NoError(t, err)
+	defer client.Close()
+
+	for _, path := range []string{secret, filepath.Join(root, "..", filepath.Base(outside), "secret"), filepath.Join(root, "link")} {
+		var reply HashChunksReply
+		err := client.Call("Agent.HashChunks", HashChunksArgs{Path: path, Size: 1000, ChunkSize: 100, Hash: "sha256", Last: 10}, &reply)
+		assert.ErrorContains(t, err, "outside of the agent root", path)
+	}
+
+	var reply HashChunksReply
+	err = client.Call("Agent.HashChunks", HashChunksArgs{Path: "secret", Size: 1000, ChunkSize: 100, Hash: "sha256", Last: 10}, &reply)
+	assert.ErrorContains(t, err, "not absolute")
+
+	assert.ErrorIs(t, runAgent(nil), errBadArguments)
+}
+
+func TestMerkleWithoutReachableAgents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data")
+	assert.NoError(t, os.WriteFile(path, make([]byte, 1000), 0o644))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	unreachable := l.Addr().String()
+	l.Close()
+
+	err = runMerkle([]string{"-in", path, "-chunk", "100B", "-agents", unreachable, "-quiet"})
+	assert.ErrorContains(t, err, "no agents left")
+}
+
+func TestMerkleTreeOnAgentsReassignsChunks(t *testing.T) {
+	const chunkSize = 10
+
+	data := make([]byte, 100*chunkSize)
+	rand.New(rand.NewSource(0x5eed)).Read(data)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data")
+	assert.NoError(t, os.WriteFile(path, data, 0o644))
+
+	opts := merkleOptions{chunkSize: chunkSize, hash: "sha256", maxThreads: 2}
+	want, err := buildMerkleTree(bytes.NewReader(data), int64(len(data)), opts)
+	assert.NoError(t, err)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	unreachable := l.Addr().String()
+	l.Close()
+
+	hung := startBrokenAgent(t, &brokenAgent{hang: make(chan struct{})})
+	failing := startBrokenAgent(t, &brokenAgent{err: errors.New("disk is not mounted")})
+
+	// Ranges of the hung and failing agents are hashed by the healthy one, the unreachable one is skipped.
+	var warnings bytes.Buffer
+	cluster := testCluster(hung, unreachable, failing, startAgent(t, dir))
+	cluster.warn = &warnings
+
+	tree, err := buildMerkleTreeOnAgents(path, 0, int64(len(data)), opts, cluster)
+	assert.NoError(t, err)
+	assert.Equal(t, want, tree)
+
+	assert.Contains(t, warnings.String(), "agent "+hung+": no heartbeat for 100ms")
+	assert.Contains(t, warnings.String(), "agent "+unreachable)
+	assert.Contains(t, warnings.String(), "agent "+failing+": chunks")
+	assert.Contains(t, warnings.String(), "disk is not mounted")
+}
+
+func TestMerkleTreeOnAgentsDialTimeout(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data")
+	assert.NoError(t, os.WriteFile(path, make([]byte, 1000), 0o644))
+
+	opts := merkleOptions{chunkSize: 100, hash: "sha256"}
+	want, err := buildMerkleTree(bytes.NewReader(make([]byte, 1000)), 1000, opts)
+	assert.NoError(t, err)
+
+	// TEST-NET-1 isn't routed, connecting to it either hangs until the timeout or fails right away.
+	blackholed := "192.0.2.1:7070"
+
+	start := time.Now()
+	tree, err := buildMerkleTreeOnAgents(path, 0, 1000, opts, testCluster(blackholed, startAgent(t, dir)))
+	assert.NoError(t, err)
+	assert.Equal(t, want, tree)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestRangeQueueStoresFirstCompletion(t *testing.T) {
+	q := newRangeQueue([]chunkRange{{0, 2}})
+
+	r, ok := q.take()
+	assert.True(t, ok)
+	q.requeue(r)
+
+	r, ok = q.take()
+	assert.True(t, ok)
+
+	stored := 0
+	q.complete(r, func() { stored++ })
+	q.inFlight++ // a late duplicate of the reassigned range
+	q.complete(r, func() { stored++ })
+	assert.Equal(t, 1, stored)
+
+	_, ok = q.take()
+	assert.False(t, ok)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/isnastish/workers_prototype/loadgen"
+)
+
+// Pipelines which can be benchmarked by the compare subcommand, each processes the whole input once.
+// The sort pipeline reads its input sequentially, so it ignores the chunk layout.
+var comparePipelines = map[string]func(in *os.File, size int64, chunkSize int, threads uint32, layout chunkLayout, poolOptions []Option) error{
+	"merkle": func(in *os.File, size int64, chunkSize int, threads uint32, layout chunkLayout, poolOptions []Option) error {
+		_, err := buildMerkleTree(in, size, merkleOptions{chunkSize: chunkSize, hash: "sha256", maxThreads: threads, layout: layout, poolOptions: poolOptions})
+		return err
+	},
+	"sort": func(in *os.File, size int64, chunkSize int, threads uint32, layout chunkLayout, poolOptions []Option) error {
+		if _, err := in.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		return externalSort(in, io.Discard, sortOptions{chunkSize: chunkSize, maxThreads: threads, poolOptions: poolOptions})
+	},
+}
+
+// Returned by evictFromPageCache on platforms where it isn't implemented.
+var errEvictUnsupported = errors.New("evicting files from the page cache is not supported on this platform")
+
+type throughputStats struct {
+	Mean   float64
+	Stddev float64
+	Min    float64
+	Max    float64
+}
+
+// Computes statistics of the samples, the standard deviation is the sample one.
+func computeThroughputStats(samples []float64) throughputStats {
+	if len(samples) == 0 {
+		return throughputStats{}
+	}
+
+	s := throughputStats{Min: samples[0], Max: samples[0]}
+	var sum float64
+	for _, v := range samples {
+		sum += v
+		s.Min = min(s.Min, v)
+		s.Max = max(s.Max, v)
+	}
+	s.Mean = sum / float64(len(samples))
+
+	if len(samples) > 1 {
+		var sq float64
+		for _, v := range samples {
+			sq += (v - s.Mean) * (v - s.Mean)
+		}
+		s.Stddev = math.Sqrt(sq / float64(len(samples)-1))
+	}
+	return s
+}
+
+// Runs the same pipeline over a file several times and reports throughput statistics,
+// the first warm-up runs, which mostly measure filling the page cache, are discarded.
+func runCompare(args []string) error {
+	fs := flag.NewFlagSet("compare", flag.ContinueOnError)
+
+	input := fs.String("file", "", "Input file")
+	pipeline := fs.String("pipeline", "merkle", "Pipeline to run, merkle or sort")
+	runs := fs.Int("runs", 5, "Number of measured runs")
+	warmup := fs.Int("warmup", 1, "Number of discarded warm-up runs")
+	chunk := fs.String("chunk", "4MiB", "Size of a chunk processed by a single task")
+	threads := fs.Uint("threads", 0, "Maximum number of workers, defaults to the number of CPUs")
+	cold := fs.Bool("cold", false, "Evict the file from the page cache before each run, where supported")
+	layoutNames := fs.String("layout", "interleaved", "Comma-separated chunk layouts to measure, of: "+chunkLayoutNames())
+	output := addOutputFlags(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%w: %s", errBadArguments, err.Error())
+	}
+
+	run, exists := comparePipelines[*pipeline]
+	if !exists {
+		return fmt.Errorf("%w: unknown pipeline: %q", errBadArguments, *pipeline)
+	}
+	if *input == "" {
+		return fmt.Errorf("%w: input file is required", errBadArguments)
+	}
+	if *runs < 1 || *warmup < 0 {
+		return fmt.Errorf("%w: at least one measured run is required", errBadArguments)
+	}
+
+	chunkSize, err := loadgen.ParseSize(*chunk)
+	if err != nil || chunkSize == 0 {
+		return fmt.Errorf("%w: invalid chunk size: %q", errBadArguments, *chunk)
+	}
+
+	var layouts []chunkLayout
+	names := strings.Split(*layoutNames, ",")
+	for _, name := range names {
+		layout, err := parseChunkLayout(name)
+		if err != nil {
+			return err
+		}
+		layouts = append(layouts, layout)
+	}
+
+	poolOptions, err := output.poolOptions()
+	if err != nil {
+		return err
+	}
+
+	in, err := os.Open(*input)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	stdout := output.stdout()
+	fmt.Fprintf(stdout, "pipeline:  %s\n", *pipeline)
+	fmt.Fprintf(stdout, "runs:      %d (+%d warm-up)\n", *runs, *warmup)
+
+	for i, layout := range layouts {
+		samples, err := measureThroughput(in, info.Size(), *warmup, *runs, cold, output.warnings(), func() error {
+			return run(in, info.Size(), chunkSize, uint32(*threads), layout, poolOptions)
+		})
+		if err != nil {
+			return err
+		}
+
+		s := computeThroughputStats(samples)
+		fmt.Fprintf(stdout, "\nlayout:    %s\n", names[i])
+		fmt.Fprintf(stdout, "mean:      %.2f MiB/s\n", s.Mean)
+		fmt.Fprintf(stdout, "stddev:    %.2f MiB/s\n", s.Stddev)
+		fmt.Fprintf(stdout, "min:       %.2f MiB/s\n", s.Min)
+		fmt.Fprintf(stdout, "max:       %.2f MiB/s\n", s.Max)
+	}
+
+	return nil
+}
+
+// Runs the pipeline warmup+runs times, returns the throughput of the measured runs in MiB/s.
+func measureThroughput(in *os.File, size int64, warmup, runs int, cold *bool, warn io.Writer, run func() error) ([]float64, error) {
+	var samples []float64
+	for i := 0; i < warmup+runs; i++ {
+		if *cold {
+			if err := evictFromPageCache(in); err != nil {
+				// Measure the warm cache rather than failing the whole comparison.
+				fmt.Fprintf(warn, "compare: -cold ignored: %s\n", err.Error())
+				*cold = false
+			}
+		}
+
+		start := time.Now()
+		if err := run(); err != nil {
+			return nil, err
+		}
+		elapsed := time.Since(start)
+
+		if i >= warmup {
+			samples = append(samples, float64(size)/(1<<20)/elapsed.Seconds())
+		}
+	}
+	return samples, nil
+}
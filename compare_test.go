@@ -0,0 +1,21 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComputeThroughputStats(t *testing.T) {
+	s := computeThroughputStats([]float64{2, 4, 4, 4, 5, 5, 7, 9})
+	assert.Equal(t, 5.0, s.Mean)
+	assert.InDelta(t, math.Sqrt(32.0/7), s.Stddev, 1e-9)
+	assert.Equal(t, 2.0, s.Min)
+	assert.Equal(t, 9.0, s.Max)
+
+	s = computeThroughputStats([]float64{3})
+	assert.Equal(t, throughputStats{Mean: 3, Min: 3, Max: 3}, s)
+
+	assert.Equal(t, throughputStats{}, computeThroughputStats(nil))
+}
@@ -0,0 +1,24 @@
+package main
+
+import "context"
+
+type taskInfoKey struct{}
+
+type taskInfo struct {
+	workerID uint32
+	attempt  int
+}
+
+// Returns the ID of the worker running the task, for tasks submitted with SubmitTaskCtx.
+// IDs of running workers are below the pool's maximum number of workers and are reused,
+// so they can be used to shard resources between workers.
+func WorkerIDFromContext(ctx context.Context) (uint32, bool) {
+	info, ok := ctx.Value(taskInfoKey{}).(taskInfo)
+	return info.workerID, ok
+}
+
+// Returns the attempt number of the task starting from 1, for tasks submitted with SubmitTaskCtx.
+func AttemptFromContext(ctx context.Context) (int, bool) {
+	info, ok := ctx.Value(taskInfoKey{}).(taskInfo)
+	return info.attempt, ok
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+type ctxKey struct{}
+
+func TestWorkerIDAndAttemptFromContext(t *testing.T) {
+	skipInStrictMode(t)
+
+	defer goleak.VerifyNone(t)
+
+	const TASKS_COUNT = 64
+
+	p := NewPool(4)
+
+	var mu sync.Mutex
+	workerIDs := map[uint32]int{}
+
+	parent := context.WithValue(context.Background(), ctxKey{}, "request-id")
+	for i := 0; i < TASKS_COUNT; i++ {
+		p.SubmitTaskCtx(parent, func(ctx context.Context) {
+			id, ok := WorkerIDFromContext(ctx)
+			assert.True(t, ok)
+
+			attempt, ok := AttemptFromContext(ctx)
+			assert.True(t, ok)
+			assert.Equal(t, 1, attempt)
+
+			// Values of the parent context are preserved.
+			assert.Equal(t, "request-id", ctx.Value(ctxKey{}))
+
+			mu.Lock()
+			workerIDs[id]++
+			mu.Unlock()
+		})
+	}
+	p.Wait()
+
+	total := 0
+	for id, count := range workerIDs {
+		assert.Less(t, id, p.maxThreads)
+		total += count
+	}
+	assert.Equal(t, TASKS_COUNT, total)
+
+	assert.ErrorIs(t, p.SubmitTaskCtx(parent, nil), ErrNilTask)
+}
+
+func TestContextWithoutTaskInfo(t *testing.T) {
+	_, ok := WorkerIDFromContext(context.Background())
+	assert.False(t, ok)
+
+	_, ok = AttemptFromContext(context.Background())
+	assert.False(t, ok)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCron(t *testing.T) {
+	// Saturday.
+	start := time.Date(2024, time.March, 16, 10, 17, 30, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		next []time.Time
+	}{
+		{"* * * * *", []time.Time{
+			time.Date(2024, time.March, 16, 10, 18, 0, 0, time.UTC),
+			time.Date(2024, time.March, 16, 10, 19, 0, 0, time.UTC),
+		}},
+		{"*/15 9-10 * * *", []time.Time{
+			time.Date(2024, time.March, 16, 10, 30, 0, 0, time.UTC),
+			time.Date(2024, time.March, 16, 10, 45, 0, 0, time.UTC),
+			time.Date(2024, time.March, 17, 9, 0, 0, 0, time.UTC),
+		}},
+		// Weekdays only, Sunday written as 7 is excluded as well.
+		{"0 8 * * 1-5", []time.Time{
+			time.Date(2024, time.March, 18, 8, 0, 0, 0, time.UTC),
+			time.Date(2024, time.March, 19, 8, 0, 0, 0, time.UTC),
+		}},
+		{"30 0 * * 7", []time.Time{
+			time.Date(2024, time.March, 17, 0, 30, 0, 0, time.UTC),
+			time.Date(2024, time.March, 24, 0, 30, 0, 0, time.UTC),
+		}},
+		// With both day fields restricted, either of them matches.
+		{"0 0 1 * 0", []time.Time{
+			time.Date(2024, time.March, 17, 0, 0, 0, 0, time.UTC),
+			time.Date(2024, time.March, 24, 0, 0, 0, 0, time.UTC),
+			time.Date(2024, time.March, 31, 0, 0, 0, 0, time.UTC),
+			time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC),
+		}},
+		{"0 12 29 2 *", []time.Time{
+			time.Date(2028, time.February, 29, 12, 0, 0, 0, time.UTC),
+		}},
+		{"5,10/20 0 1 1 *", []time.Time{
+			time.Date(2025, time.January, 1, 0, 5, 0, 0, time.UTC),
+			time.Date(2025, time.January, 1, 0, 10, 0, 0, time.UTC),
+			time.Date(2025, time.January, 1, 0, 30, 0, 0, time.UTC),
+			time.Date(2025, time.January, 1, 0, 50, 0, 0, time.UTC),
+			time.Date(2026, time.January, 1, 0, 5, 0, 0, time.UTC),
+		}},
+		// Never matches.
+		{"0 0 30 2 *", []time.Time{{}}},
+	}
+
+	for _, test := range tests {
+		schedule, err := ParseCron(test.expr)
+		assert.NoError(t, err, test.expr)
+
+		at := start
+		for _, want := range test.next {
+			at = schedule.Next(at)
+			assert.Equal(t, want, at, test.expr)
+		}
+	}
+
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8",
+		"*/0 * * * *", "5-1 * * * *", "a * * * *", "1- * * * *"} {
+		_, err := ParseCron(expr)
+		assert.ErrorIs(t, err, ErrInvalidCron, expr)
+	}
+}
+
+func TestEvery(t *testing.T) {
+	start := time.Date(2024, time.March, 16, 10, 17, 30, 0, time.UTC)
+	assert.Equal(t, start.Add(90*time.Second), Every(90*time.Second).Next(start))
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/isnastish/workers_prototype/loadgen"
+)
+
+type diffOptions struct {
+	chunkSize  int    // size of the pair of chunks compared by a single task
+	maxThreads uint32 // maximum number of workers comparing chunks
+	layout     chunkLayout
+
+	poolOptions []Option
+}
+
+// A range of bytes [Start, End) which differs between two files.
+type ByteRange struct {
+	Start int64
+	End   int64
+}
+
+type DiffResult struct {
+	// Differing ranges in ascending order, adjacent ranges are merged.
+	// Bytes past the end of the shorter file are considered different.
+	Ranges []ByteRange
+	// Size of the longer file, or of the compared range of the files.
+	Size int64
+}
+
+// Moves the ranges of a diff of two sections starting at offset to the positions in the whole files.
+func (r *DiffResult) shift(offset int64) {
+	for i := range r.Ranges {
+		r.Ranges[i].Start += offset
+		r.Ranges[i].End += offset
+	}
+}
+
+func (r *DiffResult) DifferentBytes() int64 {
+	var n int64
+	for _, rng := range r.Ranges {
+		n += rng.End - rng.Start
+	}
+	return n
+}
+
+func (r *DiffResult) Print(w io.Writer) {
+	for _, rng := range r.Ranges {
+		fmt.Fprintf(w, "%d-%d (%d bytes)\n", rng.Start, rng.End, rng.End-rng.Start)
+	}
+
+	var percent float64
+	if r.Size > 0 {
+		percent = 100 * float64(r.DifferentBytes()) / float64(r.Size)
+	}
+	fmt.Fprintf(w, "\nSummary:\n")
+	fmt.Fprintf(w, "  size:    %d\n", r.Size)
+	fmt.Fprintf(w, "  differ:  %d bytes (%.2f%%) in %d ranges\n", r.DifferentBytes(), percent, len(r.Ranges))
+}
+
+// Compares two inputs chunk by chunk in parallel, pairs of chunks are assigned to tasks according to opts.layout.
+func diffFiles(a, b io.ReaderAt, sizeA, sizeB int64, opts diffOptions) (*DiffResult, error) {
+	size := max(sizeA, sizeB)
+	plan := newChunkPlan(size, opts.chunkSize)
+	chunkRanges := make([][]ByteRange, plan.count)
+
+	var errs []error
+	var mu sync.Mutex
+
+	p := NewPoolWithOptions(opts.maxThreads, opts.poolOptions...)
+	submitChunks(p, plan.count, opts.layout, func(index int) {
+		offset := plan.offset(index)
+		chunkA, errA := readChunkAt(a, sizeA, offset, opts.chunkSize)
+		chunkB, errB := readChunkAt(b, sizeB, offset, opts.chunkSize)
+		if err := errors.Join(errA, errB); err != nil {
+			mu.Lock()
+			errs = append(errs, fmt.Errorf("chunk at offset %d: %w", offset, err))
+			mu.Unlock()
+			return
+		}
+		chunkRanges[index] = compareChunks(chunkA, chunkB, offset, int64(plan.length(index)))
+	})
+	p.Wait()
+
+	if len(errs) != 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	res := &DiffResult{Size: size}
+	for _, ranges := range chunkRanges {
+		for _, rng := range ranges {
+			// Merge ranges continuing across chunk boundaries.
+			if last := len(res.Ranges) - 1; last >= 0 && res.Ranges[last].End == rng.Start {
+				res.Ranges[last].End = rng.End
+				continue
+			}
+			res.Ranges = append(res.Ranges, rng)
+		}
+	}
+	return res, nil
+}
+
+// Reads up to chunkSize bytes at offset, the chunk is shorter or empty at the end of the input.
+func readChunkAt(in io.ReaderAt, size, offset int64, chunkSize int) ([]byte, error) {
+	if offset >= size {
+		return nil, nil
+	}
+	buf := make([]byte, min(int64(chunkSize), size-offset))
+	n, err := in.ReadAt(buf, offset)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	// The input is shorter than size if it was truncated after being measured,
+	// the chunk holds only the bytes actually read rather than trailing zeros.
+	return buf[:n], nil
+}
+
+// Returns the ranges of a chunk of length n starting at offset which differ between a and b.
+// Chunks could be shorter than n if they were read past the end of their input.
+func compareChunks(a, b []byte, offset, n int64) []ByteRange {
+	var ranges []ByteRange
+	start := int64(-1)
+	for i := int64(0); i < n; i++ {
+		differ := i >= int64(len(a)) || i >= int64(len(b)) || a[i] != b[i]
+		if differ && start < 0 {
+			start = i
+		} else if !differ && start >= 0 {
+			ranges = append(ranges, ByteRange{Start: offset + start, End: offset + i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		ranges = append(ranges, ByteRange{Start: offset + start, End: offset + n})
+	}
+	return ranges
+}
+
+// Compares two files in parallel and prints the ranges which differ, returns true if the files differ.
+func runDiff(args []string) (bool, error) {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+
+	chunk := fs.String("chunk", "4MiB", "Size of a pair of chunks compared by a single task")
+	threads := fs.Uint("threads", 0, "Maximum number of workers, defaults to the number of CPUs")
+	layoutName := fs.String("layout", "interleaved", "Assignment of chunks to workers, one of: "+chunkLayoutNames())
+	byteRange := addByteRangeFlags(fs)
+	onChange := addOnChangeFlag(fs)
+	output := addOutputFlags(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return false, fmt.Errorf("%w: %s", errBadArguments, err.Error())
+	}
+
+	if fs.NArg() != 2 {
+		return false, fmt.Errorf("%w: expected two files to compare", errBadArguments)
+	}
+
+	chunkSize, err := loadgen.ParseSize(*chunk)
+	if err != nil || chunkSize == 0 {
+		return false, fmt.Errorf("%w: invalid chunk size: %q", errBadArguments, *chunk)
+	}
+
+	layout, err := parseChunkLayout(*layoutName)
+	if err != nil {
+		return false, err
+	}
+
+	policy, err := parseChangePolicy(*onChange)
+	if err != nil {
+		return false, err
+	}
+
+	poolOptions, err := output.poolOptions()
+	if err != nil {
+		return false, err
+	}
+
+	var files [2]*os.File
+	var sizes [2]int64
+	var versions [2]fileVersion
+	for i, name := range fs.Args() {
+		if files[i], err = os.Open(name); err != nil {
+			return false, err
+		}
+		defer files[i].Close()
+
+		info, err := files[i].Stat()
+		if err != nil {
+			return false, err
+		}
+		sizes[i] = info.Size()
+		versions[i] = versionOf(info)
+	}
+
+	// The range is validated against the longer file, the shorter one differs past its end.
+	start, length, err := byteRange.resolve(max(sizes[0], sizes[1]))
+	if err != nil {
+		return false, err
+	}
+
+	var sections [2]io.ReaderAt
+	for i := range files {
+		sizes[i] = min(max(sizes[i]-start, 0), length)
+		sections[i] = io.NewSectionReader(files[i], start, sizes[i])
+	}
+
+	res, err := diffFiles(sections[0], sections[1], sizes[0], sizes[1], diffOptions{
+		chunkSize:  chunkSize,
+		maxThreads: uint32(*threads),
+		layout:     layout,
+
+		poolOptions: poolOptions,
+	})
+	if err != nil {
+		return false, err
+	}
+	res.shift(start)
+
+	for i := range files {
+		if err := checkUnchanged(files[i], versions[i], policy, output.warnings()); err != nil {
+			return false, err
+		}
+	}
+
+	res.Print(output.stdout())
+
+	return len(res.Ranges) != 0, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestDiffFiles(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	const chunkSize = 64
+
+	a := make([]byte, 1000)
+	rand.New(rand.NewSource(0xd1ff)).Read(a)
+
+	// b is longer than a, so its tail differs as well.
+	b := append(bytes.Clone(a), 1, 2, 3)
+	b[5] ^= 0xff
+	// Crosses the boundary between the first and the second chunk.
+	for i := 60; i < 70; i++ {
+		b[i] ^= 0xff
+	}
+	b[999] ^= 0xff
+
+	res, err := diffFiles(bytes.NewReader(a), bytes.NewReader(b), int64(len(a)), int64(len(b)), diffOptions{chunkSize: chunkSize, maxThreads: 4})
+	assert.NoError(t, err)
+
+	expected := []ByteRange{{5, 6}, {60, 70}, {999, 1003}}
+	assert.Equal(t, expected, res.Ranges)
+	assert.EqualValues(t, 1003, res.Size)
+	assert.EqualValues(t, 15, res.DifferentBytes())
+
+	var out strings.Builder
+	res.Print(&out)
+	assert.Contains(t, out.String(), "60-70 (10 bytes)")
+	assert.Contains(t, out.String(), "15 bytes (1.50%) in 3 ranges")
+}
+
+func TestDiffIdenticalAndEmptyFiles(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	data := bytes.Repeat([]byte("abc"), 100)
+	res, err := diffFiles(bytes.NewReader(data), bytes.NewReader(data), int64(len(data)), int64(len(data)), diffOptions{chunkSize: 7})
+	assert.NoError(t, err)
+	assert.Empty(t, res.Ranges)
+
+	res, err = diffFiles(bytes.NewReader(nil), bytes.NewReader(nil), 0, 0, diffOptions{chunkSize: 7})
+	assert.NoError(t, err)
+	assert.Empty(t, res.Ranges)
+	assert.EqualValues(t, 0, res.Size)
+}
+
+func TestDiffShortRead(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	// b was truncated to 95 bytes after its size was measured, the zeros it used to be padded with
+	// must not compare equal to the zeros of a.
+	a := make([]byte, 100)
+	b := make([]byte, 95)
+	res, err := diffFiles(bytes.NewReader(a), bytes.NewReader(b), 100, 100, diffOptions{chunkSize: 30})
+	assert.NoError(t, err)
+	assert.Equal(t, []ByteRange{{Start: 95, End: 100}}, res.Ranges)
+}
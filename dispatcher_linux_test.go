@@ -0,0 +1,30 @@
+//go:build linux
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func processCPUTime(t *testing.T) time.Duration {
+	var usage unix.Rusage
+	assert.NoError(t, unix.Getrusage(unix.RUSAGE_SELF, &usage))
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+}
+
+func TestIdlePoolDoesntSpin(t *testing.T) {
+	p := newTestPool(t, 2, WithMinWorkers(2))
+	p.SubmitTask(func() {})
+
+	// Let the task complete and the dispatcher park.
+	time.Sleep(10 * time.Millisecond)
+
+	const idle = 200 * time.Millisecond
+	before := processCPUTime(t)
+	time.Sleep(idle)
+	assert.Less(t, processCPUTime(t)-before, idle/4)
+}
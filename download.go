@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/isnastish/workers_prototype/loadgen"
+)
+
+type downloadOptions struct {
+	chunkSize  int    // size of the range fetched by a single task
+	maxThreads uint32 // maximum number of concurrent range requests
+	attempts   int    // maximum number of attempts to fetch a range
+	rateLimit  int64  // bytes per second across all the requests, 0 means no limit
+
+	poolOptions []Option
+}
+
+var (
+	// Returned for servers which answered a range request with the whole file.
+	errRangeIgnored = errors.New("server ignored the range request")
+	// Returned for partial responses with a range other than the requested one, or of a changed file.
+	errRangeMismatch = errors.New("server sent a different range than requested")
+)
+
+// The file fetched by the range requests of a download.
+type remoteFile struct {
+	url  string
+	size int64
+	// Strong ETag or Last-Modified of the HEAD response, sent as If-Range, so a changed file isn't mixed with the old one.
+	validator string
+}
+
+// Spreads reads of all the requests over time, so their total rate stays below the limit.
+type rateLimiter struct {
+	rate int64 // bytes per second
+	next time.Time
+	mu   sync.Mutex
+}
+
+// Waits until n more bytes may be read.
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	if l == nil {
+		return nil
+	}
+
+	// Reserve the time slot following the reservations made so far.
+	l.mu.Lock()
+	now := time.Now()
+	start := l.next
+	if start.Before(now) {
+		start = now
+	}
+	l.next = start.Add(time.Duration(int64(n) * int64(time.Second) / l.rate))
+	l.mu.Unlock()
+
+	delay := start.Sub(now)
+
+	if delay <= 0 {
+		return nil
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Copies src into dst in pieces allowed by the limiter.
+func copyLimited(ctx context.Context, dst io.Writer, src io.Reader, limiter *rateLimiter) (int64, error) {
+	if limiter == nil {
+		return io.Copy(dst, src)
+	}
+
+	buf := make([]byte, 32<<10)
+	var written int64
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if err := limiter.wait(ctx, n); err != nil {
+				return written, err
+			}
+			if _, err := dst.Write(buf[:n]); err != nil {
+				return written, err
+			}
+			written += int64(n)
+		}
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+}
+
+// Downloads url into out. If the server reports the size and supports range requests, chunks are fetched
+// concurrently and retried on timeouts, 429 and 5xx statuses, otherwise the file is downloaded sequentially.
+// A server answering a range request with the whole file or with a different range, e.g. because the file changed
+// since the HEAD request, falls back to the sequential download too.
+// Returns the number of bytes written.
+func download(ctx context.Context, client *http.Client, url string, out *os.File, opts downloadOptions) (int64, error) {
+	var limiter *rateLimiter
+	if opts.rateLimit > 0 {
+		limiter = &rateLimiter{rate: opts.rateLimit}
+	}
+
+	head, err := newRequest(ctx, http.MethodHead, url)
+	if err != nil {
+		return 0, err
+	}
+	response, err := client.Do(head)
+	if err != nil {
+		return 0, err
+	}
+	response.Body.Close()
+
+	size := response.ContentLength
+	if response.StatusCode != http.StatusOK || size < 0 || response.Header.Get("Accept-Ranges") != "bytes" {
+		return downloadSequential(ctx, client, url, out, limiter)
+	}
+
+	if err := out.Truncate(size); err != nil {
+		return 0, err
+	}
+
+	file := remoteFile{url: url, size: size, validator: response.Header.Get("Last-Modified")}
+	if etag := response.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		file.validator = etag
+	}
+
+	plan := newChunkPlan(size, opts.chunkSize)
+
+	threads := opts.maxThreads
+	if threads == 0 {
+		threads = uint32(runtime.NumCPU())
+	}
+
+	// A server ignoring or mismatching ranges cancels the remaining chunks, the file is downloaded sequentially instead.
+	chunkCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	var errs []error
+	var mu sync.Mutex
+
+	p := NewPoolWithOptions(0, append(opts.poolOptions, WithIOWorkers(threads))...)
+	for i := 0; i < plan.count; i++ {
+		offset, length := plan.offset(i), plan.length(i)
+		err := p.workersFor(IOBound).SubmitRetry(chunkCtx, RetryPolicy{
+			MaxAttempts: opts.attempts,
+			Backoff:     500 * time.Millisecond,
+			MaxBackoff:  30 * time.Second,
+			OnDone: func(err error, attempts int) {
+				if errors.Is(err, errRangeIgnored) || errors.Is(err, errRangeMismatch) {
+					cancel(err)
+				}
+				if err != nil {
+					mu.Lock()
+					errs = append(errs, fmt.Errorf("range at offset %d: %w", offset, err))
+					mu.Unlock()
+				}
+			},
+		}, func(ctx context.Context) error {
+			return fetchRange(ctx, client, file, out, offset, length, limiter)
+		})
+		if err != nil {
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+			break
+		}
+	}
+	p.Wait()
+
+	if cause := context.Cause(chunkCtx); errors.Is(cause, errRangeIgnored) || errors.Is(cause, errRangeMismatch) {
+		return downloadSequential(ctx, client, url, out, limiter)
+	}
+	if len(errs) != 0 {
+		return 0, errors.Join(errs...)
+	}
+	return size, nil
+}
+
+// Fetches length bytes at offset and writes them at the same offset of out.
+func fetchRange(ctx context.Context, client *http.Client, file remoteFile, out *os.File, offset int64, length int, limiter *rateLimiter) error {
+	req, err := newRequest(ctx, http.MethodGet, file.url)
+	if err != nil {
+		return Permanent(err)
+	}
+	last := offset + int64(length) - 1
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, last))
+	if file.validator != "" {
+		req.Header.Set("If-Range", file.validator)
+	}
+
+	response, err := client.Do(req)
+	if err != nil {
+		return transientFetchError(err)
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		return Permanent(errRangeIgnored)
+	default:
+		return statusError(response, time.Now())
+	}
+
+	contentRange := response.Header.Get("Content-Range")
+	first, end, size, ok := parseContentRange(contentRange)
+	if !ok || first != offset || end != last || (size >= 0 && size != file.size) {
+		return Permanent(fmt.Errorf("%w: got %q for bytes %d-%d of %d", errRangeMismatch, contentRange, offset, last, file.size))
+	}
+	if etag := response.Header.Get("ETag"); etag != "" && strings.HasPrefix(file.validator, `"`) && etag != file.validator {
+		return Permanent(fmt.Errorf("%w: ETag changed from %s to %s", errRangeMismatch, file.validator, etag))
+	}
+
+	// A connection dropped in the middle of the body is worth another attempt.
+	n, err := copyLimited(ctx, io.NewOffsetWriter(out, offset), io.LimitReader(response.Body, int64(length)), limiter)
+	if err != nil {
+		return err
+	}
+	if n != int64(length) {
+		return fmt.Errorf("got %d bytes of %d: %w", n, length, io.ErrUnexpectedEOF)
+	}
+	return nil
+}
+
+// Parses the value of a Content-Range header of a partial response, "bytes first-last/size",
+// size is -1 if the server didn't report it.
+func parseContentRange(value string) (first, last, size int64, ok bool) {
+	spec, found := strings.CutPrefix(value, "bytes ")
+	if !found {
+		return 0, 0, 0, false
+	}
+	rng, total, found := strings.Cut(spec, "/")
+	if !found {
+		return 0, 0, 0, false
+	}
+	firstStr, lastStr, found := strings.Cut(rng, "-")
+	if !found {
+		return 0, 0, 0, false
+	}
+
+	var err error
+	if first, err = strconv.ParseInt(firstStr, 10, 64); err != nil {
+		return 0, 0, 0, false
+	}
+	if last, err = strconv.ParseInt(lastStr, 10, 64); err != nil || last < first {
+		return 0, 0, 0, false
+	}
+	size = -1
+	if total != "*" {
+		if size, err = strconv.ParseInt(total, 10, 64); err != nil {
+			return 0, 0, 0, false
+		}
+	}
+	return first, last, size, true
+}
+
+func downloadSequential(ctx context.Context, client *http.Client, url string, out *os.File, limiter *rateLimiter) (int64, error) {
+	req, err := newRequest(ctx, http.MethodGet, url)
+	if err != nil {
+		return 0, err
+	}
+	response, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return 0, errors.New(response.Status)
+	}
+	if err := out.Truncate(0); err != nil {
+		return 0, err
+	}
+	return copyLimited(ctx, out, response.Body, limiter)
+}
+
+func newRequest(ctx context.Context, method, url string) (*http.Request, error) {
+	return http.NewRequestWithContext(ctx, method, url, nil)
+}
+
+// Downloads a file over HTTP(S) with concurrent range requests.
+func runDownload(args []string) error {
+	fs := flag.NewFlagSet("download", flag.ContinueOnError)
+
+	url := fs.String("url", "", "URL of the file")
+	outFile := fs.String("out", "", "Output file")
+	chunk := fs.String("chunk", "4MiB", "Size of a range fetched by a single request")
+	threads := fs.Uint("threads", 0, "Maximum number of concurrent requests, defaults to the number of CPUs")
+	attempts := fs.Int("attempts", 3, "Maximum number of attempts to fetch a range failing with a timeout, 429 or 5xx status")
+	limitRate := fs.String("limit-rate", "", "Maximum download rate per second, e.g. 10MiB, unlimited if empty")
+	var client ClientOptions
+	client.Headers = make(http.Header)
+	fs.DurationVar(&client.Timeout, "timeout", 0, "Timeout of a single request, 0 means no timeout")
+	fs.StringVar(&client.Proxy, "proxy", "", "Proxy URL, taken from the environment by default")
+	fs.StringVar(&client.UserAgent, "user-agent", "", "User-Agent header of the requests")
+	fs.Var(headerFlag(client.Headers), "header", "Header sent with every request, \"Name: value\", may be repeated")
+	fs.BoolVar(&client.InsecureSkipVerify, "insecure", false, "Don't verify TLS certificates")
+	output := addOutputFlags(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%w: %s", errBadArguments, err.Error())
+	}
+
+	if *url == "" || *outFile == "" {
+		return fmt.Errorf("%w: -url and -out are required", errBadArguments)
+	}
+
+	chunkSize, err := loadgen.ParseSize(*chunk)
+	if err != nil || chunkSize == 0 {
+		return fmt.Errorf("%w: invalid chunk size: %q", errBadArguments, *chunk)
+	}
+
+	if *attempts < 1 {
+		return fmt.Errorf("%w: invalid number of attempts: %d", errBadArguments, *attempts)
+	}
+
+	var rate int
+	if *limitRate != "" {
+		if rate, err = loadgen.ParseSize(*limitRate); err != nil || rate == 0 {
+			return fmt.Errorf("%w: invalid rate limit: %q", errBadArguments, *limitRate)
+		}
+	}
+
+	poolOptions, err := output.poolOptions()
+	if err != nil {
+		return err
+	}
+
+	c, err := newHTTPClient(client)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errBadArguments, err.Error())
+	}
+
+	out, err := os.Create(*outFile)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := download(context.Background(), c, *url, out, downloadOptions{
+		chunkSize:  chunkSize,
+		maxThreads: uint32(*threads),
+		attempts:   *attempts,
+		rateLimit:  int64(rate),
+
+		poolOptions: poolOptions,
+	}); err != nil {
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func randomFile(size int) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(0xd0)).Read(data)
+	return data
+}
+
+func downloadTo(t *testing.T, url string, opts downloadOptions) ([]byte, error) {
+	out, err := os.Create(filepath.Join(t.TempDir(), "download"))
+	require.NoError(t, err)
+	defer out.Close()
+
+	if _, err := download(context.Background(), http.DefaultClient, url, out, opts); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(out.Name())
+}
+
+func TestDownloadRanges(t *testing.T) {
+	data := randomFile(100_000)
+	var ranges int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			atomic.AddInt32(&ranges, 1)
+		}
+		http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	got, err := downloadTo(t, srv.URL, downloadOptions{chunkSize: 7000, maxThreads: 4, attempts: 1})
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(data, got))
+	assert.EqualValues(t, 15, ranges)
+}
+
+func TestDownloadRangesConcurrently(t *testing.T) {
+	data := randomFile(8000)
+	var inFlight, peak int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			n := atomic.AddInt32(&inFlight, 1)
+			defer atomic.AddInt32(&inFlight, -1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	got, err := downloadTo(t, srv.URL, downloadOptions{chunkSize: 1000, maxThreads: 8, attempts: 1})
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(data, got))
+	// The number of CPUs doesn't limit IO workers.
+	assert.EqualValues(t, 8, atomic.LoadInt32(&peak))
+}
+
+func TestDownloadFallsBackToSequential(t *testing.T) {
+	data := randomFile(10_000)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("Range"))
+		w.Write(data)
+	}))
+	defer srv.Close()
+
+	got, err := downloadTo(t, srv.URL, downloadOptions{chunkSize: 1000, attempts: 1})
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(data, got))
+}
+
+func TestDownloadRetriesRanges(t *testing.T) {
+	data := randomFile(10_000)
+	var mu sync.Mutex
+	failed := make(map[string]bool)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Every range fails once.
+		if rng := r.Header.Get("Range"); rng != "" {
+			mu.Lock()
+			first := !failed[rng]
+			failed[rng] = true
+			mu.Unlock()
+			if first {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		}
+		http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	got, err := downloadTo(t, srv.URL, downloadOptions{chunkSize: 3000, maxThreads: 2, attempts: 2})
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(data, got))
+	assert.Len(t, failed, 4)
+}
+
+func TestDownloadRangeIgnored(t *testing.T) {
+	data := randomFile(10_000)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Claims to support ranges, but always sends the whole file.
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Header().Set("Content-Length", "10000")
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+	}))
+	defer srv.Close()
+
+	got, err := downloadTo(t, srv.URL, downloadOptions{chunkSize: 4000, attempts: 3})
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(data, got))
+}
+
+func TestDownloadRangeMismatch(t *testing.T) {
+	data := randomFile(10_000)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") == "" {
+			http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(data))
+			return
+		}
+		// Always the first bytes, whatever was requested.
+		w.Header().Set("Content-Range", "bytes 0-3999/10000")
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(data[:4000])
+	}))
+	defer srv.Close()
+
+	got, err := downloadTo(t, srv.URL, downloadOptions{chunkSize: 4000, maxThreads: 2, attempts: 3})
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(data, got))
+}
+
+func TestDownloadFileChangedAfterHead(t *testing.T) {
+	old, data := randomFile(10_000), randomFile(12_000)
+	var ifRange []string
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.Header().Set("ETag", `"v1"`)
+			http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(old))
+			return
+		}
+		if r.Header.Get("Range") != "" {
+			mu.Lock()
+			ifRange = append(ifRange, r.Header.Get("If-Range"))
+			mu.Unlock()
+		}
+		// The file was replaced, If-Range doesn't match, so ranges get the whole new file.
+		w.Header().Set("ETag", `"v2"`)
+		http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	got, err := downloadTo(t, srv.URL, downloadOptions{chunkSize: 4000, maxThreads: 2, attempts: 3})
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(data, got))
+	require.NotEmpty(t, ifRange)
+	for _, v := range ifRange {
+		assert.Equal(t, `"v1"`, v)
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	first, last, size, ok := parseContentRange("bytes 100-199/1000")
+	assert.True(t, ok)
+	assert.Equal(t, []int64{100, 199, 1000}, []int64{first, last, size})
+
+	_, _, size, ok = parseContentRange("bytes 0-9/*")
+	assert.True(t, ok)
+	assert.EqualValues(t, -1, size)
+
+	for _, value := range []string{"", "bytes */1000", "bytes 10-5/100", "items 0-9/10", "bytes 0-9"} {
+		_, _, _, ok := parseContentRange(value)
+		assert.False(t, ok, value)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	l := &rateLimiter{rate: 1000}
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		assert.NoError(t, l.wait(context.Background(), 100))
+	}
+	// The first 100 bytes are read right away, the sixth ones after the time of the first five.
+	assert.GreaterOrEqual(t, time.Since(start), 450*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, l.wait(ctx, 1000), context.Canceled)
+}
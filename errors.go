@@ -0,0 +1,48 @@
+package main
+
+import "errors"
+
+var (
+	// Returned by SubmitTask once Wait() was called on the pool and all the earlier submitted tasks completed.
+	// Until then submissions from any goroutine are accepted, so running tasks can submit more tasks.
+	ErrPoolClosed = errors.New("thread pool is closed, no more tasks could be submitted")
+
+	// Returned by SubmitTask when a nil task is passed.
+	ErrNilTask = errors.New("nil task was submitted")
+
+	// Returned by queue operations which require at least one element.
+	ErrQueueEmpty = errors.New("queue is empty")
+
+	// Returned by Push when the queue reached its maximum capacity.
+	ErrQueueFull = errors.New("queue is full")
+
+	// Returned by queue operations when the index doesn't refer to an element in the queue.
+	ErrIndexOutOfRange = errors.New("index out of range")
+
+	// Returned by SubmitGroup while the circuit breaker of the group is open.
+	ErrCircuitOpen = errors.New("circuit breaker is open")
+
+	// Returned by ReadSchedule when the data wasn't written by Recorder.WriteTo or is truncated.
+	ErrInvalidSchedule = errors.New("invalid task schedule")
+
+	// Returned by writes to a TempFile once the TempSpace it belongs to reached its limit.
+	ErrTempSpaceFull = errors.New("temporary space limit reached")
+
+	// Returned by the merkle and diff subcommands if an input file was modified while it was being processed.
+	ErrFileChanged = errors.New("file changed during the run")
+
+	// Returned by Graph.Run when dependencies between nodes form a cycle.
+	ErrGraphCycle = errors.New("graph contains a cycle")
+
+	// Returned for graph nodes which were not executed because one of their dependencies failed.
+	ErrDependencyFailed = errors.New("dependency failed")
+
+	// Returned by ParseCron for malformed cron expressions.
+	ErrInvalidCron = errors.New("invalid cron expression")
+
+	// Returned by Scheduler.Add when a job with the same name is already registered.
+	ErrDuplicateJob = errors.New("job is already registered")
+
+	// Returned by Scheduler.Add once the scheduler was stopped.
+	ErrSchedulerStopped = errors.New("scheduler is stopped")
+)
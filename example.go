@@ -1,57 +1,22 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"golang.org/x/net/html"
+	"io"
 	"net/http"
+	neturl "net/url"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
-)
-
-// A bare minimum stack implementation used for traversing html nodes iteratively.
-type Stack[T any] struct {
-	count int
-	data  []T
-}
-
-// Push element of type T into the stack
-func (s *Stack[T]) Push(v T) {
-	if s.count == cap(s.data) {
-		newCap := max(cap(s.data)<<1, 64)
-		if cap(s.data) == 0 {
-			s.data = make([]T, newCap)
-		} else {
-			newData := make([]T, newCap)
-			copy(newData, s.data[:s.count])
-			s.data = newData
-		}
-	}
-	s.data[s.count] = v
-	s.count++
-}
 
-// Check if the stack is empty
-func (s *Stack[T]) Empty() bool {
-	return s.count == 0
-}
-
-// Retrieve stack size
-func (s *Stack[T]) Size() int {
-	return s.count
-}
-
-// If stack is not empty, pops the last element and assignes it to v, returns true.
-// false otherwise.
-func (s *Stack[T]) TryPop(v *T) bool {
-	if s.count != 0 {
-		*v = s.data[s.count-1]
-		var zeroElement T
-		s.data[s.count-1] = zeroElement
-		s.count--
-		return true
-	}
-	return false
-}
+	"github.com/isnastish/workers_prototype/pkg/container"
+)
 
 // Accumulate all the URL's from the current HTML node.
 func getURLs(n *html.Node, response *http.Response) []string {
@@ -71,7 +36,7 @@ func getURLs(n *html.Node, response *http.Response) []string {
 
 // Traverses html nodes iteratively
 func traverseHtmlParseTree(n *html.Node, response *http.Response) []string {
-	nodeStack := Stack[*html.Node]{}
+	nodeStack := container.Stack[*html.Node]{}
 	nodeStack.Push(n)
 
 	urls := []string{}
@@ -95,8 +60,112 @@ type UrlInfo struct {
 	depth int
 }
 
-// Core function to traverse all URL's in breadth first search manner and print them to stdout.
-func traverseURL_BFS_Concurrent(url string, depth int) {
+// Process exit codes.
+const (
+	exitSuccess        = 0
+	exitFilesDiffer    = 1 // the diff subcommand found differences
+	exitPartialFailure = 2 // some of the URLs couldn't be fetched
+	exitBadArguments   = 3
+	exitIOError        = 4 // the root URL couldn't be fetched
+	exitRegression     = 5 // bench-compare found a performance regression
+	exitInterrupted    = 130
+)
+
+// Wrapped by subcommands for errors caused by invalid command line arguments.
+var errBadArguments = errors.New("bad arguments")
+
+// Returned by the diff subcommand if the files differ.
+var errFilesDiffer = errors.New("files differ")
+
+// Subcommands of the binary, the crawler runs if none of them is given.
+var subcommands = map[string]func(args []string) error{
+	"loadtest": runLoadTest,
+	"sort":     runSort,
+	"diff": func(args []string) error {
+		differ, err := runDiff(args)
+		if err == nil && differ {
+			return errFilesDiffer
+		}
+		return err
+	},
+	"compare":       runCompare,
+	"bench-compare": func(args []string) error { return runBenchCompare(args, os.Stdout) },
+	"download":      runDownload,
+	"agent":         runAgent,
+	"archive":       runArchive,
+	"merkle":        runMerkle,
+}
+
+// Maps an error returned by a subcommand to the exit code of the process.
+func subcommandExitCode(err error) int {
+	switch {
+	case errors.Is(err, errBadArguments):
+		return exitBadArguments
+	case errors.Is(err, errFilesDiffer):
+		return exitFilesDiffer
+	case errors.Is(err, errRegression):
+		return exitRegression
+	}
+	return exitIOError
+}
+
+// Summary of a crawl, printed once it completes.
+type CrawlSummary struct {
+	root    string
+	visited uint32
+	retried uint32            // pages which needed more than one attempt
+	failed  map[string]string // URL -> reason
+	graph   *LinkGraph
+	mu      sync.Mutex
+}
+
+func (s *CrawlSummary) visit() {
+	atomic.AddUint32(&s.visited, 1)
+}
+
+func (s *CrawlSummary) fail(url string, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failed[url] = reason
+}
+
+func (s *CrawlSummary) Print(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fmt.Fprintf(w, "\nSummary:\n")
+	fmt.Fprintf(w, "  visited: %d\n", atomic.LoadUint32(&s.visited))
+	fmt.Fprintf(w, "  retried: %d\n", atomic.LoadUint32(&s.retried))
+	fmt.Fprintf(w, "  failed:  %d\n", len(s.failed))
+
+	failed := make([]string, 0, len(s.failed))
+	for url := range s.failed {
+		failed = append(failed, url)
+	}
+	sort.Strings(failed)
+	for _, url := range failed {
+		fmt.Fprintf(w, "    %s: %s\n", url, s.failed[url])
+	}
+}
+
+func (s *CrawlSummary) ExitCode() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, failed := s.failed[s.root]; failed {
+		return exitIOError
+	}
+	if len(s.failed) != 0 {
+		return exitPartialFailure
+	}
+	return exitSuccess
+}
+
+// Core function to traverse all URL's in breadth first search manner and print them to out.
+// Pages which failed with a timeout, 429 or 5xx status are fetched up to maxAttempts times.
+func traverseURL_BFS_Concurrent(client *http.Client, url string, depth, maxAttempts int, out io.Writer, options ...Option) *CrawlSummary {
+	summary := &CrawlSummary{root: url, failed: make(map[string]string), graph: NewLinkGraph()}
+
 	urls := make(chan UrlInfo)
 	go func() { urls <- UrlInfo{url, 0} }()
 
@@ -105,11 +174,11 @@ func traverseURL_BFS_Concurrent(url string, depth int) {
 
 	go func() {
 		for url := range allUrls {
-			fmt.Printf("url: %s\n", url)
+			fmt.Fprintf(out, "url: %s\n", url)
 		}
 	}()
 
-	p := NewPool()
+	p := NewPoolWithOptions(0, options...)
 
 Loop:
 	for {
@@ -117,49 +186,176 @@ Loop:
 		case info := <-urls:
 			z := info
 			if z.depth < depth {
-				p.SubmitTask(func() {
-					response, err := http.Get(z.url)
+				p.SubmitRetry(context.Background(), RetryPolicy{
+					MaxAttempts: maxAttempts,
+					Backoff:     500 * time.Millisecond,
+					MaxBackoff:  30 * time.Second,
+					OnDone: func(err error, attempts int) {
+						summary.graph.attempted(z.url, z.depth, attempts)
+						if attempts > 1 {
+							atomic.AddUint32(&summary.retried, 1)
+						}
+						if err != nil {
+							summary.fail(z.url, err.Error())
+						}
+					},
+				}, func(ctx context.Context) error {
+					start := time.Now()
+					response, err := client.Get(z.url)
+					latency := time.Since(start)
 					if err != nil {
-						return
+						summary.graph.fetched(z.url, z.depth, 0, "", latency, err)
+						return transientFetchError(err)
 					}
+					summary.graph.fetched(z.url, z.depth, response.StatusCode, response.Header.Get("Content-Type"), latency, nil)
 
 					if response.StatusCode != http.StatusOK {
 						response.Body.Close()
-						return
+						return statusError(response, time.Now())
 					}
 
 					root, err := html.Parse(response.Body)
 					if err != nil {
 						response.Body.Close()
-						return
+						return Permanent(err)
 					}
 
 					response.Body.Close()
-					for _, url := range traverseHtmlParseTree(root, response) {
+					summary.visit()
+					links := traverseHtmlParseTree(root, response)
+					summary.graph.linked(z.url, z.depth, links)
+					for _, url := range links {
 						urls <- UrlInfo{url, z.depth + 1}
 						allUrls <- url
 					}
+					return nil
 				})
 			}
 		case <-time.After(1000 * time.Millisecond):
-			break Loop
+			// Retries of failed pages may be scheduled far in the future.
+			if p.idle() {
+				break Loop
+			}
 		}
 	}
 	p.Wait()
+
+	return summary
+}
+
+func writeLinkGraph(g *LinkGraph, path, format string) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if format == "dot" {
+		err = g.WriteDOT(out)
+	} else {
+		err = g.WriteJSON(out)
+	}
+	if err != nil {
+		return err
+	}
+	return out.Close()
 }
 
 type Options struct {
-	depth int
-	url   string
+	depth       int
+	url         string
+	graph       string // file the link graph is written to
+	graphFormat string
+	client      ClientOptions
+	attempts    int
+	output      outputFlags
+}
+
+func (o *Options) validate() error {
+	if o.depth < 0 {
+		return fmt.Errorf("invalid depth: %d", o.depth)
+	}
+	u, err := neturl.Parse(o.url)
+	if err != nil {
+		return fmt.Errorf("invalid url: %s", err.Error())
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid url %q: only http and https are supported", o.url)
+	}
+	if o.attempts < 1 {
+		return fmt.Errorf("invalid number of attempts: %d", o.attempts)
+	}
+	if o.graphFormat != "json" && o.graphFormat != "dot" {
+		return fmt.Errorf("invalid graph format %q: only json and dot are supported", o.graphFormat)
+	}
+	return nil
 }
 
 func main() {
+	// Deferred cleanups don't run when the process is killed by a signal, so temporary files are removed by the handler.
+	removeTempSpacesOnInterrupt(exitInterrupted)
+
+	if len(os.Args) > 1 {
+		if run, exists := subcommands[os.Args[1]]; exists {
+			if err := run(os.Args[2:]); err != nil {
+				// Differences are reported by the diff itself.
+				if !errors.Is(err, errFilesDiffer) {
+					fmt.Fprintf(os.Stderr, "%s: %s\n", os.Args[1], err.Error())
+				}
+				os.Exit(subcommandExitCode(err))
+			}
+			return
+		}
+	}
+
 	o := Options{}
 
-	flag.IntVar(&o.depth, "depth", 2, "Depth level for traversing URLs")
-	flag.StringVar(&o.url, "url", "https://python.org", "URL to travers")
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.IntVar(&o.depth, "depth", 2, "Depth level for traversing URLs")
+	fs.StringVar(&o.url, "url", "https://python.org", "URL to travers")
+	fs.StringVar(&o.graph, "graph", "", "Write the graph of links between the crawled pages to this file")
+	fs.StringVar(&o.graphFormat, "graph-format", "json", "Format of the link graph, json or dot")
+
+	o.client.Headers = make(http.Header)
+	fs.DurationVar(&o.client.Timeout, "timeout", 30*time.Second, "Timeout of a single request, 0 means no timeout")
+	fs.IntVar(&o.client.MaxConnsPerHost, "max-conns-per-host", 16, "Maximum number of connections to a single host, 0 means no limit")
+	fs.StringVar(&o.client.Proxy, "proxy", "", "Proxy URL, taken from the environment by default")
+	fs.StringVar(&o.client.UserAgent, "user-agent", "", "User-Agent header of the requests")
+	fs.Var(headerFlag(o.client.Headers), "header", "Header sent with every request, \"Name: value\", may be repeated")
+	fs.BoolVar(&o.client.InsecureSkipVerify, "insecure", false, "Don't verify TLS certificates")
+	fs.IntVar(&o.attempts, "attempts", 3, "Maximum number of attempts to fetch a page failing with a timeout, 429 or 5xx status")
+	o.output = addOutputFlags(fs)
+
+	if err := fs.Parse(os.Args[1:]); err != nil {
+		os.Exit(exitBadArguments)
+	}
+
+	if err := o.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		os.Exit(exitBadArguments)
+	}
 
-	flag.Parse()
+	client, err := newHTTPClient(o.client)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		os.Exit(exitBadArguments)
+	}
+
+	poolOptions, err := o.output.poolOptions()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		os.Exit(exitBadArguments)
+	}
+
+	summary := traverseURL_BFS_Concurrent(client, o.url, o.depth, o.attempts, o.output.stdout(), poolOptions...)
+	summary.Print(o.output.stdout())
+
+	if o.graph != "" {
+		if err := writeLinkGraph(summary.graph, o.graph, o.graphFormat); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write the link graph: %s\n", err.Error())
+			os.Exit(exitIOError)
+		}
+	}
 
-	traverseURL_BFS_Concurrent(o.url, o.depth)
+	os.Exit(summary.ExitCode())
 }
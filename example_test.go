@@ -0,0 +1,29 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubcommandExitCode(t *testing.T) {
+	assert.Equal(t, exitBadArguments, subcommandExitCode(fmt.Errorf("%w: -in is required", errBadArguments)))
+	assert.Equal(t, exitRegression, subcommandExitCode(fmt.Errorf("BenchmarkSort: %w", errRegression)))
+	assert.Equal(t, exitIOError, subcommandExitCode(errors.New("open input: no such file or directory")))
+
+	// Invalid arguments of every subcommand map to the same exit code.
+	for name, run := range subcommands {
+		assert.Equal(t, exitBadArguments, subcommandExitCode(run([]string{"-no-such-flag"})), name)
+	}
+	assert.ErrorIs(t, runLoadTest([]string{"-tasks", "-1"}), errBadArguments)
+
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	assert.NoError(t, os.WriteFile(a, []byte("a"), 0o600))
+	assert.NoError(t, os.WriteFile(b, []byte("b"), 0o600))
+	assert.Equal(t, exitFilesDiffer, subcommandExitCode(subcommands["diff"]([]string{a, b})))
+}
@@ -0,0 +1,145 @@
+package main
+
+import "sync"
+
+// Internal queue serving submitters round-robin, each submitter's tasks stay in the order of submission.
+type fairQueue struct {
+	queues map[string][]queuedTask
+	// Submitters with queued tasks in the order they are served.
+	order []string
+	next  int
+	size  int
+	mu    sync.Mutex
+}
+
+func newFairQueue() *fairQueue {
+	return &fairQueue{queues: make(map[string][]queuedTask)}
+}
+
+func (q *fairQueue) Push(task queuedTask) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	tasks, exists := q.queues[task.submitter]
+	if !exists {
+		q.order = append(q.order, task.submitter)
+	}
+	q.queues[task.submitter] = append(tasks, task)
+	q.size++
+	return nil
+}
+
+func (q *fairQueue) TryPop(task *queuedTask) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.size == 0 {
+		return false
+	}
+
+	submitter := q.order[q.next]
+	tasks := q.queues[submitter]
+	*task = tasks[0]
+	q.size--
+
+	if len(tasks) == 1 {
+		// The next submitter moves into this position.
+		delete(q.queues, submitter)
+		q.order = append(q.order[:q.next], q.order[q.next+1:]...)
+	} else {
+		tasks[0] = queuedTask{}
+		q.queues[submitter] = tasks[1:]
+		q.next++
+	}
+	if q.next >= len(q.order) {
+		q.next = 0
+	}
+	return true
+}
+
+func (q *fairQueue) Empty() bool {
+	return q.Size() == 0
+}
+
+func (q *fairQueue) Size() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.size
+}
+
+// WithFairness makes the pool run tasks of different submitters (see SubmitFrom) round-robin,
+// so a submitter with a large backlog can't starve the others. Tasks submitted without a submitter
+// are served as if they came from one more submitter. Has no effect with LIFO scheduling,
+// and queue statistics (see WithQueueStats) are not recorded.
+func WithFairness() Option {
+	return func(p *ThreadPool) {
+		p.fair = true
+	}
+}
+
+type SubmitterStats struct {
+	Queued     int    // tasks submitted but not yet handed to a worker
+	Dispatched uint64 // tasks handed to a worker
+}
+
+type submitterCounters struct {
+	stats map[string]*SubmitterStats
+	mu    sync.Mutex
+}
+
+// SubmitFrom submits a task on behalf of a submitter, which identifies the producer
+// for fair scheduling (see WithFairness) and in SubmitterStats.
+func (p *ThreadPool) SubmitFrom(submitter string, task func()) error {
+	return p.submit(queuedTask{fn: task, attempt: 1, submitter: submitter})
+}
+
+// SubmitterStats returns the number of queued and dispatched tasks of every submitter which submitted a task with SubmitFrom.
+func (p *ThreadPool) SubmitterStats() map[string]SubmitterStats {
+	c := &p.submitters
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := make(map[string]SubmitterStats, len(c.stats))
+	for submitter, s := range c.stats {
+		stats[submitter] = *s
+	}
+	return stats
+}
+
+// Accounts for a task of a submitter entering the pool's queues.
+func (p *ThreadPool) submitterQueued(task queuedTask) {
+	if task.submitter == "" {
+		return
+	}
+
+	c := &p.submitters
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stats == nil {
+		c.stats = make(map[string]*SubmitterStats)
+	}
+	s, exists := c.stats[task.submitter]
+	if !exists {
+		s = &SubmitterStats{}
+		c.stats[task.submitter] = s
+	}
+	s.Queued++
+}
+
+// Accounts for a task of a submitter leaving the pool's queues, either handed to a worker or not.
+func (p *ThreadPool) submitterDequeued(task queuedTask, dispatched bool) {
+	if task.submitter == "" {
+		return
+	}
+
+	c := &p.submitters
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := c.stats[task.submitter]
+	s.Queued--
+	if dispatched {
+		s.Dispatched++
+	}
+}
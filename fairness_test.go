@@ -0,0 +1,73 @@
+package main
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFairQueueRoundRobin(t *testing.T) {
+	q := newFairQueue()
+	for _, submitter := range []string{"a", "a", "a", "b", "c", "c"} {
+		q.Push(queuedTask{submitter: submitter})
+	}
+	assert.Equal(t, 6, q.Size())
+
+	var order []string
+	var task queuedTask
+	for q.TryPop(&task) {
+		order = append(order, task.submitter)
+	}
+	assert.Equal(t, []string{"a", "b", "c", "a", "c", "a"}, order)
+	assert.True(t, q.Empty())
+}
+
+func TestFairnessBetweenSubmitters(t *testing.T) {
+	p := newTestPool(t, 1, WithFairness())
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	p.SubmitTask(func() {
+		close(started)
+		<-release
+	})
+	<-started
+
+	var order []string
+	var mu sync.Mutex
+	submit := func(submitter string, n int) {
+		for i := 0; i < n; i++ {
+			p.SubmitFrom(submitter, func() {
+				mu.Lock()
+				order = append(order, submitter)
+				mu.Unlock()
+			})
+		}
+	}
+	// The aggressive producer submits everything first.
+	submit("bulk", 100)
+	submit("interactive", 10)
+
+	stats := p.SubmitterStats()
+	assert.Equal(t, SubmitterStats{Queued: 100}, stats["bulk"])
+	assert.Equal(t, SubmitterStats{Queued: 10}, stats["interactive"])
+
+	close(release)
+	p.Wait()
+
+	// Tasks of the bulk producer which the dispatcher had already handed over may run first,
+	// the rest alternate with the interactive ones.
+	var last int
+	for i, submitter := range order {
+		if submitter == "interactive" {
+			last = i
+		}
+	}
+	assert.Less(t, last, 25)
+
+	stats = p.SubmitterStats()
+	assert.Equal(t, SubmitterStats{Dispatched: 100}, stats["bulk"])
+	assert.Equal(t, SubmitterStats{Dispatched: 10}, stats["interactive"])
+	assertAllTasksDone(t, p, 111)
+}
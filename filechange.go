@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// What a subcommand does when its input file was modified by another process while it was being processed.
+type changePolicy int
+
+const (
+	changeAbort changePolicy = iota // fail, the results may mix the old and the new contents
+	changeWarn                      // print a warning and keep the results
+)
+
+var changePolicies = map[string]changePolicy{
+	"abort": changeAbort,
+	"warn":  changeWarn,
+}
+
+func addOnChangeFlag(fs *flag.FlagSet) *string {
+	return fs.String("on-change", "abort", "What to do if an input file is modified during the run, abort or warn")
+}
+
+func parseChangePolicy(name string) (changePolicy, error) {
+	policy, exists := changePolicies[name]
+	if !exists {
+		return 0, fmt.Errorf("%w: unknown -on-change policy: %q", errBadArguments, name)
+	}
+	return policy, nil
+}
+
+// Size and modification time of a file, taken before a run and compared with the ones after it.
+type fileVersion struct {
+	size    int64
+	modTime time.Time
+}
+
+func versionOf(info os.FileInfo) fileVersion {
+	return fileVersion{size: info.Size(), modTime: info.ModTime()}
+}
+
+// Times are compared with Equal, == would also compare their locations and monotonic clock readings.
+func (v fileVersion) equal(other fileVersion) bool {
+	return v.size == other.size && v.modTime.Equal(other.modTime)
+}
+
+// Fails with ErrFileChanged, or only warns depending on the policy, if f no longer has the version it had before the run.
+func checkUnchanged(f *os.File, before fileVersion, policy changePolicy, warn io.Writer) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	after := versionOf(info)
+	if after.equal(before) {
+		return nil
+	}
+
+	err = fmt.Errorf("%w: %s: size %d -> %d, modified at %s", ErrFileChanged, f.Name(), before.size, after.size,
+		after.modTime.Format(time.RFC3339Nano))
+	if policy == changeWarn {
+		fmt.Fprintf(warn, "warning: %s\n", err.Error())
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckUnchanged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "input")
+	require.NoError(t, os.WriteFile(path, []byte("0123456789"), 0o644))
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	info, err := f.Stat()
+	require.NoError(t, err)
+	before := versionOf(info)
+
+	var warnings bytes.Buffer
+	assert.NoError(t, checkUnchanged(f, before, changeAbort, &warnings))
+
+	require.NoError(t, os.WriteFile(path, []byte("01234"), 0o644))
+	assert.ErrorIs(t, checkUnchanged(f, before, changeAbort, &warnings), ErrFileChanged)
+	assert.Empty(t, warnings.String())
+
+	assert.NoError(t, checkUnchanged(f, before, changeWarn, &warnings))
+	assert.Contains(t, warnings.String(), "size 10 -> 5")
+
+	// Rewriting the file with contents of the same size is detected by the modification time.
+	info, err = f.Stat()
+	require.NoError(t, err)
+	before = versionOf(info)
+	require.NoError(t, os.Chtimes(path, time.Now(), info.ModTime().Add(time.Second)))
+	assert.ErrorIs(t, checkUnchanged(f, before, changeAbort, &warnings), ErrFileChanged)
+
+	// The same instant in another location is the same version.
+	info, err = f.Stat()
+	require.NoError(t, err)
+	before = versionOf(info)
+	before.modTime = before.modTime.In(time.FixedZone("UTC+5", 5*60*60))
+	assert.NoError(t, checkUnchanged(f, before, changeAbort, &warnings))
+}
+
+func TestParseChangePolicy(t *testing.T) {
+	policy, err := parseChangePolicy("warn")
+	assert.NoError(t, err)
+	assert.Equal(t, changeWarn, policy)
+
+	_, err = parseChangePolicy("adapt")
+	assert.ErrorIs(t, err, errBadArguments)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+// A file of an fs.FS supporting random access, like *os.File and the files of embed.FS and fstest.MapFS.
+// Chunks of a file are read by the workers in parallel, so they need ReadAt, see OpenReaderAt.
+type ReaderAtFile interface {
+	fs.File
+	io.ReaderAt
+}
+
+// OpenReaderAt opens the named file of fsys for reading its chunks in parallel and returns its size.
+// Files without ReadAt, like members of zip archives, are read into memory.
+func OpenReaderAt(fsys fs.FS, name string) (ReaderAtFile, int64, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	if info.IsDir() {
+		f.Close()
+		return nil, 0, &fs.PathError{Op: "open", Path: name, Err: fmt.Errorf("is a directory")}
+	}
+
+	if rf, ok := f.(ReaderAtFile); ok {
+		return rf, info.Size(), nil
+	}
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return &memoryFile{File: f, r: bytes.NewReader(data)}, int64(len(data)), nil
+}
+
+// Contents of a file without ReadAt, read into memory. Stat and Close are passed to the file.
+type memoryFile struct {
+	fs.File
+	r *bytes.Reader
+}
+
+func (f *memoryFile) Read(p []byte) (int, error)              { return f.r.Read(p) }
+func (f *memoryFile) ReadAt(p []byte, off int64) (int, error) { return f.r.ReadAt(p, off) }
+
+// MerkleTreeFS builds a Merkle tree over chunks of chunkSize bytes of the named file of fsys on a pool created
+// with the options, like the merkle subcommand. hash is one of sha1, sha256 or sha512.
+func MerkleTreeFS(fsys fs.FS, name string, chunkSize int, hash string, options ...Option) (*MerkleTree, error) {
+	if chunkSize <= 0 {
+		return nil, fmt.Errorf("%w: invalid chunk size: %d", errBadArguments, chunkSize)
+	}
+
+	f, size, err := OpenReaderAt(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tree, err := buildMerkleTree(f, size, merkleOptions{chunkSize: chunkSize, hash: hash, poolOptions: options})
+	if err != nil {
+		return nil, err
+	}
+
+	if info, err := f.Stat(); err == nil {
+		tree.ModTime = info.ModTime()
+	}
+	return tree, nil
+}
+
+// DiffFS compares the named files of fsys in chunks of chunkSize bytes on a pool created with the options,
+// like the diff subcommand.
+func DiffFS(fsys fs.FS, nameA, nameB string, chunkSize int, options ...Option) (*DiffResult, error) {
+	if chunkSize <= 0 {
+		return nil, fmt.Errorf("%w: invalid chunk size: %d", errBadArguments, chunkSize)
+	}
+
+	a, sizeA, err := OpenReaderAt(fsys, nameA)
+	if err != nil {
+		return nil, err
+	}
+	defer a.Close()
+
+	b, sizeB, err := OpenReaderAt(fsys, nameB)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Close()
+
+	return diffFiles(a, b, sizeA, sizeB, diffOptions{chunkSize: chunkSize, poolOptions: options})
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/fs"
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestOpenReaderAt(t *testing.T) {
+	data := make([]byte, 1000)
+	rand.New(rand.NewSource(0xf5)).Read(data)
+
+	mapFS := fstest.MapFS{"data/blob": {Data: data}}
+
+	// Members of a zip archive can't be read at an offset.
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	w, err := zw.Create("data/blob")
+	assert.NoError(t, err)
+	w.Write(data)
+	assert.NoError(t, zw.Close())
+	zipFS, err := zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	assert.NoError(t, err)
+
+	for _, fsys := range []fs.FS{mapFS, zipFS} {
+		f, size, err := OpenReaderAt(fsys, "data/blob")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len(data)), size)
+
+		chunk := make([]byte, 100)
+		_, err = f.ReadAt(chunk, 300)
+		assert.NoError(t, err)
+		assert.Equal(t, data[300:400], chunk)
+
+		info, err := f.Stat()
+		assert.NoError(t, err)
+		assert.Equal(t, "blob", info.Name())
+		assert.NoError(t, f.Close())
+
+		_, _, err = OpenReaderAt(fsys, "data/missing")
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+		_, _, err = OpenReaderAt(fsys, "data")
+		assert.Error(t, err)
+	}
+}
+
+func TestMerkleTreeAndDiffFS(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	a := make([]byte, 1000)
+	rand.New(rand.NewSource(0xd1f)).Read(a)
+	b := append([]byte(nil), a...)
+	b[512] ^= 1
+
+	fsys := fstest.MapFS{"a": {Data: a}, "b": {Data: b}}
+
+	tree, err := MerkleTreeFS(fsys, "a", 100, "sha256", WithCPUWorkers(2))
+	assert.NoError(t, err)
+	want, err := buildMerkleTree(bytes.NewReader(a), int64(len(a)), merkleOptions{chunkSize: 100, hash: "sha256"})
+	assert.NoError(t, err)
+	assert.Equal(t, want, tree)
+
+	_, err = MerkleTreeFS(fsys, "a", 0, "sha256")
+	assert.ErrorIs(t, err, errBadArguments)
+
+	res, err := DiffFS(fsys, "a", "b", 100, WithCPUWorkers(2))
+	assert.NoError(t, err)
+	assert.Equal(t, []ByteRange{{512, 513}}, res.Ranges)
+
+	_, err = DiffFS(fsys, "a", "c", 100)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestParallelWalkFS(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	fsys := fstest.MapFS{
+		"src/main.go":           {},
+		"src/pool/pool.go":      {},
+		"src/pool/pool_test.go": {},
+		"src/vendor/x/x.go":     {},
+		"README.md":             {},
+	}
+
+	var paths []string
+	var mu sync.Mutex
+	err := ParallelWalkFS(fsys, "src", func(path string, d fs.DirEntry) error {
+		if d.Name() == "vendor" {
+			return fs.SkipDir
+		}
+		mu.Lock()
+		paths = append(paths, path)
+		mu.Unlock()
+		return nil
+	}, WithCPUWorkers(2))
+	assert.NoError(t, err)
+
+	sort.Strings(paths)
+	assert.Equal(t, []string{"src", "src/main.go", "src/pool", "src/pool/pool.go", "src/pool/pool_test.go"}, paths)
+
+	err = ParallelWalkFS(fsys, "docs", func(path string, d fs.DirEntry) error { return nil })
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
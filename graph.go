@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// NodeFunc receives results of the node's direct dependencies keyed by their names.
+type NodeFunc func(deps map[string]any) (any, error)
+
+type Node struct {
+	name  string
+	fn    NodeFunc
+	after []string
+
+	// Populated during Graph.Run.
+	result     any
+	err        error
+	dependents []*Node
+	pending    int
+}
+
+// Graph is a set of tasks with dependencies between them, executed on a thread pool
+// so that each node runs as soon as all nodes it depends on have completed.
+type Graph struct {
+	nodes map[string]*Node
+	order []string
+	mu    sync.Mutex
+}
+
+func NewGraph() *Graph {
+	return &Graph{nodes: make(map[string]*Node)}
+}
+
+// Adds a node to the graph, a node with the same name is replaced.
+func (g *Graph) Node(name string, fn NodeFunc) *Node {
+	if _, exists := g.nodes[name]; !exists {
+		g.order = append(g.order, name)
+	}
+	n := &Node{name: name, fn: fn}
+	g.nodes[name] = n
+	return n
+}
+
+// Declares that the node can only run after the named nodes completed successfully.
+func (n *Node) After(names ...string) *Node {
+	n.after = append(n.after, names...)
+	return n
+}
+
+// Returns the result of the node after Graph.Run completed.
+func (g *Graph) Result(name string) (any, error) {
+	n, exists := g.nodes[name]
+	if !exists {
+		return nil, fmt.Errorf("unknown node %q", name)
+	}
+	return n.result, n.err
+}
+
+// Run executes all the nodes on the pool and blocks until every node completed or was skipped.
+// The pool is left open, so Run should complete before the pool's Wait() is called.
+// The returned error joins errors of all the failed nodes.
+func (g *Graph) Run(p *ThreadPool) error {
+	if err := g.prepare(); err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(len(g.nodes))
+
+	var run func(n *Node)
+	run = func(n *Node) {
+		task := func() {
+			deps := make(map[string]any, len(n.after))
+			var depErr error
+			for _, name := range n.after {
+				dep := g.nodes[name]
+				if dep.err != nil {
+					depErr = fmt.Errorf("node %q: %w: %q", n.name, ErrDependencyFailed, name)
+					break
+				}
+				deps[name] = dep.result
+			}
+
+			if depErr != nil {
+				n.err = depErr
+			} else {
+				n.result, n.err = n.fn(deps)
+			}
+
+			g.mu.Lock()
+			var ready []*Node
+			for _, d := range n.dependents {
+				d.pending--
+				if d.pending == 0 {
+					ready = append(ready, d)
+				}
+			}
+			g.mu.Unlock()
+
+			for _, d := range ready {
+				run(d)
+			}
+			wg.Done()
+		}
+
+		if err := p.SubmitTask(task); err != nil {
+			// The pool is closed, run the node in the current goroutine so Run doesn't hang.
+			task()
+		}
+	}
+
+	var roots []*Node
+	for _, name := range g.order {
+		if n := g.nodes[name]; n.pending == 0 {
+			roots = append(roots, n)
+		}
+	}
+	for _, n := range roots {
+		run(n)
+	}
+
+	wg.Wait()
+
+	var errs []error
+	for _, name := range g.order {
+		if err := g.nodes[name].err; err != nil && !errors.Is(err, ErrDependencyFailed) {
+			errs = append(errs, fmt.Errorf("node %q: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Resolves dependencies, resets results of the previous run and checks the graph for cycles.
+func (g *Graph) prepare() error {
+	for _, name := range g.order {
+		n := g.nodes[name]
+		n.result, n.err = nil, nil
+		n.dependents = nil
+		n.pending = len(n.after)
+	}
+
+	for _, name := range g.order {
+		n := g.nodes[name]
+		for _, depName := range n.after {
+			dep, exists := g.nodes[depName]
+			if !exists {
+				return fmt.Errorf("node %q depends on unknown node %q", name, depName)
+			}
+			dep.dependents = append(dep.dependents, n)
+		}
+	}
+
+	// Kahn's algorithm, nodes which are never reached belong to a cycle.
+	pending := make(map[string]int, len(g.nodes))
+	var ready []*Node
+	for _, name := range g.order {
+		n := g.nodes[name]
+		pending[name] = n.pending
+		if n.pending == 0 {
+			ready = append(ready, n)
+		}
+	}
+
+	visited := 0
+	for len(ready) > 0 {
+		n := ready[len(ready)-1]
+		ready = ready[:len(ready)-1]
+		visited++
+		for _, d := range n.dependents {
+			pending[d.name]--
+			if pending[d.name] == 0 {
+				ready = append(ready, d)
+			}
+		}
+	}
+
+	if visited != len(g.nodes) {
+		var cycle []string
+		for name, count := range pending {
+			if count > 0 {
+				cycle = append(cycle, name)
+			}
+		}
+		sort.Strings(cycle)
+		return fmt.Errorf("%w: %v", ErrGraphCycle, cycle)
+	}
+
+	return nil
+}
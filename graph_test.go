@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestGraph_Diamond(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	p := NewPool(4)
+	g := NewGraph()
+
+	g.Node("read", func(map[string]any) (any, error) {
+		return "Red lazy fox", nil
+	})
+	g.Node("upper", func(deps map[string]any) (any, error) {
+		return strings.ToUpper(deps["read"].(string)), nil
+	}).After("read")
+	g.Node("count", func(deps map[string]any) (any, error) {
+		return len(strings.Fields(deps["read"].(string))), nil
+	}).After("read")
+	g.Node("merge", func(deps map[string]any) (any, error) {
+		return []any{deps["upper"], deps["count"]}, nil
+	}).After("upper", "count")
+
+	assert.NoError(t, g.Run(p))
+	p.Wait()
+
+	res, err := g.Result("merge")
+	assert.NoError(t, err)
+	assert.Equal(t, []any{"RED LAZY FOX", 3}, res)
+}
+
+func TestGraph_CycleDetection(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	p := NewPool(2)
+	defer p.Wait()
+
+	noop := func(map[string]any) (any, error) { return nil, nil }
+
+	g := NewGraph()
+	g.Node("a", noop)
+	g.Node("b", noop).After("a", "d")
+	g.Node("c", noop).After("b")
+	g.Node("d", noop).After("c")
+
+	err := g.Run(p)
+	assert.ErrorIs(t, err, ErrGraphCycle)
+	assert.Contains(t, err.Error(), "[b c d]")
+
+	g = NewGraph()
+	g.Node("a", noop).After("missing")
+	assert.Error(t, g.Run(p))
+}
+
+func TestGraph_FailedNodeSkipsDependents(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	var executed uint32
+	errRead := errors.New("read failed")
+
+	p := NewPool(2)
+	g := NewGraph()
+	g.Node("read", func(map[string]any) (any, error) { return nil, errRead })
+	g.Node("other", func(map[string]any) (any, error) {
+		atomic.AddUint32(&executed, 1)
+		return nil, nil
+	})
+	g.Node("hash", func(map[string]any) (any, error) {
+		atomic.AddUint32(&executed, 1)
+		return nil, nil
+	}).After("read", "other")
+
+	err := g.Run(p)
+	p.Wait()
+
+	assert.ErrorIs(t, err, errRead)
+	assert.EqualValues(t, 1, atomic.LoadUint32(&executed))
+
+	_, err = g.Result("hash")
+	assert.ErrorIs(t, err, ErrDependencyFailed)
+}
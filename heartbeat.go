@@ -0,0 +1,98 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Snapshot of a worker's heartbeat, see ThreadPool.Workers.
+type WorkerStatus struct {
+	ID uint32
+	// The worker runs IO-bound tasks, see WithIOWorkers. IDs of IO workers are counted separately.
+	IO bool
+
+	TasksCompleted uint64
+	// Zero if the worker hasn't started a task yet.
+	LastTaskStart time.Time
+
+	// The task the worker is running, if Busy: its name (see SubmitNamed), ID and how long it has been running.
+	Busy    bool
+	Task    string
+	TaskID  uint64
+	Running time.Duration
+}
+
+// Published by a worker whenever it starts or finishes a task. Slots are indexed by worker ID and reused with the IDs.
+type heartbeat struct {
+	mu        sync.Mutex
+	alive     bool
+	completed uint64
+	lastStart time.Time
+	busy      bool
+	task      string
+	taskID    uint64
+}
+
+func (h *heartbeat) reset(alive bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.alive = alive
+	h.completed = 0
+	h.lastStart = time.Time{}
+	h.busy = false
+	h.task = ""
+}
+
+func (h *heartbeat) started(task queuedTask, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastStart = now
+	h.busy = true
+	h.task = task.name
+	h.taskID = task.id
+}
+
+func (h *heartbeat) finished() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.completed++
+	h.busy = false
+	h.task = ""
+}
+
+// Workers returns the status of every running worker, so workers stuck in a task can be found by the task's name
+// and how long it has been running. Workers of the IO pool, if any, follow the CPU-bound ones.
+func (p *ThreadPool) Workers() []WorkerStatus {
+	workers := p.workerStatuses(false)
+	if p.ioPool != nil {
+		workers = append(workers, p.ioPool.workerStatuses(true)...)
+	}
+	return workers
+}
+
+func (p *ThreadPool) workerStatuses(io bool) []WorkerStatus {
+	now := p.clock.Now()
+
+	var workers []WorkerStatus
+	for id := range p.heartbeats {
+		h := &p.heartbeats[id]
+		h.mu.Lock()
+		if h.alive {
+			w := WorkerStatus{
+				ID:             uint32(id),
+				IO:             io,
+				TasksCompleted: h.completed,
+				LastTaskStart:  h.lastStart,
+				Busy:           h.busy,
+			}
+			if h.busy {
+				w.Task = h.task
+				w.TaskID = h.taskID
+				w.Running = now.Sub(h.lastStart)
+			}
+			workers = append(workers, w)
+		}
+		h.mu.Unlock()
+	}
+	return workers
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkersReportRunningTask(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	p := newTestPool(t, 1, WithClock(clock), WithMinWorkers(1))
+
+	p.SubmitTask(func() {})
+	assert.Eventually(t, func() bool {
+		w := p.Workers()
+		return len(w) == 1 && w[0].TasksCompleted == 1
+	}, time.Second, time.Millisecond)
+	assert.False(t, p.Workers()[0].Busy)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	p.SubmitNamed("stuck", func() {
+		close(started)
+		<-release
+	})
+	<-started
+	clock.Advance(5 * time.Second)
+
+	w := p.Workers()
+	assert.Len(t, w, 1)
+	assert.Equal(t, uint32(0), w[0].ID)
+	assert.False(t, w[0].IO)
+	assert.True(t, w[0].Busy)
+	assert.Equal(t, "stuck", w[0].Task)
+	assert.Equal(t, uint64(1), w[0].TaskID)
+	assert.Equal(t, 5*time.Second, w[0].Running)
+	assert.Equal(t, time.Unix(0, 0), w[0].LastTaskStart)
+	assert.Equal(t, uint64(1), w[0].TasksCompleted)
+
+	close(release)
+	assert.Eventually(t, func() bool {
+		w := p.Workers()
+		return len(w) == 1 && !w[0].Busy && w[0].TasksCompleted == 2
+	}, time.Second, time.Millisecond)
+
+	p.Wait()
+	assert.Empty(t, p.Workers())
+}
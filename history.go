@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// How often the pool statistics are sampled, see WithHistory.
+const historyInterval = time.Second
+
+// Sample of the pool statistics, see History.
+type Sample struct {
+	Time time.Time
+	// Tasks completed per second since the previous sample.
+	TasksPerSec float64
+	// Number of tasks waiting for a worker or handed over to one which hasn't started them yet.
+	QueueDepth int
+	// Number of workers running a task, idle pre-warmed workers are not counted.
+	ActiveWorkers int
+}
+
+// Fixed-size ring of samples, the oldest samples are overwritten once it is full.
+type history struct {
+	samples []Sample
+	next    int
+	full    bool
+	mu      sync.Mutex
+
+	// Accessed by the dispatcher only.
+	lastTick time.Time
+	lastDone uint32
+}
+
+// WithHistory samples the pool statistics once per second and keeps the last size samples,
+// so the progress of a run can be inspected with History once it completes.
+func WithHistory(size int) Option {
+	return func(p *ThreadPool) {
+		p.history = nil
+		if size > 0 {
+			p.history = &history{samples: make([]Sample, size)}
+		}
+	}
+}
+
+func (h *history) add(s Sample) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.samples[h.next] = s
+	h.next = (h.next + 1) % len(h.samples)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// Takes a sample once per interval, or right away if force is set.
+func (p *ThreadPool) sampleHistory(force bool) {
+	h := p.history
+	now := p.clock.Now()
+	elapsed := now.Sub(h.lastTick)
+	if elapsed < historyInterval && (!force || elapsed <= 0) {
+		return
+	}
+
+	done := atomic.LoadUint32(&p.metrics.tasksDone)
+	pending, ready := p.QueueDepths()
+
+	h.add(Sample{
+		Time:          now,
+		TasksPerSec:   float64(done-h.lastDone) / elapsed.Seconds(),
+		QueueDepth:    pending + ready,
+		ActiveWorkers: p.activeWorkers(),
+	})
+	h.lastTick = now
+	h.lastDone = done
+}
+
+// History returns the samples taken by a pool created WithHistory, from the oldest to the newest.
+// The last sample is taken once the pool completes, so it may cover less than a second.
+func (p *ThreadPool) History() []Sample {
+	h := p.history
+	if h == nil {
+		return nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.full {
+		return append([]Sample(nil), h.samples[:h.next]...)
+	}
+	return append(append([]Sample(nil), h.samples[h.next:]...), h.samples[:h.next]...)
+}
+
+// WriteHistoryCSV writes the samples as CSV with a header, the time is in seconds since the first sample.
+func WriteHistoryCSV(w io.Writer, samples []Sample) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"seconds", "tasks_per_sec", "queue_depth", "active_workers"})
+	for _, s := range samples {
+		cw.Write([]string{
+			strconv.FormatFloat(s.Time.Sub(samples[0].Time).Seconds(), 'f', 3, 64),
+			strconv.FormatFloat(s.TasksPerSec, 'f', 2, 64),
+			strconv.Itoa(s.QueueDepth),
+			strconv.Itoa(s.ActiveWorkers),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+var sparkBars = []rune("▁▂▃▄▅▆▇█")
+
+// Renders the values as a line of bars scaled to the largest value.
+func sparkline(values []float64) string {
+	var top float64
+	for _, v := range values {
+		top = max(top, v)
+	}
+
+	var b strings.Builder
+	for _, v := range values {
+		i := 0
+		if top > 0 {
+			i = min(int(v/top*float64(len(sparkBars)-1)+0.5), len(sparkBars)-1)
+		}
+		b.WriteRune(sparkBars[max(i, 0)])
+	}
+	return b.String()
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistoryKeepsLastSamples(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	p := newTestPool(t, 1, WithClock(clock), WithHistory(3))
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	p.SubmitTask(func() {
+		close(started)
+		<-release
+	})
+	<-started
+	p.SubmitTask(func() {})
+
+	for i := 1; i <= 5; i++ {
+		clock.Advance(historyInterval)
+		assert.Eventually(t, func() bool {
+			h := p.History()
+			return len(h) > 0 && h[len(h)-1].Time.Equal(clock.Now())
+		}, time.Second, time.Millisecond)
+	}
+
+	h := p.History()
+	assert.Len(t, h, 3)
+	for i, s := range h {
+		assert.Equal(t, time.Unix(int64(3+i), 0), s.Time)
+		assert.Zero(t, s.TasksPerSec)
+		assert.Equal(t, 1, s.ActiveWorkers)
+		assert.Equal(t, 1, s.QueueDepth)
+	}
+
+	close(release)
+	p.Wait()
+	assert.Len(t, p.History(), 3)
+}
+
+func TestWriteHistoryCSV(t *testing.T) {
+	start := time.Unix(100, 0)
+	samples := []Sample{
+		{Time: start, TasksPerSec: 10, QueueDepth: 5, ActiveWorkers: 2},
+		{Time: start.Add(1500 * time.Millisecond), TasksPerSec: 2.5, QueueDepth: 0, ActiveWorkers: 1},
+	}
+
+	var out bytes.Buffer
+	assert.NoError(t, WriteHistoryCSV(&out, samples))
+	assert.Equal(t, "seconds,tasks_per_sec,queue_depth,active_workers\n0.000,10.00,5,2\n1.500,2.50,0,1\n", out.String())
+}
+
+func TestSparkline(t *testing.T) {
+	assert.Equal(t, "▁▅█", sparkline([]float64{0, 5, 10}))
+	assert.Equal(t, "▁▁", sparkline([]float64{0, 0}))
+	assert.Empty(t, sparkline(nil))
+}
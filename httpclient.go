@@ -0,0 +1,124 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Configuration of the HTTP client shared by all the crawling tasks.
+type ClientOptions struct {
+	Timeout            time.Duration // limit for a whole request including reading the body, 0 means no limit
+	MaxConnsPerHost    int           // 0 means no limit
+	Proxy              string        // proxy URL, the environment (HTTP_PROXY etc.) is used if empty
+	UserAgent          string
+	Headers            http.Header // sent with every request
+	InsecureSkipVerify bool        // don't verify TLS certificates, for internal sites with self-signed ones
+}
+
+// Sets the configured headers on every request.
+type headerTransport struct {
+	base    http.RoundTripper
+	headers http.Header
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A RoundTripper must not modify the request it was given.
+	req = req.Clone(req.Context())
+	for name, values := range t.headers {
+		req.Header[name] = values
+	}
+	return t.base.RoundTrip(req)
+}
+
+// Creates a client with a single transport, so the connections are reused across the tasks
+// rather than each task exhausting sockets with connections of its own.
+func newHTTPClient(o ClientOptions) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxConnsPerHost = o.MaxConnsPerHost
+	transport.MaxIdleConnsPerHost = max(o.MaxConnsPerHost, http.DefaultMaxIdleConnsPerHost)
+
+	if o.Proxy != "" {
+		proxy, err := neturl.Parse(o.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy: %s", err.Error())
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	if o.InsecureSkipVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	headers := o.Headers.Clone()
+	if o.UserAgent != "" {
+		if headers == nil {
+			headers = make(http.Header)
+		}
+		headers.Set("User-Agent", o.UserAgent)
+	}
+
+	var rt http.RoundTripper = transport
+	if len(headers) != 0 {
+		rt = &headerTransport{base: transport, headers: headers}
+	}
+	return &http.Client{Transport: rt, Timeout: o.Timeout}, nil
+}
+
+// Collects repeated -header "Name: value" flags.
+type headerFlag http.Header
+
+func (h headerFlag) String() string {
+	return fmt.Sprint(http.Header(h))
+}
+
+func (h headerFlag) Set(s string) error {
+	name, value, found := strings.Cut(s, ":")
+	if !found || strings.TrimSpace(name) == "" {
+		return fmt.Errorf("expected \"Name: value\", got %q", s)
+	}
+	http.Header(h).Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	return nil
+}
+
+// Classifies an error of a request, only timeouts are worth retrying.
+func transientFetchError(err error) error {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return err
+	}
+	return Permanent(err)
+}
+
+// Returns the error for a response with a status other than 200 OK. 429 and 5xx statuses are retried,
+// respecting the Retry-After header if the server sent one.
+func statusError(response *http.Response, now time.Time) error {
+	err := errors.New(response.Status)
+	if response.StatusCode != http.StatusTooManyRequests && response.StatusCode < 500 {
+		return Permanent(err)
+	}
+	if delay, ok := parseRetryAfter(response.Header.Get("Retry-After"), now); ok {
+		return RetryAfter(err, delay)
+	}
+	return err
+}
+
+// Parses the value of a Retry-After header, either a number of seconds or an HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+	return 0, false
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPClientHeaders(t *testing.T) {
+	var received http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+	}))
+	defer server.Close()
+
+	headers := make(http.Header)
+	assert.NoError(t, headerFlag(headers).Set("X-Token: secret"))
+	assert.Error(t, headerFlag(headers).Set("no colon"))
+
+	client, err := newHTTPClient(ClientOptions{UserAgent: "crawler/1.0", Headers: headers, MaxConnsPerHost: 2})
+	assert.NoError(t, err)
+
+	response, err := client.Get(server.URL)
+	assert.NoError(t, err)
+	response.Body.Close()
+
+	assert.Equal(t, "crawler/1.0", received.Get("User-Agent"))
+	assert.Equal(t, "secret", received.Get("X-Token"))
+	client.CloseIdleConnections()
+}
+
+func TestHTTPClientTimeoutAndTLS(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	// The test server's certificate is self-signed.
+	client, err := newHTTPClient(ClientOptions{})
+	assert.NoError(t, err)
+	_, err = client.Get(server.URL)
+	assert.Error(t, err)
+
+	client, err = newHTTPClient(ClientOptions{InsecureSkipVerify: true, Timeout: 50 * time.Millisecond})
+	assert.NoError(t, err)
+	_, err = client.Get(server.URL)
+	assert.ErrorContains(t, err, "Client.Timeout")
+	client.CloseIdleConnections()
+
+	_, err = newHTTPClient(ClientOptions{Proxy: "://bad"})
+	assert.Error(t, err)
+}
+
+func TestStatusErrorRetries(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	response := func(status int, retryAfter string) *http.Response {
+		r := &http.Response{StatusCode: status, Status: http.StatusText(status), Header: make(http.Header)}
+		if retryAfter != "" {
+			r.Header.Set("Retry-After", retryAfter)
+		}
+		return r
+	}
+
+	var permanent *permanentError
+	assert.ErrorAs(t, statusError(response(http.StatusNotFound, ""), now), &permanent)
+	assert.False(t, errors.As(statusError(response(http.StatusBadGateway, ""), now), &permanent))
+
+	var retryAfter *retryAfterError
+	assert.ErrorAs(t, statusError(response(http.StatusTooManyRequests, "7"), now), &retryAfter)
+	assert.Equal(t, 7*time.Second, retryAfter.delay)
+
+	date := now.Add(time.Minute).Format(http.TimeFormat)
+	assert.ErrorAs(t, statusError(response(http.StatusServiceUnavailable, date), now), &retryAfter)
+	assert.Equal(t, time.Minute, retryAfter.delay)
+
+	_, ok := parseRetryAfter("soon", now)
+	assert.False(t, ok)
+}
+
+func TestTransientFetchError(t *testing.T) {
+	var permanent *permanentError
+	assert.ErrorAs(t, transientFetchError(errors.New("connection refused")), &permanent)
+	assert.False(t, errors.As(transientFetchError(context.DeadlineExceeded), &permanent))
+}
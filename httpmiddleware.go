@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+)
+
+// States of a request handled by HTTPMiddleware.
+const (
+	requestQueued int32 = iota
+	requestRunning
+	requestAbandoned // the client went away before a worker picked the request up
+)
+
+// HTTPMiddleware runs handlers on the workers of p, so the number of requests handled at once is bounded
+// by the number of workers. Requests arriving while maxQueued requests wait for a worker, or after p.Wait() was called,
+// are rejected with 503 Service Unavailable; maxQueued below 1 means no limit.
+// Handlers receive the request's context, which additionally carries the worker ID (see WorkerIDFromContext),
+// and requests whose clients go away before a worker picks them up are dropped.
+// A panic in a handler is re-raised in the goroutine of the server, which recovers it as usual.
+// If the pool has a metrics sink, requests and rejections are counted as MetricHTTPRequests and MetricHTTPRejected.
+func HTTPMiddleware(p *ThreadPool, maxQueued int) func(http.Handler) http.Handler {
+	var queued atomic.Int64
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if p.metricsSink != nil {
+				p.metricsSink.Counter(MetricHTTPRequests, 1)
+			}
+
+			if n := queued.Add(1); maxQueued > 0 && n > int64(maxQueued) {
+				queued.Add(-1)
+				rejectRequest(p, w)
+				return
+			}
+
+			var state atomic.Int32
+			var panicked any
+			done := make(chan struct{})
+
+			err := p.SubmitTaskCtx(r.Context(), func(ctx context.Context) {
+				defer close(done)
+				queued.Add(-1)
+
+				if !state.CompareAndSwap(requestQueued, requestRunning) {
+					return
+				}
+				defer func() {
+					panicked = recover()
+				}()
+				next.ServeHTTP(w, r.WithContext(ctx))
+			})
+			if err != nil {
+				queued.Add(-1)
+				rejectRequest(p, w)
+				return
+			}
+
+			select {
+			case <-done:
+			case <-r.Context().Done():
+				// Once running, the handler may still be writing the response, so it has to be waited for.
+				if state.CompareAndSwap(requestQueued, requestAbandoned) {
+					return
+				}
+				<-done
+			}
+
+			if panicked != nil {
+				panic(panicked)
+			}
+		})
+	}
+}
+
+func rejectRequest(p *ThreadPool, w http.ResponseWriter) {
+	if p.metricsSink != nil {
+		p.metricsSink.Counter(MetricHTTPRejected, 1)
+	}
+	w.Header().Set("Retry-After", "1")
+	http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPMiddleware(t *testing.T) {
+	sink := NewPrometheusSink()
+	p := newTestPool(t, 2, WithMetricsSink(sink))
+
+	handler := HTTPMiddleware(p, 0)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := WorkerIDFromContext(r.Context())
+		assert.True(t, ok)
+		fmt.Fprintf(w, "%s handled by %d", r.URL.Path, id)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/report", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Regexp(t, `^/report handled by \d+$`, w.Body.String())
+
+	p.Wait()
+
+	// The pool no longer accepts tasks.
+	skipInStrictMode(t)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/report", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	var out bytes.Buffer
+	sink.WriteTo(&out)
+	assert.Contains(t, out.String(), MetricHTTPRequests+" 2\n")
+	assert.Contains(t, out.String(), MetricHTTPRejected+" 1\n")
+}
+
+func TestHTTPMiddlewareQueueFull(t *testing.T) {
+	p := newTestPool(t, 1)
+
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+	handler := HTTPMiddleware(p, 1)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+
+	codes := make(chan int, 2)
+	serve := func() {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		codes <- w.Code
+	}
+
+	// The first request occupies the only worker and the second one waits for it.
+	go serve()
+	<-started
+	go serve()
+	assert.Eventually(t, func() bool { return p.Metrics().TasksSubmitted == 2 }, time.Second, time.Millisecond)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	close(release)
+	assert.Equal(t, http.StatusOK, <-codes)
+	assert.Equal(t, http.StatusOK, <-codes)
+}
+
+func TestHTTPMiddlewareAbandonedRequest(t *testing.T) {
+	p := newTestPool(t, 1)
+
+	release := make(chan struct{})
+	assert.NoError(t, p.SubmitTask(func() { <-release }))
+
+	var handled atomic.Int32
+	handler := HTTPMiddleware(p, 0)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handled.Add(1)
+	}))
+
+	// The client goes away while the request waits for the busy worker.
+	ctx, cancel := context.WithCancel(context.Background())
+	returned := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+		close(returned)
+	}()
+	assert.Eventually(t, func() bool { return p.Metrics().TasksSubmitted == 2 }, time.Second, time.Millisecond)
+	cancel()
+	<-returned
+
+	close(release)
+	p.Wait()
+	assert.Zero(t, handled.Load())
+}
+
+func TestHTTPMiddlewarePanic(t *testing.T) {
+	p := newTestPool(t, 1)
+
+	handler := HTTPMiddleware(p, 0)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	})
+}
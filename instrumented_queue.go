@@ -0,0 +1,122 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Number of most recent time-in-queue samples used to compute percentiles.
+const waitSamples = 1024
+
+type QueueStats struct {
+	P50        time.Duration
+	P95        time.Duration
+	P99        time.Duration
+	MaxDepth   int
+	Popped     uint64
+	Throughput float64 // elements popped per second since the queue was created
+}
+
+type timedItem[T any] struct {
+	item     T
+	enqueued time.Time
+}
+
+// InstrumentedQueue wraps Queue and records how long elements spend in it.
+type InstrumentedQueue[T any] struct {
+	q *Queue[timedItem[T]]
+
+	mu       sync.Mutex
+	created  time.Time
+	waits    [waitSamples]time.Duration
+	nWaits   int
+	maxDepth int
+	popped   uint64
+}
+
+func NewInstrumentedQueue[T any](size ...int) *InstrumentedQueue[T] {
+	return &InstrumentedQueue[T]{
+		q:       NewQueue[timedItem[T]](size...),
+		created: time.Now(),
+	}
+}
+
+func (q *InstrumentedQueue[T]) Push(item T) error {
+	if err := q.q.Push(timedItem[T]{item: item, enqueued: time.Now()}); err != nil {
+		return err
+	}
+
+	depth := q.q.Size()
+	q.mu.Lock()
+	q.maxDepth = max(q.maxDepth, depth)
+	q.mu.Unlock()
+
+	return nil
+}
+
+func (q *InstrumentedQueue[T]) TryPop(value *T) bool {
+	var ti timedItem[T]
+	if !q.q.TryPop(&ti) {
+		return false
+	}
+	*value = ti.item
+	q.record(ti.enqueued)
+	return true
+}
+
+func (q *InstrumentedQueue[T]) Pop() (T, error) {
+	ti, err := q.q.Pop()
+	if err != nil {
+		return ti.item, err
+	}
+	q.record(ti.enqueued)
+	return ti.item, nil
+}
+
+func (q *InstrumentedQueue[T]) Empty() bool {
+	return q.q.Empty()
+}
+
+func (q *InstrumentedQueue[T]) Size() int {
+	return q.q.Size()
+}
+
+func (q *InstrumentedQueue[T]) record(enqueued time.Time) {
+	wait := time.Since(enqueued)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.waits[q.popped%waitSamples] = wait
+	q.nWaits = min(q.nWaits+1, waitSamples)
+	q.popped++
+}
+
+// Stats computes time-in-queue percentiles over the most recent samples.
+func (q *InstrumentedQueue[T]) Stats() QueueStats {
+	q.mu.Lock()
+	waits := make([]time.Duration, q.nWaits)
+	copy(waits, q.waits[:q.nWaits])
+	stats := QueueStats{
+		MaxDepth:   q.maxDepth,
+		Popped:     q.popped,
+		Throughput: float64(q.popped) / time.Since(q.created).Seconds(),
+	}
+	q.mu.Unlock()
+
+	if len(waits) == 0 {
+		return stats
+	}
+
+	sort.Slice(waits, func(i, j int) bool { return waits[i] < waits[j] })
+	percentile := func(p int) time.Duration {
+		return waits[(len(waits)-1)*p/100]
+	}
+
+	stats.P50 = percentile(50)
+	stats.P95 = percentile(95)
+	stats.P99 = percentile(99)
+
+	return stats
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestInstrumentedQueue_Stats(t *testing.T) {
+	q := NewInstrumentedQueue[int]()
+
+	assert.Equal(t, QueueStats{}, q.Stats())
+
+	// 4 out of 100 elements spend at least 10ms in the queue.
+	for i := 0; i < 4; i++ {
+		q.Push(i)
+	}
+	time.Sleep(10 * time.Millisecond)
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, i, must(q.Pop()))
+	}
+
+	for i := 0; i < 96; i++ {
+		q.Push(i)
+		var v int
+		assert.True(t, q.TryPop(&v))
+		assert.Equal(t, i, v)
+	}
+
+	var v int
+	assert.False(t, q.TryPop(&v))
+
+	stats := q.Stats()
+	assert.Equal(t, 4, stats.MaxDepth)
+	assert.EqualValues(t, 100, stats.Popped)
+	assert.Greater(t, stats.Throughput, 0.0)
+	assert.Less(t, stats.P50, 10*time.Millisecond)
+	assert.Less(t, stats.P95, 10*time.Millisecond)
+	assert.GreaterOrEqual(t, stats.P99, 10*time.Millisecond)
+}
+
+func TestInstrumentedQueue_PoolMetrics(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	const TASKS_COUNT = 64
+
+	p := NewPoolWithOptions(2, WithQueueStats())
+	for i := 0; i < TASKS_COUNT; i++ {
+		p.SubmitTask(func() {})
+	}
+	p.Wait()
+
+	m := p.Metrics()
+	assert.EqualValues(t, TASKS_COUNT, m.PendingQueue.Popped)
+	assert.Greater(t, m.PendingQueue.MaxDepth, 0)
+}
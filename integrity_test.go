@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var longTests = flag.Bool("long", false, "Run the randomized tests with many more iterations")
+
+// Number of iterations of a randomized test, raised with -long.
+func iterations(short, long int) int {
+	if *longTests {
+		return long
+	}
+	return short
+}
+
+// Every 8-byte word holds its own offset, so a chunk read from a wrong place or reassembled at a wrong place
+// shows up as a mismatch at an exact byte.
+func offsetEncoded(size int) []byte {
+	data := make([]byte, size+7)
+	for off := 0; off < size; off += 8 {
+		binary.LittleEndian.PutUint64(data[off:], uint64(off))
+	}
+	return data[:size]
+}
+
+var errInjected = errors.New("injected read failure")
+
+// Fails every read starting at one of the offsets.
+type faultyReaderAt struct {
+	io.ReaderAt
+	fail map[int64]bool
+}
+
+func (r *faultyReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if r.fail[off] {
+		return 0, errInjected
+	}
+	return r.ReaderAt.ReadAt(p, off)
+}
+
+// A random pipeline configuration, failing reads of some chunks.
+type integrityCase struct {
+	size      int
+	chunkSize int
+	threads   uint32
+	layout    chunkLayout
+	fail      map[int64]bool
+}
+
+func (c integrityCase) String() string {
+	return fmt.Sprintf("size %d, chunk %d, threads %d, layout %d, failing %v", c.size, c.chunkSize, c.threads, c.layout, c.fail)
+}
+
+func randomIntegrityCase(rng *rand.Rand) integrityCase {
+	c := integrityCase{
+		chunkSize: 1 + rng.Intn(700),
+		threads:   uint32(1 + rng.Intn(8)),
+		layout:    chunkLayout(rng.Intn(len(chunkLayouts))),
+		fail:      make(map[int64]bool),
+	}
+	// Sizes which are exact multiples of the chunk size are the usual suspects of off-by-one errors.
+	if rng.Intn(4) == 0 {
+		c.size = c.chunkSize * rng.Intn(10)
+	} else {
+		c.size = rng.Intn(5000)
+	}
+	if nChunks := (c.size + c.chunkSize - 1) / c.chunkSize; nChunks > 0 && rng.Intn(4) == 0 {
+		c.fail[int64(rng.Intn(nChunks)*c.chunkSize)] = true
+	}
+	return c
+}
+
+func TestParallelReadAtIntegrity(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x1e6a))
+	for i := 0; i < iterations(50, 5000); i++ {
+		c := randomIntegrityCase(rng)
+		data := offsetEncoded(c.size)
+		in := &faultyReaderAt{ReaderAt: bytes.NewReader(data), fail: c.fail}
+
+		// Reassemble the input from the chunks read by the workers.
+		nChunks := (c.size + c.chunkSize - 1) / c.chunkSize
+		out := make([]byte, c.size)
+		visits := make([]int, nChunks)
+		var failed []int64
+		var mu sync.Mutex
+
+		p := NewPoolWithOptions(c.threads)
+		submitChunks(p, nChunks, c.layout, func(index int) {
+			offset := int64(index) * int64(c.chunkSize)
+			chunk, err := readChunkAt(in, int64(c.size), offset, c.chunkSize)
+
+			mu.Lock()
+			defer mu.Unlock()
+			visits[index]++
+			if err != nil {
+				failed = append(failed, offset)
+				return
+			}
+			copy(out[offset:], chunk)
+		})
+		p.Wait()
+
+		for index, n := range visits {
+			require.Equal(t, 1, n, "chunk %d, %s", index, c)
+		}
+		require.Len(t, failed, len(c.fail), c.String())
+		for _, offset := range failed {
+			// The failed chunk stays zeroed, fill it in so the rest can be compared byte by byte.
+			end := min(offset+int64(c.chunkSize), int64(c.size))
+			copy(out[offset:end], data[offset:end])
+		}
+		require.True(t, bytes.Equal(data, out), c.String())
+	}
+}
+
+func TestMerkleTreeIntegrity(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x3e4c))
+	for i := 0; i < iterations(50, 2000); i++ {
+		c := randomIntegrityCase(rng)
+		data := offsetEncoded(c.size)
+		in := &faultyReaderAt{ReaderAt: bytes.NewReader(data), fail: c.fail}
+
+		tree, err := buildMerkleTree(in, int64(c.size), merkleOptions{chunkSize: c.chunkSize, hash: "sha256", maxThreads: c.threads, layout: c.layout})
+		if len(c.fail) != 0 {
+			require.ErrorIs(t, err, errInjected, c.String())
+			for offset := range c.fail {
+				assert.ErrorContains(t, err, fmt.Sprintf("chunk at offset %d:", offset), c.String())
+			}
+			continue
+		}
+		require.NoError(t, err, c.String())
+
+		expected := []hexDigest{hashLeaf(sha256.New, nil)}
+		if c.size > 0 {
+			expected = expected[:0]
+			for off := 0; off < c.size; off += c.chunkSize {
+				expected = append(expected, hashLeaf(sha256.New, data[off:min(off+c.chunkSize, c.size)]))
+			}
+		}
+		require.Equal(t, expected, tree.Levels[0], c.String())
+	}
+}
+
+func TestDiffIntegrity(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x7d1f))
+	for i := 0; i < iterations(50, 2000); i++ {
+		c := randomIntegrityCase(rng)
+		a := offsetEncoded(c.size)
+
+		// Flip random bytes of a copy, which may also be shorter or longer.
+		b := append([]byte(nil), a[:rng.Intn(c.size+1)]...)
+		b = append(b, bytes.Repeat([]byte{0xff}, rng.Intn(2)*rng.Intn(100))...)
+		for n := rng.Intn(5); n > 0 && len(b) > 0; n-- {
+			b[rng.Intn(len(b))] ^= 0xff
+		}
+
+		res, err := diffFiles(bytes.NewReader(a), &faultyReaderAt{ReaderAt: bytes.NewReader(b), fail: c.fail},
+			int64(len(a)), int64(len(b)), diffOptions{chunkSize: c.chunkSize, maxThreads: c.threads, layout: c.layout})
+		if c.failsWithin(len(b)) {
+			require.ErrorIs(t, err, errInjected, c.String())
+			continue
+		}
+		require.NoError(t, err, c.String())
+
+		// Brute force: every byte which differs or exists only in one of the inputs.
+		var expected []ByteRange
+		for i := 0; i < max(len(a), len(b)); i++ {
+			if i < len(a) && i < len(b) && a[i] == b[i] {
+				continue
+			}
+			if last := len(expected) - 1; last >= 0 && expected[last].End == int64(i) {
+				expected[last].End++
+			} else {
+				expected = append(expected, ByteRange{Start: int64(i), End: int64(i) + 1})
+			}
+		}
+		require.Equal(t, expected, res.Ranges, c.String())
+	}
+}
+
+// Reports whether one of the failing reads is within an input of size bytes, reads past its end don't happen.
+func (c integrityCase) failsWithin(size int) bool {
+	for offset := range c.fail {
+		if offset < int64(size) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A page discovered by the crawler, pages beyond the depth limit are never fetched and have no status.
+type LinkNode struct {
+	URL         string        `json:"url"`
+	Depth       int           `json:"depth"`
+	Status      int           `json:"status,omitempty"`
+	ContentType string        `json:"content_type,omitempty"`
+	Latency     time.Duration `json:"latency_ns,omitempty"`
+	Error       string        `json:"error,omitempty"`
+	Attempts    int           `json:"attempts,omitempty"`
+	Links       []string      `json:"links,omitempty"`
+}
+
+// Graph of the links between crawled pages, safe for concurrent use by the crawling tasks.
+type LinkGraph struct {
+	nodes map[string]*LinkNode
+	links map[string]map[string]struct{}
+	mu    sync.Mutex
+}
+
+func NewLinkGraph() *LinkGraph {
+	return &LinkGraph{
+		nodes: make(map[string]*LinkNode),
+		links: make(map[string]map[string]struct{}),
+	}
+}
+
+// Returns the node of the URL, the URL may be reached by several paths, so the smallest depth is kept.
+func (g *LinkGraph) node(url string, depth int) *LinkNode {
+	n, exists := g.nodes[url]
+	if !exists {
+		n = &LinkNode{URL: url, Depth: depth}
+		g.nodes[url] = n
+	}
+	n.Depth = min(n.Depth, depth)
+	return n
+}
+
+// Records the result of fetching a page.
+func (g *LinkGraph) fetched(url string, depth, status int, contentType string, latency time.Duration, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	n := g.node(url, depth)
+	n.Status = status
+	n.ContentType = contentType
+	n.Latency = latency
+	// An earlier attempt could have failed.
+	n.Error = ""
+	if err != nil {
+		n.Error = err.Error()
+	}
+}
+
+// Records the number of attempts made to fetch a page, once the crawler succeeded or gave up.
+func (g *LinkGraph) attempted(url string, depth, attempts int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.node(url, depth).Attempts = attempts
+}
+
+// Records the links found on a page at the given depth.
+func (g *LinkGraph) linked(from string, depth int, to []string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.node(from, depth)
+	out, exists := g.links[from]
+	if !exists {
+		out = make(map[string]struct{})
+		g.links[from] = out
+	}
+	for _, url := range to {
+		g.node(url, depth+1)
+		out[url] = struct{}{}
+	}
+}
+
+// Nodes returns a snapshot of the graph ordered by depth and URL, with the links of each node sorted.
+func (g *LinkGraph) Nodes() []LinkNode {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	nodes := make([]LinkNode, 0, len(g.nodes))
+	for url, n := range g.nodes {
+		node := *n
+		node.Links = nil
+		for to := range g.links[url] {
+			node.Links = append(node.Links, to)
+		}
+		sort.Strings(node.Links)
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].Depth != nodes[j].Depth {
+			return nodes[i].Depth < nodes[j].Depth
+		}
+		return nodes[i].URL < nodes[j].URL
+	})
+	return nodes
+}
+
+// WriteJSON writes the graph as a list of nodes, each with its metadata and adjacency list.
+func (g *LinkGraph) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(g.Nodes())
+}
+
+// WriteDOT writes the graph in the Graphviz DOT format, nodes of the same depth are placed on the same rank.
+func (g *LinkGraph) WriteDOT(w io.Writer) error {
+	nodes := g.Nodes()
+
+	var err error
+	printf := func(format string, args ...any) {
+		if err == nil {
+			_, err = fmt.Fprintf(w, format, args...)
+		}
+	}
+
+	printf("digraph crawl {\n")
+	for i := 0; i < len(nodes); {
+		depth := nodes[i].Depth
+		printf("  { rank=same;")
+		for ; i < len(nodes) && nodes[i].Depth == depth; i++ {
+			printf(" %q;", nodes[i].URL)
+		}
+		printf(" }\n")
+	}
+	for _, n := range nodes {
+		label := fmt.Sprintf("%s\ndepth %d", n.URL, n.Depth)
+		switch {
+		case n.Error != "":
+			label += "\n" + n.Error
+		case n.Status != 0:
+			label += fmt.Sprintf("\n%d %s %v", n.Status, n.ContentType, n.Latency.Round(time.Millisecond))
+		}
+		if n.Attempts > 1 {
+			label += fmt.Sprintf("\n%d attempts", n.Attempts)
+		}
+		printf("  %q [label=%q];\n", n.URL, label)
+	}
+	for _, n := range nodes {
+		for _, to := range n.Links {
+			printf("  %q -> %q;\n", n.URL, to)
+		}
+	}
+	printf("}\n")
+	return err
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestLinkGraph() *LinkGraph {
+	g := NewLinkGraph()
+	g.fetched("https://a.org", 0, 200, "text/html", 120*time.Millisecond, nil)
+	g.linked("https://a.org", 0, []string{"https://a.org/b", "https://a.org/c", "https://a.org/b"})
+	g.fetched("https://a.org/b", 1, 0, "", 0, errors.New("timeout"))
+	g.fetched("https://a.org/c", 1, 200, "text/html", 10*time.Millisecond, nil)
+	// A link back to the root must not increase its depth.
+	g.linked("https://a.org/c", 1, []string{"https://a.org", "https://a.org/d"})
+	return g
+}
+
+func TestLinkGraphNodes(t *testing.T) {
+	nodes := newTestLinkGraph().Nodes()
+
+	var urls []string
+	for _, n := range nodes {
+		urls = append(urls, n.URL)
+	}
+	assert.Equal(t, []string{"https://a.org", "https://a.org/b", "https://a.org/c", "https://a.org/d"}, urls)
+
+	assert.Equal(t, 0, nodes[0].Depth)
+	assert.Equal(t, []string{"https://a.org/b", "https://a.org/c"}, nodes[0].Links)
+	assert.Equal(t, "timeout", nodes[1].Error)
+	assert.Equal(t, 2, nodes[3].Depth)
+	assert.Zero(t, nodes[3].Status)
+}
+
+func TestLinkGraphWriteJSON(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, newTestLinkGraph().WriteJSON(&out))
+
+	var nodes []LinkNode
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &nodes))
+	assert.Equal(t, newTestLinkGraph().Nodes(), nodes)
+}
+
+func TestLinkGraphWriteDOT(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, newTestLinkGraph().WriteDOT(&out))
+
+	dot := out.String()
+	assert.Contains(t, dot, "digraph crawl {\n")
+	assert.Contains(t, dot, `{ rank=same; "https://a.org/b"; "https://a.org/c"; }`)
+	assert.Contains(t, dot, `"https://a.org/c" -> "https://a.org";`)
+	assert.Contains(t, dot, `200 text/html 120ms`)
+}
@@ -0,0 +1,202 @@
+// Package loadgen synthesizes task workloads for exercising the thread pool.
+package loadgen
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Kind int
+
+const (
+	// Spin on the CPU for a given duration.
+	CPUBurn Kind = iota
+	// Allocate a buffer of a given size and write to every page of it.
+	MemoryTouch
+	// Sleep for a given duration, imitates IO-bound work.
+	Sleep
+)
+
+var kindNames = map[string]Kind{
+	"cpu":   CPUBurn,
+	"mem":   MemoryTouch,
+	"sleep": Sleep,
+}
+
+const pageSize = 4096
+
+func (k Kind) String() string {
+	for name, kind := range kindNames {
+		if kind == k {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+// Spec describes a single kind of task and its relative weight in a mixed workload.
+type Spec struct {
+	Kind     Kind
+	Duration time.Duration // used by CPUBurn and Sleep
+	Bytes    int           // used by MemoryTouch
+	Weight   int
+}
+
+type Workload struct {
+	Tasks int
+	Mix   []Spec
+	Seed  int64
+}
+
+// Creates a task burning CPU for the duration d.
+func CPUBurnTask(d time.Duration) func() {
+	return func() {
+		var x uint64
+		start := time.Now()
+		for time.Since(start) < d {
+			for i := 0; i < 1000; i++ {
+				x = x*6364136223846793005 + 1442695040888963407
+			}
+		}
+		_ = x
+	}
+}
+
+// Creates a task which allocates n bytes and touches every page.
+func MemoryTouchTask(n int) func() {
+	return func() {
+		buf := make([]byte, n)
+		for i := 0; i < len(buf); i += pageSize {
+			buf[i] = byte(i)
+		}
+	}
+}
+
+// Creates a task which sleeps for the duration d.
+func SleepTask(d time.Duration) func() {
+	return func() {
+		time.Sleep(d)
+	}
+}
+
+func (s Spec) Task() func() {
+	switch s.Kind {
+	case CPUBurn:
+		return CPUBurnTask(s.Duration)
+	case MemoryTouch:
+		return MemoryTouchTask(s.Bytes)
+	default:
+		return SleepTask(s.Duration)
+	}
+}
+
+// Generate returns w.Tasks tasks, picking a spec for each of them randomly according to the weights.
+// The same seed always produces the same sequence of tasks.
+func (w Workload) Generate() []func() {
+	specs := w.Specs()
+	if specs == nil {
+		return nil
+	}
+
+	tasks := make([]func(), len(specs))
+	for i, s := range specs {
+		tasks[i] = s.Task()
+	}
+	return tasks
+}
+
+// Specs returns the spec picked for each of the tasks returned by Generate.
+func (w Workload) Specs() []Spec {
+	totalWeight := 0
+	for _, s := range w.Mix {
+		totalWeight += s.Weight
+	}
+	if totalWeight == 0 {
+		return nil
+	}
+
+	r := rand.New(rand.NewSource(w.Seed))
+	specs := make([]Spec, w.Tasks)
+	for i := 0; i < w.Tasks; i++ {
+		n := r.Intn(totalWeight)
+		for _, s := range w.Mix {
+			if n < s.Weight {
+				specs[i] = s
+				break
+			}
+			n -= s.Weight
+		}
+	}
+	return specs
+}
+
+// ParseMix parses a workload description of the form "kind:param[:weight],...".
+// Example: "cpu:200us:3,sleep:1ms:1,mem:1MiB". The weight defaults to 1.
+func ParseMix(desc string) ([]Spec, error) {
+	var mix []Spec
+	for _, part := range strings.Split(desc, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ":")
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("invalid workload spec: %q", part)
+		}
+
+		kind, exists := kindNames[fields[0]]
+		if !exists {
+			return nil, fmt.Errorf("unknown task kind: %q", fields[0])
+		}
+
+		s := Spec{Kind: kind, Weight: 1}
+		var err error
+		if kind == MemoryTouch {
+			s.Bytes, err = ParseSize(fields[1])
+		} else {
+			s.Duration, err = time.ParseDuration(fields[1])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid parameter in %q: %w", part, err)
+		}
+
+		if len(fields) == 3 {
+			s.Weight, err = strconv.Atoi(fields[2])
+			if err != nil || s.Weight < 0 {
+				return nil, fmt.Errorf("invalid weight in %q", part)
+			}
+		}
+		mix = append(mix, s)
+	}
+	return mix, nil
+}
+
+// ParseSize parses sizes like "512", "64KiB", "1MiB" or "2GiB" into a number of bytes.
+func ParseSize(s string) (int, error) {
+	multipliers := []struct {
+		suffix string
+		mult   int
+	}{
+		{"GiB", 1 << 30},
+		{"MiB", 1 << 20},
+		{"KiB", 1 << 10},
+		{"B", 1},
+	}
+
+	mult := 1
+	for _, m := range multipliers {
+		if strings.HasSuffix(s, m.suffix) {
+			s = strings.TrimSuffix(s, m.suffix)
+			mult = m.mult
+			break
+		}
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("negative size: %d", n)
+	}
+	return n * mult, nil
+}
@@ -0,0 +1,50 @@
+package loadgen
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMix(t *testing.T) {
+	mix, err := ParseMix("cpu:200us:3, sleep:1ms, mem:2MiB:2")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []Spec{
+		{Kind: CPUBurn, Duration: 200 * time.Microsecond, Weight: 3},
+		{Kind: Sleep, Duration: time.Millisecond, Weight: 1},
+		{Kind: MemoryTouch, Bytes: 2 << 20, Weight: 2},
+	}, mix)
+}
+
+func TestParseMixInvalid(t *testing.T) {
+	for _, desc := range []string{"", "cpu", "gpu:1ms", "cpu:abc", "mem:1TiB", "sleep:1ms:x"} {
+		_, err := ParseMix(desc)
+		assert.Error(t, err, desc)
+	}
+}
+
+func TestGenerateIsDeterministic(t *testing.T) {
+	const N = 64
+	mix := []Spec{
+		{Kind: Sleep, Duration: time.Microsecond, Weight: 1},
+		{Kind: Sleep, Duration: 2 * time.Microsecond, Weight: 1},
+		{Kind: MemoryTouch, Bytes: 16, Weight: 1},
+	}
+	w := Workload{Tasks: N, Mix: mix, Seed: 0x1234}
+
+	// The same seed picks the same kinds and parameters.
+	first, second := w.Specs(), Workload{Tasks: N, Mix: mix, Seed: 0x1234}.Specs()
+	assert.Len(t, first, N)
+	assert.Equal(t, first, second)
+	assert.NotEqual(t, first, Workload{Tasks: N, Mix: mix, Seed: 0x4321}.Specs())
+
+	tasks := w.Generate()
+	assert.Len(t, tasks, N)
+	for _, task := range tasks {
+		task()
+	}
+
+	assert.Nil(t, Workload{Tasks: N}.Generate())
+}
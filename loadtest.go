@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/isnastish/workers_prototype/loadgen"
+)
+
+// Runs a synthetic workload described on the command line and prints the pool statistics.
+func runLoadTest(args []string) error {
+	fs := flag.NewFlagSet("loadtest", flag.ContinueOnError)
+
+	tasks := fs.Int("tasks", 10000, "Number of tasks to submit")
+	threads := fs.Uint("threads", 0, "Maximum number of workers, defaults to the number of CPUs")
+	mix := fs.String("workload", "cpu:100us:3,sleep:1ms:1", "Workload description, kind:param[:weight],...")
+	seed := fs.Int64("seed", 1, "Seed used to generate the workload")
+	historyFile := fs.String("history", "", "Write per-second pool statistics to this CSV file")
+	jsonFile := fs.String("json", "", "Write the results as JSON to this file, see bench-compare")
+	output := addOutputFlags(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%w: %s", errBadArguments, err.Error())
+	}
+
+	if *tasks < 0 {
+		return fmt.Errorf("%w: invalid number of tasks: %d", errBadArguments, *tasks)
+	}
+
+	specs, err := loadgen.ParseMix(*mix)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errBadArguments, err.Error())
+	}
+
+	poolOptions, err := output.poolOptions()
+	if err != nil {
+		return err
+	}
+
+	workload := loadgen.Workload{Tasks: *tasks, Mix: specs, Seed: *seed}.Generate()
+
+	var memBefore, memAfter runtime.MemStats
+	runtime.ReadMemStats(&memBefore)
+
+	// An hour of samples, longer runs keep the most recent hour.
+	p := NewPoolWithOptions(uint32(*threads), append(poolOptions, WithHistory(3600))...)
+	waits := make([]time.Duration, len(workload))
+	start := time.Now()
+	for i, task := range workload {
+		i, task, submitted := i, task, time.Now()
+		p.SubmitTask(func() {
+			waits[i] = time.Since(submitted)
+			task()
+		})
+	}
+	p.Wait()
+	elapsed := time.Since(start)
+
+	runtime.ReadMemStats(&memAfter)
+
+	m := p.Metrics()
+	stdout := output.stdout()
+	fmt.Fprintf(stdout, "workload:          %s\n", *mix)
+	fmt.Fprintf(stdout, "max threads:       %d\n", p.maxThreads)
+	fmt.Fprintf(stdout, "elapsed:           %v\n", elapsed)
+	fmt.Fprintf(stdout, "throughput:        %.2f tasks/s\n", float64(m.TasksDone)/elapsed.Seconds())
+	fmt.Fprintf(stdout, "tasks submitted:   %d\n", m.TasksSubmitted)
+	fmt.Fprintf(stdout, "tasks done:        %d\n", m.TasksDone)
+	fmt.Fprintf(stdout, "tasks queued:      %d\n", m.TasksQueued)
+	fmt.Fprintf(stdout, "routines spawned:  %d\n", m.RoutinesSpawned)
+	fmt.Fprintf(stdout, "routines finished: %d\n", m.RoutinesFinished)
+
+	history := p.History()
+	rates := make([]float64, len(history))
+	for i, s := range history {
+		rates[i] = s.TasksPerSec
+	}
+	fmt.Fprintf(stdout, "tasks/s over time: %s\n", sparkline(rates))
+
+	if *jsonFile != "" {
+		var r BenchResult
+		r.Config.Workload = *mix
+		r.Config.Tasks = *tasks
+		r.Config.Threads = p.maxThreads
+		r.Config.Seed = *seed
+		hostInfo(&r)
+		r.Elapsed = elapsed
+		r.Throughput = float64(m.TasksDone) / elapsed.Seconds()
+		r.QueueWait = computeLatencyStats(waits)
+		r.GC.Cycles = memAfter.NumGC - memBefore.NumGC
+		r.GC.Pause = time.Duration(memAfter.PauseTotalNs - memBefore.PauseTotalNs)
+		r.GC.Allocated = memAfter.TotalAlloc - memBefore.TotalAlloc
+
+		data, err := json.MarshalIndent(&r, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(*jsonFile, append(data, '\n'), 0o644); err != nil {
+			return err
+		}
+	}
+
+	if *historyFile != "" {
+		out, err := os.Create(*historyFile)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		if err := WriteHistoryCSV(out, history); err != nil {
+			return err
+		}
+		return out.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Type of a frequent pool event which is logged subject to sampling, see WithEventLogs.
+type LogEvent int
+
+const (
+	EventTaskSubmitted LogEvent = iota
+	EventTaskQueued
+	EventWorkerCreated
+	EventWorkerStarted
+	EventWorkerFinished
+
+	logEventsCount
+)
+
+type LogSampling struct {
+	// Log only 1 in Every[event] events of each type, types which aren't set are logged every time.
+	Every map[LogEvent]uint32
+	// Maximum number of sampled events logged per second across all the types, 0 means unlimited.
+	Burst int
+}
+
+type logSampler struct {
+	every [logEventsCount]uint32
+	seen  [logEventsCount]uint32
+
+	burst       int
+	windowStart time.Time
+	logged      int
+	mu          sync.Mutex
+}
+
+// WithEventLogs enables logging of the pool events. Frequent events, which could otherwise dominate
+// the runtime of a large run, are sampled and rate limited as configured, see also SetLogSampling.
+func WithEventLogs(sampling LogSampling) Option {
+	return func(p *ThreadPool) {
+		p.logsEnabled = true
+		p.logSampler = &logSampler{burst: sampling.Burst}
+		for event, every := range sampling.Every {
+			p.SetLogSampling(event, every)
+		}
+	}
+}
+
+// SetLogSampling changes the sampling rate of an event type while the pool is running,
+// so that only 1 in every events of the type is logged. Has no effect unless the pool was created WithEventLogs.
+func (p *ThreadPool) SetLogSampling(event LogEvent, every uint32) {
+	if p.logSampler == nil || event < 0 || event >= logEventsCount {
+		return
+	}
+	atomic.StoreUint32(&p.logSampler.every[event], every)
+}
+
+// Reports whether an occurrence of a frequent event should be logged.
+func (p *ThreadPool) logEvent(event LogEvent) bool {
+	if !p.logsEnabled {
+		return false
+	}
+
+	s := p.logSampler
+	if s == nil {
+		return true
+	}
+
+	if every := atomic.LoadUint32(&s.every[event]); every > 1 {
+		if (atomic.AddUint32(&s.seen[event], 1)-1)%every != 0 {
+			return false
+		}
+	}
+
+	if s.burst <= 0 {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := p.clock.Now()
+	if now.Sub(s.windowStart) >= time.Second {
+		s.windowStart = now
+		s.logged = 0
+	}
+	if s.logged >= s.burst {
+		return false
+	}
+	s.logged++
+	return true
+}
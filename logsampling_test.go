@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Workers log concurrently with the submitting goroutine.
+type lockedBuffer struct {
+	buf bytes.Buffer
+	mu  sync.Mutex
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func TestEventLogsAreSampled(t *testing.T) {
+	var logs lockedBuffer
+	p := newTestPool(t, 0,
+		WithEventLogs(LogSampling{Every: map[LogEvent]uint32{EventTaskSubmitted: 10}}),
+		WithLogger(NewLoggerWith("debug", LoggerConfig{Out: &logs, JSON: true})))
+
+	for i := 0; i < 100; i++ {
+		p.SubmitTask(func() {})
+	}
+	p.SetLogSampling(EventTaskSubmitted, 50)
+	for i := 0; i < 100; i++ {
+		p.SubmitTask(func() {})
+	}
+	p.Wait()
+
+	assert.Equal(t, 12, strings.Count(logs.buf.String(), "task has been submitted"))
+	assert.Contains(t, logs.buf.String(), "worker started")
+}
+
+func TestEventLogsBurstLimit(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	p := newTestPool(t, 0, WithClock(clock), WithEventLogs(LogSampling{Burst: 5}))
+
+	count := func() int {
+		var n int
+		for i := 0; i < 20; i++ {
+			if p.logEvent(EventTaskSubmitted) {
+				n++
+			}
+		}
+		return n
+	}
+
+	assert.Equal(t, 5, count())
+	clock.Advance(500 * time.Millisecond)
+	assert.Zero(t, count())
+	clock.Advance(500 * time.Millisecond)
+	assert.Equal(t, 5, count())
+}
+
+func TestEventLogsDisabledByDefault(t *testing.T) {
+	p := newTestPool(t, 0)
+	assert.False(t, p.logEvent(EventTaskSubmitted))
+}
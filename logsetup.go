@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"strings"
 	"sync"
@@ -13,11 +14,28 @@ import (
 type Logger struct {
 	level  string
 	logger zerolog.Logger
+
+	// Nil if the logger was built around another writer, Sync and Close do nothing then.
+	writer    *TSWriter
+	closeOnce sync.Once
+	closeErr  error
 }
 
+// Serializes writes of the events into out. out is either the sink itself or a ConsoleWriter formatting the events for it.
 type TSWriter struct {
-	consoleWriter zerolog.ConsoleWriter
-	mu            sync.Mutex
+	out  io.Writer
+	sink io.Writer
+	mu   sync.Mutex
+}
+
+// Configures a logger created with NewLoggerWith.
+type LoggerConfig struct {
+	// Writer the logs go to, the standard output if nil.
+	Out io.Writer
+	// Write the events as JSON lines rather than in the human-readable console format, e.g. for log shippers.
+	JSON bool
+	// Run for every logged event, e.g. to count errors or forward events to another system.
+	Hooks []zerolog.Hook
 }
 
 var logLevelsMap = map[string]zerolog.Level{
@@ -34,13 +52,64 @@ var logLevelsMap = map[string]zerolog.Level{
 func (w *TSWriter) Write(p []byte) (n int, err error) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
-	return w.consoleWriter.Write(p)
+	return w.out.Write(p)
 }
 
 func (w *TSWriter) Close() error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
-	return w.consoleWriter.Close()
+	if closer, ok := w.sink.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (w *TSWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if f, buffered := w.sink.(interface{ Flush() error }); buffered {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Sync flushes the output buffered by the writer the logger writes to, if it has a Flush method (like bufio.Writer).
+// Called by Wait(), so the last lines of a run aren't lost if the process exits right after it.
+func (l *Logger) Sync() error {
+	if l.writer == nil {
+		return nil
+	}
+	return l.writer.Flush()
+}
+
+// Close flushes the output and closes the writer, unless it's the standard output or error.
+// The logger must not be used afterwards, further calls to Close return the result of the first one.
+func (l *Logger) Close() error {
+	l.closeOnce.Do(func() {
+		if l.closeErr = l.Sync(); l.closeErr != nil || l.writer == nil {
+			return
+		}
+		if out := l.writer.sink; out == os.Stdout || out == os.Stderr {
+			return
+		}
+		l.closeErr = l.writer.Close()
+	})
+	return l.closeErr
+}
+
+// WithLogOutput makes the pool log to w instead of the standard output. Buffered output is flushed by Wait(),
+// but w is not closed, see Logger.Close.
+func WithLogOutput(w io.Writer) Option {
+	return func(p *ThreadPool) {
+		p.Logger = NewLoggerWith(p.Logger.level, LoggerConfig{Out: w})
+	}
+}
+
+// WithLogger replaces the pool's logger, e.g. with one created by NewLoggerWith writing JSON or running hooks.
+func WithLogger(l *Logger) Option {
+	return func(p *ThreadPool) {
+		p.Logger = l
+	}
 }
 
 func setLogLevel(logLevel string) error {
@@ -64,6 +133,10 @@ func setLogLevel(logLevel string) error {
 // }
 
 func NewLogger(logLevel string) *Logger {
+	return NewLoggerWith(logLevel, LoggerConfig{})
+}
+
+func NewLoggerWith(logLevel string, cfg LoggerConfig) *Logger {
 	logLevel = strings.ToLower(logLevel)
 
 	if err := setLogLevel(logLevel); err != nil {
@@ -72,8 +145,32 @@ func NewLogger(logLevel string) *Logger {
 		setLogLevel("debug")
 	}
 
-	// ConsoleWriter is not thread-safe, so we have to make a wrapper around it
-	output := zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: time.RFC822}
+	if cfg.Out == nil {
+		cfg.Out = os.Stdout
+	}
+	w := &TSWriter{out: cfg.Out, sink: cfg.Out}
+	if !cfg.JSON {
+		w.out = newConsoleWriter(cfg.Out)
+	}
+
+	logger := zerolog.New(w).With().Timestamp().Logger()
+	if level, exists := logLevelsMap[logLevel]; exists {
+		logger = logger.Level(level)
+	}
+	for _, hook := range cfg.Hooks {
+		logger = logger.Hook(hook)
+	}
+
+	return &Logger{
+		level:  logLevel,
+		logger: logger,
+		writer: w,
+	}
+}
+
+// ConsoleWriter is not thread-safe, so writes into it are serialized by TSWriter.
+func newConsoleWriter(out io.Writer) zerolog.ConsoleWriter {
+	output := zerolog.ConsoleWriter{Out: out, TimeFormat: time.RFC822}
 	output.FormatLevel = func(l interface{}) string {
 		return strings.ToUpper(fmt.Sprintf("|%s|", l))
 	}
@@ -84,10 +181,5 @@ func NewLogger(logLevel string) *Logger {
 		return fmt.Sprintf("Msg: %s", msg)
 	}
 
-	l := Logger{
-		level:  logLevel,
-		logger: zerolog.New(&TSWriter{consoleWriter: output}).With().Timestamp().Logger(),
-	}
-
-	return &l
+	return output
 }
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWaitFlushesBufferedLogs(t *testing.T) {
+	var logs bytes.Buffer
+	out := bufio.NewWriter(&logs)
+	p := newTestPool(t, 1, WithLogOutput(out), WithSlowTaskLog(time.Nanosecond))
+
+	p.SubmitNamed("last", func() { time.Sleep(time.Millisecond) })
+	p.Wait()
+
+	assert.Zero(t, out.Buffered())
+	assert.Contains(t, logs.String(), "slow task")
+	assert.Contains(t, logs.String(), "last")
+}
+
+type closeCounter struct {
+	bytes.Buffer
+	closed int
+}
+
+func (c *closeCounter) Close() error {
+	c.closed++
+	return nil
+}
+
+func TestLoggerClose(t *testing.T) {
+	var out closeCounter
+	l := NewLoggerWith("debug", LoggerConfig{Out: &out})
+	l.logger.Info().Msg("summary")
+
+	assert.NoError(t, l.Close())
+	assert.NoError(t, l.Close())
+	assert.Equal(t, 1, out.closed)
+	assert.Contains(t, out.String(), "summary")
+
+	// Loggers which don't own their writer have nothing to flush or close.
+	assert.NoError(t, (&Logger{}).Close())
+}
+
+type levelCounter map[zerolog.Level]int
+
+func (c levelCounter) Run(e *zerolog.Event, level zerolog.Level, msg string) {
+	c[level]++
+}
+
+func TestLoggerJSONAndHooks(t *testing.T) {
+	var out bytes.Buffer
+	hook := levelCounter{}
+	l := NewLoggerWith("debug", LoggerConfig{Out: &out, JSON: true, Hooks: []zerolog.Hook{hook}})
+
+	l.logger.Warn().Str("task", "read-chunk-1").Msg("slow task")
+	l.logger.Info().Msg("done")
+
+	assert.Contains(t, out.String(), `"task":"read-chunk-1"`)
+	assert.Contains(t, out.String(), `"message":"slow task"`)
+	assert.Equal(t, levelCounter{zerolog.WarnLevel: 1, zerolog.InfoLevel: 1}, hook)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"runtime"
+	"runtime/debug"
+	"runtime/metrics"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Dispatch is paused once live heap exceeds this fraction of the memory limit.
+	memoryHighWatermark = 0.9
+
+	// How often live heap is sampled while dispatching tasks.
+	memoryCheckInterval = time.Millisecond
+
+	heapObjectsMetric = "/memory/classes/heap/objects:bytes"
+)
+
+type memoryGuard struct {
+	limit int64
+
+	lastCheck time.Time
+	paused    bool
+	sample    []metrics.Sample
+}
+
+// The runtime's memory limit is process-wide, so it is shared by all the running pools with a memory limit.
+var memoryLimits struct {
+	mu     sync.Mutex
+	guards []*memoryGuard
+	// Limit set before the first of the pools started, restored once the last one completes.
+	prevLimit int64
+}
+
+// WithMemoryLimit registers a soft memory limit for the Go runtime (see debug.SetMemoryLimit)
+// from the creation of the pool until Wait() returns, and pauses dispatching of new tasks while the live heap is close to it.
+// At least one task is always allowed to run, so the pool makes progress even if the limit is too low.
+// The runtime's limit is process-wide: while several such pools run, the lowest of their limits applies.
+func WithMemoryLimit(limit int64) Option {
+	return func(p *ThreadPool) {
+		p.memoryGuard = &memoryGuard{
+			limit:  limit,
+			sample: []metrics.Sample{{Name: heapObjectsMetric}},
+		}
+	}
+}
+
+// Reports whether task dispatching should be paused because of the memory pressure.
+func (p *ThreadPool) memoryPressure() bool {
+	g := p.memoryGuard
+	now := p.clock.Now()
+	if now.Sub(g.lastCheck) < memoryCheckInterval {
+		return g.paused && atomic.LoadInt32(&p.inFlight) > 0
+	}
+	g.lastCheck = now
+
+	metrics.Read(g.sample)
+	liveHeap := g.sample[0].Value.Uint64()
+	overLimit := float64(liveHeap) >= float64(g.limit)*memoryHighWatermark
+
+	if overLimit && !g.paused {
+		atomic.AddUint32(&p.metrics.memoryPauses, 1)
+		if p.logsEnabled {
+			p.logger.Info().Uint64("heap", liveHeap).Int64("limit", g.limit).Msg("memory limit approached, dispatch paused")
+		}
+	} else if !overLimit && g.paused {
+		if p.logsEnabled {
+			p.logger.Info().Uint64("heap", liveHeap).Msg("dispatch resumed")
+		}
+	}
+	g.paused = overLimit
+
+	if !g.paused {
+		return false
+	}
+
+	// Nothing is running, collect the garbage left by finished tasks and let the next task through.
+	if atomic.LoadInt32(&p.inFlight) == 0 {
+		runtime.GC()
+		return false
+	}
+	return true
+}
+
+func (g *memoryGuard) acquire() {
+	memoryLimits.mu.Lock()
+	defer memoryLimits.mu.Unlock()
+
+	if len(memoryLimits.guards) == 0 {
+		memoryLimits.prevLimit = debug.SetMemoryLimit(-1)
+	}
+	memoryLimits.guards = append(memoryLimits.guards, g)
+	setLowestMemoryLimit()
+}
+
+func (g *memoryGuard) release() {
+	memoryLimits.mu.Lock()
+	defer memoryLimits.mu.Unlock()
+
+	for i, guard := range memoryLimits.guards {
+		if guard == g {
+			memoryLimits.guards = append(memoryLimits.guards[:i], memoryLimits.guards[i+1:]...)
+			break
+		}
+	}
+
+	if len(memoryLimits.guards) == 0 {
+		debug.SetMemoryLimit(memoryLimits.prevLimit)
+		return
+	}
+	setLowestMemoryLimit()
+}
+
+// Must be called with memoryLimits.mu held and at least one guard registered.
+func setLowestMemoryLimit() {
+	limit := memoryLimits.guards[0].limit
+	for _, g := range memoryLimits.guards[1:] {
+		limit = min(limit, g.limit)
+	}
+	debug.SetMemoryLimit(limit)
+}
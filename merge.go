@@ -0,0 +1,67 @@
+package main
+
+import "container/heap"
+
+type mergeItem[T any] struct {
+	value T
+	input int
+}
+
+type mergeHeap[T any] struct {
+	items []mergeItem[T]
+	less  func(a, b T) bool
+}
+
+func (h *mergeHeap[T]) Len() int      { return len(h.items) }
+func (h *mergeHeap[T]) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *mergeHeap[T]) Push(x any)    { h.items = append(h.items, x.(mergeItem[T])) }
+func (h *mergeHeap[T]) Pop() any {
+	x := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return x
+}
+
+// Equal values are taken from the input which comes first, so the merge is stable.
+func (h *mergeHeap[T]) Less(i, j int) bool {
+	a, b := h.items[i], h.items[j]
+	if h.less(a.value, b.value) {
+		return true
+	}
+	if h.less(b.value, a.value) {
+		return false
+	}
+	return a.input < b.input
+}
+
+// MergeOrdered merges the inputs, each delivering values in the order defined by less, into a single ordered channel.
+// The output is closed once all the inputs are closed. The output has to be drained,
+// otherwise the goroutine doing the merge leaks.
+func MergeOrdered[T any](less func(a, b T) bool, ins ...<-chan T) <-chan T {
+	out := make(chan T)
+
+	go func() {
+		defer close(out)
+
+		h := &mergeHeap[T]{items: make([]mergeItem[T], 0, len(ins)), less: less}
+		for i, in := range ins {
+			if v, ok := <-in; ok {
+				h.items = append(h.items, mergeItem[T]{value: v, input: i})
+			}
+		}
+		heap.Init(h)
+
+		for h.Len() > 0 {
+			top := h.items[0]
+			out <- top.value
+
+			if v, ok := <-ins[top.input]; ok {
+				h.items[0].value = v
+				heap.Fix(h, 0)
+			} else {
+				heap.Pop(h)
+			}
+		}
+	}()
+
+	return out
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+type mergeRecord struct {
+	key    int
+	source string
+}
+
+func feed[T any](values ...T) <-chan T {
+	ch := make(chan T, len(values))
+	for _, v := range values {
+		ch <- v
+	}
+	close(ch)
+	return ch
+}
+
+func TestMergeOrdered(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	var merged []int
+	for v := range MergeOrdered(func(a, b int) bool { return a < b },
+		feed(1, 4, 9), feed[int](), feed(2, 3, 10, 11), feed(0)) {
+		merged = append(merged, v)
+	}
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 9, 10, 11}, merged)
+
+	_, open := <-MergeOrdered(func(a, b int) bool { return a < b })
+	assert.False(t, open)
+}
+
+func TestMergeOrderedIsStable(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	var merged []mergeRecord
+	for r := range MergeOrdered(func(a, b mergeRecord) bool { return a.key < b.key },
+		feed(mergeRecord{1, "a"}, mergeRecord{2, "a"}),
+		feed(mergeRecord{1, "b"}, mergeRecord{2, "b"})) {
+		merged = append(merged, r)
+	}
+	assert.Equal(t, []mergeRecord{{1, "a"}, {1, "b"}, {2, "a"}, {2, "b"}}, merged)
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/isnastish/workers_prototype/loadgen"
+)
+
+var merkleHashes = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// Leaves and internal nodes are hashed with different prefixes (as in RFC 6962),
+// so an internal node can never be passed off as a leaf.
+const (
+	merkleLeafPrefix = 0x00
+	merkleNodePrefix = 0x01
+)
+
+type merkleOptions struct {
+	chunkSize  int    // size of the data hashed into a single leaf
+	hash       string // name of the hash function, one of merkleHashes
+	maxThreads uint32 // maximum number of workers hashing chunks
+	layout     chunkLayout
+
+	poolOptions []Option
+}
+
+// A Merkle tree over fixed-size chunks of a file.
+// Levels[0] holds hashes of the chunks, every next level holds hashes of pairs of nodes of the previous one,
+// and the last level holds only the root. A node without a pair is promoted to the next level as is.
+// An empty file has a single leaf, the hash of empty data.
+// A tree over a range of a file (see the -offset and -length flags) has the Offset of the range and its Size.
+// ModTime of the file lets a later run skip re-hashing unchanged files, see the -update flag.
+type MerkleTree struct {
+	ChunkSize int           `json:"chunk_size"`
+	Hash      string        `json:"hash"`
+	Offset    int64         `json:"offset,omitempty"`
+	Size      int64         `json:"size"`
+	ModTime   time.Time     `json:"mod_time"`
+	Root      hexDigest     `json:"root"`
+	Levels    [][]hexDigest `json:"levels"`
+}
+
+// Marshaled into JSON as a hex string.
+type hexDigest []byte
+
+func (d hexDigest) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hex.EncodeToString(d))
+}
+
+func (d *hexDigest) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	b, err := hex.DecodeString(s)
+	*d = b
+	return err
+}
+
+// Hashes chunks of in on the pool, assigned to tasks according to opts.layout, and builds a Merkle tree out of them.
+func buildMerkleTree(in io.ReaderAt, size int64, opts merkleOptions) (*MerkleTree, error) {
+	newHash, exists := merkleHashes[opts.hash]
+	if !exists {
+		return nil, fmt.Errorf("%w: unknown hash function: %q", errBadArguments, opts.hash)
+	}
+
+	plan := newChunkPlan(size, opts.chunkSize)
+	leaves, err := hashLeaves(in, plan, 0, plan.count, newHash, opts)
+	if err != nil {
+		return nil, err
+	}
+	return newMerkleTree(leaves, size, opts, newHash), nil
+}
+
+// Hashes the chunks [first, last) of the plan on the pool, returns their leaves.
+func hashLeaves(in io.ReaderAt, plan chunkPlan, first, last int, newHash func() hash.Hash, opts merkleOptions) ([]hexDigest, error) {
+	leaves := make([]hexDigest, last-first)
+	err := hashChunks(in, plan, last-first, func(i int) int { return first + i }, func(i int, leaf hexDigest) {
+		leaves[i] = leaf
+	}, newHash, opts)
+	return leaves, err
+}
+
+// Hashes n chunks on the pool, the i-th of them being the chunk index(i) of the plan, and passes the leaves to store.
+func hashChunks(in io.ReaderAt, plan chunkPlan, n int, index func(i int) int, store func(i int, leaf hexDigest),
+	newHash func() hash.Hash, opts merkleOptions) error {
+	var errs []error
+	var mu sync.Mutex
+
+	p := NewPoolWithOptions(opts.maxThreads, opts.poolOptions...)
+	submitChunks(p, n, opts.layout, func(i int) {
+		offset := plan.offset(index(i))
+		buf, err := readChunkAt(in, plan.size, offset, plan.chunkSize)
+		if err != nil {
+			mu.Lock()
+			errs = append(errs, fmt.Errorf("chunk at offset %d: %w", offset, err))
+			mu.Unlock()
+			return
+		}
+		store(i, hashLeaf(newHash, buf))
+	})
+	p.Wait()
+
+	return errors.Join(errs...)
+}
+
+// Builds the levels of a tree above the leaves of all the chunks of an input, an empty input has no chunks.
+func newMerkleTree(leaves []hexDigest, size int64, opts merkleOptions, newHash func() hash.Hash) *MerkleTree {
+	if len(leaves) == 0 {
+		leaves = []hexDigest{hashLeaf(newHash, nil)}
+	}
+
+	tree := &MerkleTree{
+		ChunkSize: opts.chunkSize,
+		Hash:      opts.hash,
+		Size:      size,
+		Levels:    [][]hexDigest{leaves},
+	}
+
+	for level := leaves; len(level) > 1; {
+		next := make([]hexDigest, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				break
+			}
+			next = append(next, hashNode(newHash, level[i], level[i+1]))
+		}
+		tree.Levels = append(tree.Levels, next)
+		level = next
+	}
+	tree.Root = tree.Levels[len(tree.Levels)-1][0]
+
+	return tree
+}
+
+func hashLeaf(newHash func() hash.Hash, data []byte) hexDigest {
+	h := newHash()
+	h.Write([]byte{merkleLeafPrefix})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func hashNode(newHash func() hash.Hash, left, right []byte) hexDigest {
+	h := newHash()
+	h.Write([]byte{merkleNodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// Builds a Merkle tree of a file's chunks and writes it as JSON.
+func runMerkle(args []string) error {
+	fs := flag.NewFlagSet("merkle", flag.ContinueOnError)
+
+	input := fs.String("in", "", "File to hash")
+	outFile := fs.String("out", "", "Output file, stdout if empty")
+	chunk := fs.String("chunk", "1MiB", "Size of a chunk hashed into a single leaf")
+	hashName := fs.String("hash", "sha256", "Hash function, one of: "+merkleHashNames())
+	threads := fs.Uint("threads", 0, "Maximum number of workers, defaults to the number of CPUs")
+	layoutName := fs.String("layout", "interleaved", "Assignment of chunks to workers, one of: "+chunkLayoutNames())
+	agents := fs.String("agents", "", "Comma-separated host:port of agents hashing the chunks, the file has to be on shared storage")
+	heartbeat := fs.Duration("heartbeat", time.Second, "Interval of health checks of busy agents")
+	agentTimeout := fs.Duration("agent-timeout", 10*time.Second, "Chunks of agents not answering health checks for this long are reassigned, also the timeout of connecting to an agent")
+	update := fs.String("update", "", "Previous tree of the file, only chunks which may have changed since are re-hashed, with its -chunk and -hash")
+	dirtyRanges := fs.String("dirty", "", "With -update, comma-separated byte ranges start-end of the file known to have changed")
+	appendOnly := fs.Bool("append-only", false, "With -update, the file is only appended to, so only its new chunks are hashed")
+	byteRange := addByteRangeFlags(fs)
+	onChange := addOnChangeFlag(fs)
+	output := addOutputFlags(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%w: %s", errBadArguments, err.Error())
+	}
+
+	if *input == "" {
+		return fmt.Errorf("%w: input file is required", errBadArguments)
+	}
+
+	var hints updateHints
+	if *dirtyRanges != "" {
+		var err error
+		if hints.dirty, err = parseByteRanges(*dirtyRanges); err != nil {
+			return err
+		}
+	}
+	hints.appendOnly = *appendOnly
+	if *update == "" && (hints.dirty != nil || hints.appendOnly) {
+		return fmt.Errorf("%w: -dirty and -append-only require -update", errBadArguments)
+	}
+	if *update != "" && *agents != "" {
+		return fmt.Errorf("%w: -update can't be combined with -agents", errBadArguments)
+	}
+
+	chunkSize, err := loadgen.ParseSize(*chunk)
+	if err != nil || chunkSize == 0 {
+		return fmt.Errorf("%w: invalid chunk size: %q", errBadArguments, *chunk)
+	}
+
+	layout, err := parseChunkLayout(*layoutName)
+	if err != nil {
+		return err
+	}
+
+	policy, err := parseChangePolicy(*onChange)
+	if err != nil {
+		return err
+	}
+
+	if *heartbeat <= 0 {
+		return fmt.Errorf("%w: heartbeat interval has to be positive", errBadArguments)
+	}
+
+	poolOptions, err := output.poolOptions()
+	if err != nil {
+		return err
+	}
+
+	in, err := os.Open(*input)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	start, length, err := byteRange.resolve(info.Size())
+	if err != nil {
+		return err
+	}
+
+	opts := merkleOptions{
+		chunkSize:  chunkSize,
+		hash:       *hashName,
+		maxThreads: uint32(*threads),
+		layout:     layout,
+
+		poolOptions: poolOptions,
+	}
+
+	var prev *MerkleTree
+	if *update != "" {
+		if prev, err = readMerkleTree(*update); err != nil {
+			return err
+		}
+		if prev.Offset != start {
+			return fmt.Errorf("%w: the previous tree starts at offset %d, not %d", errBadArguments, prev.Offset, start)
+		}
+		opts.chunkSize, opts.hash = prev.ChunkSize, prev.Hash
+	}
+
+	var tree *MerkleTree
+	if prev != nil {
+		plan := newChunkPlan(length, opts.chunkSize)
+		dirty := dirtyChunks(prev, plan, start, info.ModTime(), hints)
+		fmt.Fprintf(output.warnings(), "merkle: re-hashing %d of %d chunks\n", len(dirty), plan.count)
+		tree, err = updateMerkleTree(io.NewSectionReader(in, start, length), length, prev, dirty, opts)
+	} else if *agents != "" {
+		var path string
+		if path, err = filepath.Abs(*input); err != nil {
+			return err
+		}
+		tree, err = buildMerkleTreeOnAgents(path, start, length, opts, clusterOptions{
+			agents:    strings.Split(*agents, ","),
+			heartbeat: *heartbeat,
+			timeout:   *agentTimeout,
+			warn:      output.warnings(),
+		})
+	} else {
+		tree, err = buildMerkleTree(io.NewSectionReader(in, start, length), length, opts)
+	}
+	if err != nil {
+		return err
+	}
+	tree.Offset = start
+	tree.ModTime = info.ModTime()
+
+	if err := checkUnchanged(in, versionOf(info), policy, output.warnings()); err != nil {
+		return err
+	}
+
+	out := os.Stdout
+	if *outFile != "" {
+		if out, err = os.Create(*outFile); err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+
+	return json.NewEncoder(out).Encode(tree)
+}
+
+func merkleHashNames() string {
+	var names []string
+	for name := range merkleHashes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestMerkleTree(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	const chunkSize = 100
+
+	// Five chunks, the last one is incomplete.
+	data := make([]byte, 4*chunkSize+37)
+	rand.New(rand.NewSource(0x4e11)).Read(data)
+
+	tree, err := buildMerkleTree(bytes.NewReader(data), int64(len(data)), merkleOptions{chunkSize: chunkSize, hash: "sha256", maxThreads: 4})
+	assert.NoError(t, err)
+
+	var leaves []hexDigest
+	for start := 0; start < len(data); start += chunkSize {
+		leaves = append(leaves, hashLeaf(sha256.New, data[start:min(start+chunkSize, len(data))]))
+	}
+	assert.Equal(t, leaves, tree.Levels[0])
+
+	// The fifth leaf has no pair, so it is promoted up to the level below the root.
+	n01 := hashNode(sha256.New, leaves[0], leaves[1])
+	n23 := hashNode(sha256.New, leaves[2], leaves[3])
+	n0123 := hashNode(sha256.New, n01, n23)
+	assert.Equal(t, 4, len(tree.Levels))
+	assert.Equal(t, []hexDigest{n0123, leaves[4]}, tree.Levels[2])
+	assert.Equal(t, hashNode(sha256.New, n0123, leaves[4]), tree.Root)
+
+	encoded, err := json.Marshal(tree)
+	assert.NoError(t, err)
+
+	var decoded MerkleTree
+	assert.NoError(t, json.Unmarshal(encoded, &decoded))
+	assert.Equal(t, *tree, decoded)
+}
+
+func TestMerkleTreeEmptyInputAndBadHash(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	tree, err := buildMerkleTree(bytes.NewReader(nil), 0, merkleOptions{chunkSize: 16, hash: "sha1"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(tree.Levels))
+	assert.Equal(t, tree.Levels[0][0], tree.Root)
+
+	_, err = buildMerkleTree(bytes.NewReader(nil), 0, merkleOptions{chunkSize: 16, hash: "md4"})
+	assert.ErrorIs(t, err, errBadArguments)
+}
+
+func TestMerkleTreeShortRead(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	// The input was truncated to 250 bytes after its size was measured,
+	// the last leaves hash only the bytes which were read instead of zero padding.
+	data := bytes.Repeat([]byte{0x5a}, 250)
+	tree, err := buildMerkleTree(bytes.NewReader(data), 400, merkleOptions{chunkSize: 100, hash: "sha256", maxThreads: 2})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []hexDigest{
+		hashLeaf(sha256.New, data[:100]),
+		hashLeaf(sha256.New, data[100:200]),
+		hashLeaf(sha256.New, data[200:]),
+		hashLeaf(sha256.New, nil),
+	}, tree.Levels[0])
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/isnastish/workers_prototype/loadgen"
+)
+
+// Hints about which parts of a file changed since a previous tree of it was built, see dirtyChunks.
+type updateHints struct {
+	// Ranges of the file (not of the hashed range of it) which may have changed.
+	dirty []ByteRange
+	// The file is only ever appended to.
+	appendOnly bool
+}
+
+// Returns the chunks of the plan, in ascending order, which may differ from the chunks prev was built from.
+// If the size and the modification time of the file match prev and no dirty ranges are given, no chunk changed.
+// Otherwise the chunks overlapping the dirty ranges changed, and if the size changed, so did the chunk the shorter
+// of the versions ends in and all the chunks after it. Without dirty ranges a changed file is re-hashed completely,
+// unless it is append-only.
+func dirtyChunks(prev *MerkleTree, plan chunkPlan, offset int64, modTime time.Time, hints updateHints) []int {
+	unchanged := plan.size == prev.Size && modTime.Equal(prev.ModTime)
+	if unchanged && len(hints.dirty) == 0 {
+		return nil
+	}
+
+	// The first chunk which may have changed because of the change of the size.
+	tail := plan.count
+	if plan.size != prev.Size {
+		tail = int(min(plan.size, prev.Size) / int64(plan.chunkSize))
+	}
+	if !unchanged && len(hints.dirty) == 0 && !hints.appendOnly {
+		tail = 0
+	}
+
+	dirty := make(map[int]bool)
+	for _, rng := range hints.dirty {
+		start, end := max(rng.Start-offset, 0), min(rng.End-offset, plan.size)
+		if start >= end {
+			continue
+		}
+		for i := int(start / int64(plan.chunkSize)); i < plan.count && plan.offset(i) < end; i++ {
+			dirty[i] = true
+		}
+	}
+	for i := tail; i < plan.count; i++ {
+		dirty[i] = true
+	}
+
+	var indices []int
+	for i := range dirty {
+		indices = append(indices, i)
+	}
+	sort.Ints(indices)
+	return indices
+}
+
+// Builds the tree of the input reusing the leaves of prev, except for the dirty chunks, which are re-hashed.
+func updateMerkleTree(in io.ReaderAt, size int64, prev *MerkleTree, dirty []int, opts merkleOptions) (*MerkleTree, error) {
+	newHash, exists := merkleHashes[opts.hash]
+	if !exists {
+		return nil, fmt.Errorf("%w: unknown hash function: %q", errBadArguments, opts.hash)
+	}
+
+	plan := newChunkPlan(size, opts.chunkSize)
+	leaves := make([]hexDigest, plan.count)
+	copy(leaves, prev.Levels[0][:newChunkPlan(prev.Size, prev.ChunkSize).count])
+
+	err := hashChunks(in, plan, len(dirty), func(i int) int { return dirty[i] }, func(i int, leaf hexDigest) {
+		leaves[dirty[i]] = leaf
+	}, newHash, opts)
+	if err != nil {
+		return nil, err
+	}
+	return newMerkleTree(leaves, size, opts, newHash), nil
+}
+
+// Reads a tree written by the merkle subcommand.
+func readMerkleTree(path string) (*MerkleTree, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tree MerkleTree
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if _, exists := merkleHashes[tree.Hash]; !exists || tree.ChunkSize <= 0 || tree.Size < 0 || len(tree.Levels) == 0 ||
+		len(tree.Levels[0]) < newChunkPlan(tree.Size, tree.ChunkSize).count {
+		return nil, fmt.Errorf("%s: not a valid merkle tree", path)
+	}
+	return &tree, nil
+}
+
+// Parses a comma-separated list of byte ranges start-end, e.g. "0-4KiB,1MiB-2MiB".
+func parseByteRanges(s string) ([]ByteRange, error) {
+	var ranges []ByteRange
+	for _, item := range strings.Split(s, ",") {
+		startStr, endStr, ok := strings.Cut(strings.TrimSpace(item), "-")
+		start, errStart := loadgen.ParseSize(startStr)
+		end, errEnd := loadgen.ParseSize(endStr)
+		if !ok || errStart != nil || errEnd != nil || end < start {
+			return nil, fmt.Errorf("%w: invalid byte range: %q", errBadArguments, item)
+		}
+		ranges = append(ranges, ByteRange{Start: int64(start), End: int64(end)})
+	}
+	return ranges, nil
+}
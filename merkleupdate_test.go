@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestDirtyChunks(t *testing.T) {
+	modTime := time.Date(2024, time.March, 16, 10, 0, 0, 0, time.UTC)
+	prev := &MerkleTree{ChunkSize: 100, Size: 1050, ModTime: modTime}
+	later := modTime.Add(time.Hour)
+
+	tests := []struct {
+		name    string
+		size    int64
+		offset  int64
+		modTime time.Time
+		hints   updateHints
+		want    []int
+	}{
+		{"unchanged", 1050, 0, modTime, updateHints{}, nil},
+		{"modified", 1050, 0, later, updateHints{}, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10}},
+		{"dirty ranges", 1050, 0, later, updateHints{dirty: []ByteRange{{150, 250}, {999, 1000}, {2000, 3000}}},
+			[]int{1, 2, 9}},
+		// Dirty ranges are trusted even if the metadata didn't change.
+		{"dirty ranges, same metadata", 1050, 0, modTime, updateHints{dirty: []ByteRange{{0, 1}}}, []int{0}},
+		{"dirty ranges of a grown file", 1230, 0, later, updateHints{dirty: []ByteRange{{10, 20}}}, []int{0, 10, 11, 12}},
+		{"dirty ranges of a shrunk file", 930, 0, later, updateHints{dirty: []ByteRange{{10, 20}}}, []int{0, 9}},
+		{"appended", 1230, 0, later, updateHints{appendOnly: true}, []int{10, 11, 12}},
+		{"appended at a chunk boundary", 1200, 0, later, updateHints{appendOnly: true}, []int{10, 11}},
+		{"append-only, same size", 1050, 0, later, updateHints{appendOnly: true}, nil},
+		// Dirty ranges are positions in the file, the tree covers [offset, offset+size).
+		{"range of the file", 1050, 500, later, updateHints{dirty: []ByteRange{{0, 510}, {1540, 1560}}}, []int{0, 10}},
+	}
+
+	for _, test := range tests {
+		plan := newChunkPlan(test.size, prev.ChunkSize)
+		assert.Equal(t, test.want, dirtyChunks(prev, plan, test.offset, test.modTime, test.hints), test.name)
+	}
+}
+
+func TestMerkleUpdate(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data")
+	data := make([]byte, 10*1024+100)
+	rand.New(rand.NewSource(0x1ac)).Read(data)
+	assert.NoError(t, os.WriteFile(path, data, 0o644))
+
+	merkle := func(args ...string) *MerkleTree {
+		out := filepath.Join(dir, "tree.json")
+		assert.NoError(t, runMerkle(append([]string{"-in", path, "-out", out, "-quiet"}, args...)))
+		encoded, err := os.ReadFile(out)
+		assert.NoError(t, err)
+		var tree MerkleTree
+		assert.NoError(t, json.Unmarshal(encoded, &tree))
+		return &tree
+	}
+	save := func(tree *MerkleTree) string {
+		path := filepath.Join(dir, "prev.json")
+		encoded, err := json.Marshal(tree)
+		assert.NoError(t, err)
+		assert.NoError(t, os.WriteFile(path, encoded, 0o644))
+		return path
+	}
+	touch := func(d time.Duration) {
+		info, err := os.Stat(path)
+		assert.NoError(t, err)
+		assert.NoError(t, os.Chtimes(path, info.ModTime(), info.ModTime().Add(d)))
+	}
+
+	prev := merkle("-chunk", "1KiB", "-hash", "sha512")
+	assert.Equal(t, "sha512", prev.Hash)
+
+	// Modified in place at a known position, appended to, and then both.
+	data[5000] ^= 1
+	assert.NoError(t, os.WriteFile(path, data, 0o644))
+	touch(time.Hour)
+	updated := merkle("-update", save(prev), "-dirty", "5000-5001")
+	assert.Equal(t, merkle("-chunk", "1KiB", "-hash", "sha512"), updated)
+	assert.NotEqual(t, prev.Root, updated.Root)
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	assert.NoError(t, err)
+	f.Write(bytes.Repeat([]byte("appended"), 300))
+	assert.NoError(t, f.Close())
+	touch(2 * time.Hour)
+	appended := merkle("-update", save(updated), "-append-only")
+	assert.Equal(t, merkle("-chunk", "1KiB", "-hash", "sha512"), appended)
+
+	// Nothing is re-hashed for an unchanged file, so a change that kept the size and time goes unnoticed.
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	contents, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	contents[0] ^= 1
+	assert.NoError(t, os.WriteFile(path, contents, 0o644))
+	assert.NoError(t, os.Chtimes(path, info.ModTime(), info.ModTime()))
+	assert.Equal(t, appended.Root, merkle("-update", save(appended)).Root)
+	assert.NotEqual(t, appended.Root, merkle("-chunk", "1KiB", "-hash", "sha512").Root)
+
+	// A changed file without hints is re-hashed completely.
+	touch(time.Hour)
+	assert.Equal(t, merkle("-chunk", "1KiB", "-hash", "sha512"), merkle("-update", save(appended)))
+
+	assert.ErrorIs(t, runMerkle([]string{"-in", path, "-dirty", "0-10"}), errBadArguments)
+	assert.ErrorIs(t, runMerkle([]string{"-in", path, "-update", save(prev), "-dirty", "10-0"}), errBadArguments)
+	assert.ErrorIs(t, runMerkle([]string{"-in", path, "-update", save(prev), "-offset", "1KiB", "-quiet"}), errBadArguments)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "bad.json"), []byte(`{"hash": "md5"}`), 0o644))
+	assert.ErrorContains(t, runMerkle([]string{"-in", path, "-update", filepath.Join(dir, "bad.json")}), "not a valid merkle tree")
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// Counters of the pool's events, updated atomically.
+type counters struct {
+	tasksSubmitted   uint32
+	tasksDone        uint32
+	tasksQueued      uint32
+	tasksRejected    uint32
+	tasksCancelled   uint32
+	tasksRetried     uint32
+	tasksTransferred uint32
+	slowTasks        uint32
+	batches          uint32
+	routinesSpawned  uint32
+	routinesFinished uint32
+	memoryPauses     uint32
+}
+
+// Metrics is a snapshot of the pool's counters and queues, see ThreadPool.Metrics.
+// Counters don't include the tasks of the IO workers (see WithIOWorkers).
+type Metrics struct {
+	TasksSubmitted uint32 `json:"tasks_submitted"`
+	// Tasks which started running, every attempt of a retried task is counted.
+	TasksDone uint32 `json:"tasks_done"`
+	// Tasks submitted while all the workers were busy, which had to wait for one of them to complete.
+	TasksQueued    uint32 `json:"tasks_queued"`
+	TasksRejected  uint32 `json:"tasks_rejected"`
+	TasksCancelled uint32 `json:"tasks_cancelled"`
+	TasksRetried   uint32 `json:"tasks_retried"`
+	// Tasks moved to another pool by TransferPending.
+	TasksTransferred uint32 `json:"tasks_transferred"`
+	// Tasks which ran for at least the threshold set WithSlowTaskLog.
+	SlowTasks        uint32 `json:"slow_tasks"`
+	Batches          uint32 `json:"batches"`
+	RoutinesSpawned  uint32 `json:"routines_spawned"`
+	RoutinesFinished uint32 `json:"routines_finished"`
+	MemoryPauses     uint32 `json:"memory_pauses"`
+
+	// Gauges at the time the snapshot was taken, see QueueDepths.
+	PendingDepth  int `json:"pending_depth"`
+	ReadyDepth    int `json:"ready_depth"`
+	ActiveWorkers int `json:"active_workers"`
+
+	// Time tasks spent in the pending queue, nil unless the pool was created WithQueueStats.
+	PendingQueue *QueueStats `json:"pending_queue,omitempty"`
+}
+
+// Metrics returns a snapshot of the pool's metrics. It is safe to call concurrently with running tasks.
+func (p *ThreadPool) Metrics() Metrics {
+	c := &p.metrics
+	m := Metrics{
+		TasksSubmitted:   atomic.LoadUint32(&c.tasksSubmitted),
+		TasksDone:        atomic.LoadUint32(&c.tasksDone),
+		TasksQueued:      atomic.LoadUint32(&c.tasksQueued),
+		TasksRejected:    atomic.LoadUint32(&c.tasksRejected),
+		TasksCancelled:   atomic.LoadUint32(&c.tasksCancelled),
+		TasksRetried:     atomic.LoadUint32(&c.tasksRetried),
+		TasksTransferred: atomic.LoadUint32(&c.tasksTransferred),
+		SlowTasks:        atomic.LoadUint32(&c.slowTasks),
+		Batches:          atomic.LoadUint32(&c.batches),
+		RoutinesSpawned:  atomic.LoadUint32(&c.routinesSpawned),
+		RoutinesFinished: atomic.LoadUint32(&c.routinesFinished),
+		MemoryPauses:     atomic.LoadUint32(&c.memoryPauses),
+		ActiveWorkers:    p.activeWorkers(),
+	}
+	m.PendingDepth, m.ReadyDepth = p.QueueDepths()
+	if q, instrumented := p.pendingQueue.(*InstrumentedQueue[queuedTask]); instrumented {
+		stats := q.Stats()
+		m.PendingQueue = &stats
+	}
+	return m
+}
+
+// Formats the metrics as space separated key=value pairs, suitable for a log line.
+func (m Metrics) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "submitted=%d done=%d queued=%d rejected=%d cancelled=%d retried=%d transferred=%d slow=%d batches=%d",
+		m.TasksSubmitted, m.TasksDone, m.TasksQueued, m.TasksRejected, m.TasksCancelled, m.TasksRetried,
+		m.TasksTransferred, m.SlowTasks, m.Batches)
+	fmt.Fprintf(&b, " spawned=%d finished=%d memory_pauses=%d pending=%d ready=%d active=%d",
+		m.RoutinesSpawned, m.RoutinesFinished, m.MemoryPauses, m.PendingDepth, m.ReadyDepth, m.ActiveWorkers)
+	if q := m.PendingQueue; q != nil {
+		fmt.Fprintf(&b, " wait_p50=%s wait_p95=%s wait_p99=%s", q.P50, q.P95, q.P99)
+	}
+	return b.String()
+}
+
+// Marshaled with the percentiles as duration strings, e.g. "1.5ms", which are easier to read in the logs.
+func (s QueueStats) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		P50        string  `json:"p50"`
+		P95        string  `json:"p95"`
+		P99        string  `json:"p99"`
+		MaxDepth   int     `json:"max_depth"`
+		Popped     uint64  `json:"popped"`
+		Throughput float64 `json:"throughput"`
+	}{s.P50.String(), s.P95.String(), s.P99.String(), s.MaxDepth, s.Popped, s.Throughput})
+}
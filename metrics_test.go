@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsSnapshot(t *testing.T) {
+	p := newTestPool(t, 1, WithSlowTaskLog(time.Millisecond), WithLogger(NewLoggerWith("debug", LoggerConfig{JSON: true, Out: io.Discard})))
+	dst := newTestPool(t, 0)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	p.SubmitTask(func() {
+		close(started)
+		<-release
+		time.Sleep(time.Millisecond)
+	})
+	<-started
+
+	p.SubmitTask(func() {})
+	p.SubmitTask(func() {})
+	assert.Equal(t, 2, p.TransferPending(dst))
+
+	m := p.Metrics()
+	assert.EqualValues(t, 3, m.TasksSubmitted)
+	assert.EqualValues(t, 2, m.TasksQueued)
+	assert.EqualValues(t, 2, m.TasksTransferred)
+	assert.Equal(t, 1, m.ActiveWorkers)
+	assert.Nil(t, m.PendingQueue)
+
+	close(release)
+	p.Wait()
+	dst.Wait()
+
+	m = p.Metrics()
+	assert.EqualValues(t, 1, m.TasksDone)
+	assert.EqualValues(t, 1, m.SlowTasks)
+	assert.Equal(t, 0, m.ActiveWorkers)
+	assert.EqualValues(t, 2, dst.Metrics().TasksDone)
+}
+
+func TestMetricsFormatting(t *testing.T) {
+	m := Metrics{TasksSubmitted: 3, TasksDone: 2, PendingDepth: 1}
+	assert.Equal(t, "submitted=3 done=2 queued=0 rejected=0 cancelled=0 retried=0 transferred=0 slow=0 batches=0 "+
+		"spawned=0 finished=0 memory_pauses=0 pending=1 ready=0 active=0", m.String())
+
+	data, err := json.Marshal(m)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"tasks_submitted":3`)
+	assert.Contains(t, string(data), `"pending_depth":1`)
+	assert.NotContains(t, string(data), "pending_queue")
+
+	m.PendingQueue = &QueueStats{P50: 1500 * time.Microsecond, P95: 2 * time.Millisecond, P99: time.Second, Popped: 5}
+	assert.Contains(t, m.String(), "wait_p50=1.5ms wait_p95=2ms wait_p99=1s")
+
+	data, err = json.Marshal(m)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"pending_queue":{"p50":"1.5ms","p95":"2ms","p99":"1s","max_depth":0,"popped":5,"throughput":0}`)
+}
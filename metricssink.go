@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Receives the pool's metrics, so they can be bridged to an existing telemetry stack, see WithMetricsSink.
+// Implementations must be safe for concurrent use, they are called by the workers and the dispatcher.
+type MetricsSink interface {
+	// Adds delta to a monotonic counter.
+	Counter(name string, delta float64)
+	// Sets the current value of a gauge.
+	Gauge(name string, value float64)
+	// Records an observation, durations are in seconds.
+	Histogram(name string, value float64)
+}
+
+// Metrics reported by the pool.
+const (
+	MetricTasksSubmitted = "workerpool_tasks_submitted_total"
+	MetricTasksCompleted = "workerpool_tasks_completed_total"
+	MetricTaskDuration   = "workerpool_task_duration_seconds"
+	MetricTaskQueueWait  = "workerpool_task_queue_wait_seconds"
+	MetricQueueDepth     = "workerpool_queue_depth"
+	MetricActiveWorkers  = "workerpool_active_workers"
+
+	// Reported by HTTPMiddleware.
+	MetricHTTPRequests = "workerpool_http_requests_total"
+	MetricHTTPRejected = "workerpool_http_rejected_total"
+)
+
+// How often the gauges are reported, see WithMetricsSink.
+const metricsInterval = time.Second
+
+// WithMetricsSink reports the number of submitted and completed tasks, their durations and queue waits to sink,
+// and the queue depth and the number of active workers once per second. Tasks of the IO workers are not reported.
+func WithMetricsSink(sink MetricsSink) Option {
+	return func(p *ThreadPool) {
+		p.metricsSink = sink
+	}
+}
+
+// Reports the gauges if a metrics interval passed since they were last reported, or unconditionally if force is set.
+func (p *ThreadPool) reportGauges(force bool) {
+	now := p.clock.Now()
+	if !force && now.Sub(p.metricsLastTick) < metricsInterval {
+		return
+	}
+	p.metricsLastTick = now
+
+	pending, ready := p.QueueDepths()
+
+	p.metricsSink.Gauge(MetricQueueDepth, float64(pending+ready))
+	p.metricsSink.Gauge(MetricActiveWorkers, float64(p.activeWorkers()))
+}
+
+// Discards all the metrics.
+type NopMetricsSink struct{}
+
+func (NopMetricsSink) Counter(name string, delta float64)   {}
+func (NopMetricsSink) Gauge(name string, value float64)     {}
+func (NopMetricsSink) Histogram(name string, value float64) {}
+
+// Upper bounds of the histogram buckets used by NewPrometheusSink unless others are given, suitable for durations.
+var DefaultPrometheusBuckets = []float64{.0001, .001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Keeps the metrics in memory and exposes them in the Prometheus text format, see WriteTo and ServeHTTP.
+type PrometheusSink struct {
+	buckets    []float64
+	counters   map[string]float64
+	gauges     map[string]float64
+	histograms map[string]*promHistogram
+	mu         sync.Mutex
+}
+
+type promHistogram struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// Creates a sink with histograms of the given bucket bounds, DefaultPrometheusBuckets if none are given.
+// The bounds are copied, sorted and deduplicated.
+func NewPrometheusSink(buckets ...float64) *PrometheusSink {
+	if len(buckets) == 0 {
+		buckets = DefaultPrometheusBuckets
+	}
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+	buckets = slices.Compact(buckets)
+
+	return &PrometheusSink{
+		buckets:    buckets,
+		counters:   make(map[string]float64),
+		gauges:     make(map[string]float64),
+		histograms: make(map[string]*promHistogram),
+	}
+}
+
+func (s *PrometheusSink) Counter(name string, delta float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counters[name] += delta
+}
+
+func (s *PrometheusSink) Gauge(name string, value float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gauges[name] = value
+}
+
+func (s *PrometheusSink) Histogram(name string, value float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h := s.histograms[name]
+	if h == nil {
+		h = &promHistogram{counts: make([]uint64, len(s.buckets))}
+		s.histograms[name] = h
+	}
+	if i := sort.SearchFloat64s(s.buckets, value); i < len(s.buckets) {
+		h.counts[i]++
+	}
+	h.sum += value
+	h.count++
+}
+
+// Writes all the metrics in the Prometheus text exposition format, ordered by name.
+func (s *PrometheusSink) WriteTo(w io.Writer) (int64, error) {
+	s.mu.Lock()
+	var buf bytes.Buffer
+	for _, name := range sortedKeys(s.counters) {
+		fmt.Fprintf(&buf, "# TYPE %s counter\n%s %s\n", name, name, formatPromValue(s.counters[name]))
+	}
+	for _, name := range sortedKeys(s.gauges) {
+		fmt.Fprintf(&buf, "# TYPE %s gauge\n%s %s\n", name, name, formatPromValue(s.gauges[name]))
+	}
+	for _, name := range sortedKeys(s.histograms) {
+		h := s.histograms[name]
+		fmt.Fprintf(&buf, "# TYPE %s histogram\n", name)
+		var cumulative uint64
+		for i, bound := range s.buckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(&buf, "%s_bucket{le=\"%s\"} %d\n", name, formatPromValue(bound), cumulative)
+		}
+		fmt.Fprintf(&buf, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+		fmt.Fprintf(&buf, "%s_sum %s\n%s_count %d\n", name, formatPromValue(h.sum), name, h.count)
+	}
+	s.mu.Unlock()
+
+	return buf.WriteTo(w)
+}
+
+// Serves the metrics to a Prometheus scraper, e.g. with http.Handle("/metrics", sink).
+func (s *PrometheusSink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	s.WriteTo(w)
+}
+
+func formatPromValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
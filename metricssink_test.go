@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrometheusSinkFormat(t *testing.T) {
+	s := NewPrometheusSink(0.1, 1)
+	s.Counter("requests_total", 2)
+	s.Counter("requests_total", 1)
+	s.Gauge("depth", 7)
+	s.Gauge("depth", 4)
+	s.Histogram("latency_seconds", 0.05)
+	s.Histogram("latency_seconds", 0.5)
+	s.Histogram("latency_seconds", 3)
+
+	var out strings.Builder
+	_, err := s.WriteTo(&out)
+	assert.NoError(t, err)
+	assert.Equal(t, `# TYPE requests_total counter
+requests_total 3
+# TYPE depth gauge
+depth 4
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 1
+latency_seconds_bucket{le="1"} 2
+latency_seconds_bucket{le="+Inf"} 3
+latency_seconds_sum 3.55
+latency_seconds_count 3
+`, out.String())
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, out.String(), rec.Body.String())
+	assert.Contains(t, rec.Header().Get("Content-Type"), "version=0.0.4")
+}
+
+func TestPrometheusSinkCopiesBuckets(t *testing.T) {
+	buckets := []float64{1, 0.1, 1}
+	s := NewPrometheusSink(buckets...)
+	buckets[0] = 100
+
+	s.Histogram("latency_seconds", 0.05)
+	s.Histogram("latency_seconds", 0.5)
+
+	var out strings.Builder
+	_, err := s.WriteTo(&out)
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), `latency_seconds_bucket{le="0.1"} 1
+latency_seconds_bucket{le="1"} 2
+latency_seconds_bucket{le="+Inf"} 2
+`)
+}
+
+func TestPoolReportsToMetricsSink(t *testing.T) {
+	const tasksCount = 50
+
+	sink := NewPrometheusSink()
+	p := newTestPool(t, 0, WithMetricsSink(sink))
+	for i := 0; i < tasksCount; i++ {
+		p.SubmitTask(func() {})
+	}
+	p.Wait()
+
+	assert.Equal(t, float64(tasksCount), sink.counters[MetricTasksSubmitted])
+	assert.Equal(t, float64(tasksCount), sink.counters[MetricTasksCompleted])
+	assert.Equal(t, uint64(tasksCount), sink.histograms[MetricTaskDuration].count)
+	assert.Equal(t, uint64(tasksCount), sink.histograms[MetricTaskQueueWait].count)
+
+	// The gauges are reported once more after the last task completed.
+	assert.Zero(t, sink.gauges[MetricQueueDepth])
+	assert.Zero(t, sink.gauges[MetricActiveWorkers])
+}
@@ -0,0 +1,15 @@
+package main
+
+import "errors"
+
+// Panic value for a second call to Wait, which is otherwise a no-op.
+var errWaitCalledTwice = errors.New("Wait was called more than once")
+
+// Reports a misuse of the API. Builds with the workerpool_strict tag panic right away to fail fast in development,
+// other builds return err to the caller. A nil err is returned as is.
+func misuse(err error) error {
+	if err != nil && strictMode {
+		panic(err)
+	}
+	return err
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/isnastish/workers_prototype/pkg/container"
+)
+
+type Option func(*ThreadPool)
+
+type Scheduling int
+
+const (
+	// Tasks run in the order they were submitted.
+	FIFO Scheduling = iota
+	// The most recently submitted tasks run first.
+	LIFO
+)
+
+type TaskClass int
+
+const (
+	CPUBound TaskClass = iota
+	IOBound
+)
+
+// WithCPUWorkers limits the number of workers running CPU-bound tasks, clamped to the number of CPUs.
+func WithCPUWorkers(n uint32) Option {
+	return func(p *ThreadPool) {
+		p.maxThreads = clampToCPU(n)
+		p.threadLimit = p.maxThreads
+	}
+}
+
+// WithMinWorkers spawns n workers when the pool is created, which stay alive waiting for tasks until Wait() is called,
+// so submitted tasks don't have to wait for a worker to be spawned. n is clamped to the maximum number of workers.
+func WithMinWorkers(n uint32) Option {
+	return func(p *ThreadPool) {
+		p.minWorkers = n
+	}
+}
+
+// Setting the environment variable to a true value (see strconv.ParseBool) forces the sequential mode
+// for every pool, without changing the code creating them.
+const SequentialEnv = "WORKERPOOL_SEQUENTIAL"
+
+// WithSequential runs all the tasks on a single worker in strict submission order, including IO-bound ones.
+// Meant for debugging, it eliminates nondeterminism caused by concurrent execution of tasks. Options which reorder
+// tasks, like LIFO scheduling, fairness, batching or sharded queues, have no effect then. Tasks still run on
+// the worker's goroutine rather than in the goroutine which submitted them, so SubmitTask never blocks.
+func WithSequential() Option {
+	return func(p *ThreadPool) {
+		p.sequential = true
+	}
+}
+
+func sequentialFromEnv() bool {
+	sequential, _ := strconv.ParseBool(os.Getenv(SequentialEnv))
+	return sequential
+}
+
+// Overrides the options which allow tasks to run concurrently or out of order.
+func (p *ThreadPool) makeSequential() {
+	p.maxThreads = 1
+	p.threadLimit = 1
+	p.scheduling = FIFO
+	p.fair = false
+	p.batcher = nil
+	p.queueShards = 0
+	p.autoscaler = nil
+	p.ioPool = nil
+}
+
+// WithSlowTaskLog logs a warning for every task which took at least threshold to run once it completes,
+// including its name (see SubmitNamed), the ID of the worker and how long the task waited in the queues.
+// Slow tasks are logged even if the pool's logs are disabled.
+func WithSlowTaskLog(threshold time.Duration) Option {
+	return func(p *ThreadPool) {
+		p.slowTaskThreshold = threshold
+	}
+}
+
+// WithCPUAffinity pins the OS thread of every worker to a distinct CPU, which benefits cache-sensitive CPU-bound tasks.
+// Supported on Linux only, elsewhere the option has no effect. Pinned threads exit together with their workers,
+// so the option pays off for long running workers, e.g. combined with WithMinWorkers.
+func WithCPUAffinity(pin bool) Option {
+	return func(p *ThreadPool) {
+		p.cpus = nil
+		if pin {
+			p.cpus = allowedCPUs()
+		}
+	}
+}
+
+// WithIOWorkers creates a separate set of up to n workers for tasks submitted as IOBound.
+// Since IO-bound tasks spend most of the time blocked, n is not limited by the number of CPUs.
+func WithIOWorkers(n uint32) Option {
+	return func(p *ThreadPool) {
+		p.ioPool = newThreadPool(max(n, 1))
+		p.ioPool.cpuPool = p
+	}
+}
+
+// WithQueueStats records how long tasks wait in the pending queue,
+// the statistics are reported by Metrics(). Has no effect with LIFO scheduling.
+func WithQueueStats() Option {
+	return func(p *ThreadPool) {
+		p.queueStats = true
+	}
+}
+
+// WithShardedQueues splits the pending queue tasks are submitted to into shards
+// with separate locks (see ShardedQueue), which reduces lock contention when many goroutines submit small tasks.
+// Tasks start roughly, not exactly, in the order of submission. Values below 1 mean one shard per CPU.
+// Has no effect with LIFO scheduling, fairness or queue stats.
+func WithShardedQueues(shards int) Option {
+	return func(p *ThreadPool) {
+		if shards < 1 {
+			shards = runtime.GOMAXPROCS(0)
+		}
+		p.queueShards = shards
+	}
+}
+
+// WithScheduling sets the order in which submitted tasks are executed.
+// LIFO improves cache locality and latency for depth-first, divide-and-conquer workloads.
+func WithScheduling(s Scheduling) Option {
+	return func(p *ThreadPool) {
+		p.scheduling = s
+	}
+}
+
+// Adapts a thread-safe stack to the interface of the pool's pending queue.
+type taskStack struct {
+	*container.Stack[queuedTask]
+}
+
+func (s taskStack) Push(task queuedTask) error {
+	s.Stack.Push(task)
+	return nil
+}
+
+// Creates the pending queue of the pool according to the configured options.
+func (p *ThreadPool) initQueues() {
+	switch {
+	case p.scheduling == LIFO:
+		p.pendingQueue = taskStack{container.NewSyncStack[queuedTask]()}
+	case p.fair:
+		p.pendingQueue = newFairQueue()
+	case p.queueStats:
+		p.pendingQueue = NewInstrumentedQueue[queuedTask]()
+	case p.queueShards != 0:
+		p.pendingQueue = NewShardedQueue[queuedTask](p.queueShards)
+	}
+}
+
+// Scaling decisions are made once per interval based on the amount of pending tasks.
+type autoscaler struct {
+	minThreads uint32
+	interval   time.Duration
+	ticks      int
+
+	lastTick    time.Time
+	lastBacklog int
+	growing     int
+	idle        int
+}
+
+// WithAutoscaling starts the pool with minThreads workers and scales the worker limit
+// up to maxThreads if the backlog of pending tasks didn't shrink for ticks consecutive intervals,
+// and back down towards minThreads once the backlog stays empty for the same amount of intervals.
+func WithAutoscaling(minThreads uint32, interval time.Duration, ticks int) Option {
+	return func(p *ThreadPool) {
+		p.autoscaler = &autoscaler{
+			minThreads: max(minThreads, 1),
+			interval:   interval,
+			ticks:      max(ticks, 1),
+		}
+	}
+}
+
+// Computes the worker limit for the next interval given the current one and the amount of pending tasks.
+func (a *autoscaler) nextLimit(limit, maxThreads uint32, backlog int) uint32 {
+	switch {
+	case backlog > 0 && backlog >= a.lastBacklog:
+		a.growing++
+		a.idle = 0
+	case backlog == 0:
+		a.idle++
+		a.growing = 0
+	default:
+		a.growing = 0
+		a.idle = 0
+	}
+	a.lastBacklog = backlog
+
+	if a.growing >= a.ticks && limit < maxThreads {
+		a.growing = 0
+		return limit + 1
+	}
+
+	if a.idle >= a.ticks && limit > a.minThreads {
+		a.idle = 0
+		return limit - 1
+	}
+
+	return limit
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// Flags controlling what a command prints, shared by the crawler and the subcommands.
+type outputFlags struct {
+	quiet    *bool
+	logLevel *string
+}
+
+func addOutputFlags(fs *flag.FlagSet) outputFlags {
+	return outputFlags{
+		quiet:    fs.Bool("quiet", false, "Print nothing but errors, the exit code reports the outcome"),
+		logLevel: fs.String("log-level", "", "Log pool events to stderr at this level: trace, debug, info, warning or error"),
+	}
+}
+
+// Validates the flags and returns the options which make the command's pools log as requested.
+// -quiet can't be combined with a level below error, since it promises nothing but errors.
+func (f outputFlags) poolOptions() ([]Option, error) {
+	if *f.logLevel == "" {
+		return nil, nil
+	}
+
+	name := strings.ToLower(*f.logLevel)
+	level, exists := logLevelsMap[name]
+	if !exists {
+		return nil, fmt.Errorf("%w: unknown log level: %q", errBadArguments, *f.logLevel)
+	}
+	if *f.quiet && level < zerolog.ErrorLevel {
+		return nil, fmt.Errorf("%w: -quiet conflicts with -log-level %s", errBadArguments, name)
+	}
+
+	// Logs go to stderr, so they never mix with the results written to stdout.
+	options := []Option{WithLogger(NewLoggerWith(name, LoggerConfig{Out: os.Stderr}))}
+	if level <= zerolog.InfoLevel {
+		// Pool events are frequent, keep them from dominating the runtime of big inputs.
+		options = append(options, WithEventLogs(LogSampling{Burst: 100}))
+	}
+	return options, nil
+}
+
+// Returns the writer for the non-error output of the command, which is discarded in quiet mode.
+func (f outputFlags) stdout() io.Writer {
+	if *f.quiet {
+		return io.Discard
+	}
+	return os.Stdout
+}
+
+// Returns the writer for warnings, which are discarded in quiet mode.
+func (f outputFlags) warnings() io.Writer {
+	if *f.quiet {
+		return io.Discard
+	}
+	return os.Stderr
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func parseOutputFlags(t *testing.T, args ...string) outputFlags {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	f := addOutputFlags(fs)
+	assert.NoError(t, fs.Parse(args))
+	return f
+}
+
+func TestOutputFlags(t *testing.T) {
+	f := parseOutputFlags(t)
+	options, err := f.poolOptions()
+	assert.NoError(t, err)
+	assert.Empty(t, options)
+	assert.Equal(t, os.Stdout, f.stdout())
+
+	f = parseOutputFlags(t, "-quiet")
+	assert.Equal(t, io.Discard, f.stdout())
+	assert.Equal(t, io.Discard, f.warnings())
+
+	f = parseOutputFlags(t, "-quiet", "-log-level", "error")
+	options, err = f.poolOptions()
+	assert.NoError(t, err)
+	assert.Len(t, options, 1)
+
+	f = parseOutputFlags(t, "-log-level", "INFO")
+	options, err = f.poolOptions()
+	assert.NoError(t, err)
+	p := newTestPool(t, 1, options...)
+	assert.True(t, p.logsEnabled)
+
+	_, err = parseOutputFlags(t, "-quiet", "-log-level", "debug").poolOptions()
+	assert.ErrorIs(t, err, errBadArguments)
+
+	_, err = parseOutputFlags(t, "-log-level", "loud").poolOptions()
+	assert.ErrorIs(t, err, errBadArguments)
+}
+
+func TestSubcommandsAcceptOutputFlags(t *testing.T) {
+	for _, name := range []string{"loadtest", "sort", "diff", "compare", "download", "archive", "merkle"} {
+		// Parsing stops at the first unknown flag, so the output flags must have been accepted.
+		err := subcommands[name]([]string{"-quiet", "-log-level", "error", "-no-such-flag"})
+		assert.ErrorIs(t, err, errBadArguments, name)
+		assert.ErrorContains(t, err, "-no-such-flag", name)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Asks the kernel to drop the cached pages of the file (posix_fadvise POSIX_FADV_DONTNEED).
+// Doesn't require any privileges, but pages which are dirty or mapped by other processes stay cached.
+func evictFromPageCache(f *os.File) error {
+	return unix.Fadvise(int(f.Fd()), 0, 0, unix.FADV_DONTNEED)
+}
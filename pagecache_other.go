@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "os"
+
+func evictFromPageCache(f *os.File) error {
+	return errEvictUnsupported
+}
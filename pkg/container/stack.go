@@ -0,0 +1,133 @@
+// Package container provides generic containers shared by the thread pool and its examples.
+package container
+
+import (
+	"errors"
+	"sync"
+)
+
+// Minimum capacity allocated on the first Push.
+const minCap = 64
+
+var ErrStackEmpty = errors.New("stack is empty")
+
+// Stack is a generic LIFO container. The zero value is an empty stack ready to use,
+// which is not safe for concurrent use, use NewSyncStack to get a thread-safe one.
+type Stack[T any] struct {
+	count int
+	data  []T
+	mu    *sync.Mutex
+}
+
+// Creates a stack which is safe for concurrent use.
+func NewSyncStack[T any]() *Stack[T] {
+	return &Stack[T]{mu: &sync.Mutex{}}
+}
+
+func (s *Stack[T]) lock() {
+	if s.mu != nil {
+		s.mu.Lock()
+	}
+}
+
+func (s *Stack[T]) unlock() {
+	if s.mu != nil {
+		s.mu.Unlock()
+	}
+}
+
+// Push element of type T into the stack
+func (s *Stack[T]) Push(v T) {
+	s.lock()
+	defer s.unlock()
+
+	if s.count == cap(s.data) {
+		newCap := max(cap(s.data)<<1, minCap)
+		newData := make([]T, newCap)
+		copy(newData, s.data[:s.count])
+		s.data = newData
+	}
+	s.data[s.count] = v
+	s.count++
+}
+
+// Check if the stack is empty
+func (s *Stack[T]) Empty() bool {
+	s.lock()
+	defer s.unlock()
+	return s.count == 0
+}
+
+// Retrieve stack size
+func (s *Stack[T]) Size() int {
+	s.lock()
+	defer s.unlock()
+	return s.count
+}
+
+// If stack is not empty, pops the last element and assignes it to v, returns true.
+// false otherwise.
+func (s *Stack[T]) TryPop(v *T) bool {
+	s.lock()
+	defer s.unlock()
+
+	if s.count == 0 {
+		return false
+	}
+	*v = s.pop()
+	return true
+}
+
+// Pops the last element, returns ErrStackEmpty if there is none.
+func (s *Stack[T]) Pop() (T, error) {
+	s.lock()
+	defer s.unlock()
+
+	if s.count == 0 {
+		var zeroElement T
+		return zeroElement, ErrStackEmpty
+	}
+	return s.pop(), nil
+}
+
+// Returns the last element without removing it, returns ErrStackEmpty if there is none.
+func (s *Stack[T]) Peek() (T, error) {
+	s.lock()
+	defer s.unlock()
+
+	if s.count == 0 {
+		var zeroElement T
+		return zeroElement, ErrStackEmpty
+	}
+	return s.data[s.count-1], nil
+}
+
+// Removes all the elements, keeping the allocated memory.
+func (s *Stack[T]) Clear() {
+	s.lock()
+	defer s.unlock()
+
+	clear(s.data[:s.count])
+	s.count = 0
+}
+
+// Calls fn for every element from the top of the stack to the bottom, until fn returns false.
+// fn must not call methods of the stack.
+func (s *Stack[T]) Range(fn func(v T) bool) {
+	s.lock()
+	defer s.unlock()
+
+	for i := s.count - 1; i >= 0; i-- {
+		if !fn(s.data[i]) {
+			return
+		}
+	}
+}
+
+func (s *Stack[T]) pop() T {
+	v := s.data[s.count-1]
+	var zeroElement T
+	s.data[s.count-1] = zeroElement
+	s.count--
+	return v
+}
@@ -0,0 +1,82 @@
+package container
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStack_PushPop(t *testing.T) {
+	var s Stack[string]
+	assert.True(t, s.Empty())
+
+	for i := 0; i < 3*minCap; i++ {
+		s.Push("push_N:" + strconv.Itoa(i))
+	}
+	assert.Equal(t, 3*minCap, s.Size())
+
+	top, err := s.Peek()
+	assert.NoError(t, err)
+	assert.Equal(t, "push_N:"+strconv.Itoa(3*minCap-1), top)
+
+	for i := 3*minCap - 1; i >= 0; i-- {
+		v, err := s.Pop()
+		assert.NoError(t, err)
+		assert.Equal(t, "push_N:"+strconv.Itoa(i), v)
+	}
+
+	_, err = s.Pop()
+	assert.ErrorIs(t, err, ErrStackEmpty)
+	_, err = s.Peek()
+	assert.ErrorIs(t, err, ErrStackEmpty)
+
+	var v string
+	assert.False(t, s.TryPop(&v))
+}
+
+func TestStack_ClearAndRange(t *testing.T) {
+	var s Stack[int]
+	for i := 0; i < 8; i++ {
+		s.Push(i)
+	}
+
+	var visited []int
+	s.Range(func(v int) bool {
+		visited = append(visited, v)
+		return v > 5
+	})
+	assert.Equal(t, []int{7, 6, 5}, visited)
+
+	s.Clear()
+	assert.True(t, s.Empty())
+	assert.Equal(t, make([]int, cap(s.data)), s.data)
+}
+
+func TestStack_ConcurrentPush(t *testing.T) {
+	const N = 1 << 12
+	const routines = 8
+
+	s := NewSyncStack[int]()
+	wg := sync.WaitGroup{}
+	for r := 0; r < routines; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < N; i++ {
+				s.Push(i)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, N*routines, s.Size())
+
+	sum := 0
+	var v int
+	for s.TryPop(&v) {
+		sum += v
+	}
+	assert.Equal(t, routines*N*(N-1)/2, sum)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+// Creates a pool which is closed with Wait() once the test or benchmark completes,
+// after which the test fails if any goroutines leaked.
+// Wait() can still be called by the test itself, the pool isn't waited for again then.
+func newTestPool(tb testing.TB, maxThreads uint32, options ...Option) *ThreadPool {
+	p := NewPoolWithOptions(maxThreads, options...)
+	tb.Cleanup(func() {
+		if atomic.LoadInt32(&p.waiting) == 0 {
+			p.Wait()
+		}
+		verifyNoLeaks(tb)
+	})
+	return p
+}
+
+func verifyNoLeaks(tb testing.TB) {
+	if _, benchmark := tb.(*testing.B); benchmark {
+		// goleak doesn't work correctly with benchmarks.
+		// This is the workaround to avoid goleak panicing on goroutines on top of the stack.
+		// https://github.com/uber-go/goleak/issues/77
+		goleak.VerifyNone(tb,
+			goleak.IgnoreTopFunction("testing.(*B).run1"),
+			goleak.IgnoreTopFunction("testing.(*B).doBench"),
+		)
+		return
+	}
+	goleak.VerifyNone(tb)
+}
+
+// Asserts that the closed pool executed all the submitted tasks and all of its workers have finished.
+func assertAllTasksDone(tb testing.TB, p *ThreadPool, tasksCount uint32) {
+	tb.Helper()
+
+	m := p.Metrics()
+	assert.Equal(tb, tasksCount, m.TasksSubmitted)
+	assert.Equal(tb, tasksCount, m.TasksDone)
+	assert.Equal(tb, m.RoutinesSpawned, m.RoutinesFinished)
+
+	assert.True(tb, p.pendingQueue.Empty())
+	assert.Empty(tb, p.readyCh)
+}
+
+// Skips tests asserting errors returned on API misuse, which panics in builds with the workerpool_strict tag.
+func skipInStrictMode(tb testing.TB) {
+	if strictMode {
+		tb.Skip("API misuse panics in strict mode")
+	}
+}
@@ -8,16 +8,48 @@ import (
 // Minimum default capacity.
 const minCap = 64
 
+// GrowthPolicy computes the new capacity of a full queue from the current one.
+type GrowthPolicy func(cap int) int
+
+// Doubles the capacity, the default policy.
+func GrowDouble(cap int) int {
+	return cap << 1
+}
+
+// Grows the capacity by 50%, wastes less memory for big queues.
+func GrowOneAndHalf(cap int) int {
+	return cap + cap>>1
+}
+
+// Grows the capacity by a fixed amount of elements.
+func GrowBy(n int) GrowthPolicy {
+	return func(cap int) int {
+		return cap + n
+	}
+}
+
 type Queue[T any] struct {
-	front int
-	back  int
-	count int
-	cap   int
-	buf   []T
-	mu    sync.Mutex
+	front  int
+	back   int
+	count  int
+	cap    int
+	maxCap int
+	growth GrowthPolicy
+	buf    []T
+	mu     sync.Mutex
 }
 
 func NewQueue[T any](size ...int) *Queue[T] {
+	return NewQueueWithPolicy[T](GrowDouble, 0, size...)
+}
+
+// Creates a queue which grows according to the growth policy and never exceeds maxCap elements.
+// maxCap equal to 0 means the queue is unbounded, a nil growth policy means GrowDouble.
+func NewQueueWithPolicy[T any](growth GrowthPolicy, maxCap int, size ...int) *Queue[T] {
+	if growth == nil {
+		growth = GrowDouble
+	}
+
 	var cap int
 	var buf []T
 	if len(size) > 0 {
@@ -26,12 +58,17 @@ func NewQueue[T any](size ...int) *Queue[T] {
 		} else {
 			cap = int(ceilPow2(uint32(size[0])))
 		}
+		if maxCap > 0 {
+			cap = min(cap, maxCap)
+		}
 		buf = make([]T, cap)
 	}
 
 	return &Queue[T]{
-		cap: cap,
-		buf: buf,
+		cap:    cap,
+		maxCap: maxCap,
+		growth: growth,
+		buf:    buf,
 	}
 }
 
@@ -59,14 +96,19 @@ func (q *Queue[T]) Left() int {
 	return q.cap - q.count
 }
 
-func (q *Queue[T]) Push(item T) {
+// Returns ErrQueueFull if the queue reached its maximum capacity.
+func (q *Queue[T]) Push(item T) error {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
-	q.grow()
+	if !q.grow() {
+		return ErrQueueFull
+	}
 	q.buf[q.back] = item
 	q.back = q.nextIndex(q.back)
 	q.count++
+
+	return nil
 }
 
 func (q *Queue[T]) TryPop(value *T) bool {
@@ -86,68 +128,113 @@ func (q *Queue[T]) TryPop(value *T) bool {
 	return true
 }
 
-func (q *Queue[T]) Pop() T {
+func (q *Queue[T]) Pop() (T, error) {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
+	var zeroValue T
+
 	if q.count == 0 {
-		panic("Cannot Pop on empty queue.")
+		return zeroValue, misuse(ErrQueueEmpty)
 	}
 
-	var zeroValue T
-
 	res := q.buf[q.front]
 	q.buf[q.front] = zeroValue
 	q.front = q.nextIndex(q.front)
 	q.count--
 
-	return res
+	return res, nil
 }
 
-func (q *Queue[T]) Front() T {
+func (q *Queue[T]) Front() (T, error) {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
 	if q.count == 0 {
-		panic("Cannot retrieve Front element on empty queue.")
+		var zeroValue T
+		return zeroValue, misuse(ErrQueueEmpty)
 	}
 
-	return q.buf[q.front]
+	return q.buf[q.front], nil
 }
 
-func (q *Queue[T]) Back() T {
+func (q *Queue[T]) Back() (T, error) {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
 	if q.count == 0 {
-		panic("Cannot retrieve Back element on empty queue.")
+		var zeroValue T
+		return zeroValue, misuse(ErrQueueEmpty)
 	}
 
 	if q.back == 0 {
-		return q.buf[q.count-1]
+		return q.buf[q.cap-1], nil
 	}
 
-	return q.buf[q.back-1]
+	return q.buf[q.back-1], nil
 }
 
-func (q *Queue[T]) Replace(index int, elem T) {
+func (q *Queue[T]) Replace(index int, elem T) error {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
 	if q.count == 0 {
-		panic("Cannot replace, queue is empty.")
+		return misuse(ErrQueueEmpty)
 	}
 
-	if index >= q.count {
-		panic(fmt.Sprintf("Cannot replace element at index [%d]. Index out of range.", index))
+	if index < 0 || index >= q.count {
+		return misuse(fmt.Errorf("cannot replace element at index [%d]: %w", index, ErrIndexOutOfRange))
 	}
 
+	q.buf[q.position(index)] = elem
+	return nil
+}
+
+// Returns the index (relative to the front) of the first element satisfying pred.
+func (q *Queue[T]) Find(pred func(T) bool) (int, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
 	pos := q.front
-	for i := 0; i < index; i++ {
+	for i := 0; i < q.count; i++ {
+		if pred(q.buf[pos]) {
+			return i, true
+		}
 		pos = q.nextIndex(pos)
 	}
+	return -1, false
+}
+
+// Removes the element at index (relative to the front), elements behind it are shifted towards the front.
+func (q *Queue[T]) RemoveAt(index int) (T, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var zeroValue T
+
+	if q.count == 0 {
+		return zeroValue, misuse(ErrQueueEmpty)
+	}
+
+	if index < 0 || index >= q.count {
+		return zeroValue, misuse(fmt.Errorf("cannot remove element at index [%d]: %w", index, ErrIndexOutOfRange))
+	}
 
-	q.buf[pos] = elem
+	pos := q.position(index)
+	res := q.buf[pos]
+
+	for i := index; i < q.count-1; i++ {
+		next := q.nextIndex(pos)
+		q.buf[pos] = q.buf[next]
+		pos = next
+	}
+
+	// pos now refers to the last element, which became the new back.
+	q.buf[pos] = zeroValue
+	q.back = pos
+	q.count--
+
+	return res, nil
 }
 
 func (q *Queue[T]) Clear() {
@@ -161,32 +248,73 @@ func (q *Queue[T]) Clear() {
 	q.zeroMemebers()
 }
 
-func (q *Queue[T]) Flush(res []T) {
+// Moves up to len(res) elements from the front of the queue into res and returns the number of elements moved.
+// A nil res drains the whole queue, discarding the elements.
+func (q *Queue[T]) Flush(res []T) int {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
-	if q.count == 0 || res == nil {
-		return
+	n := q.count
+	if res != nil {
+		n = min(n, len(res))
 	}
 
-	if q.back > q.front {
-		copy(res, q.buf[q.front:q.back])
-	} else {
-		nCopied := copy(res, q.buf[q.front:q.cap])
-		copy(res[nCopied:], q.buf[0:q.back])
+	var zeroValue T
+	for i := 0; i < n; i++ {
+		if res != nil {
+			res[i] = q.buf[q.front]
+		}
+		q.buf[q.front] = zeroValue
+		q.front = q.nextIndex(q.front)
+	}
+	q.count -= n
+
+	if q.count == 0 {
+		q.front = 0
+		q.back = 0
+	}
+
+	return n
+}
+
+// Drains the queue calling fn for every element in order under a single lock, returns the number of elements drained.
+// fn must not call methods of the queue.
+func (q *Queue[T]) DrainTo(fn func(T)) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	n := q.count
+	pos := q.front
+	for i := 0; i < n; i++ {
+		fn(q.buf[pos])
+		pos = q.nextIndex(pos)
 	}
 
 	q.zeroMemebers()
+
+	return n
 }
 
-func (q *Queue[T]) grow() {
+// Makes room for one more element, returns false if the queue cannot grow past its maximum capacity.
+func (q *Queue[T]) grow() bool {
 	if q.cap == 0 {
 		q.cap = minCap
+		if q.maxCap > 0 {
+			q.cap = min(q.cap, q.maxCap)
+		}
 		q.buf = make([]T, q.cap)
 	}
 
 	if q.count >= q.cap {
-		newCap := q.cap << 1
+		if q.maxCap > 0 && q.cap >= q.maxCap {
+			return false
+		}
+
+		// Always grow by at least one element, so a policy returning the same capacity cannot break Push.
+		newCap := max(q.growth(q.cap), q.cap+1)
+		if q.maxCap > 0 {
+			newCap = min(newCap, q.maxCap)
+		}
 		newBuf := make([]T, newCap)
 
 		if q.back > q.front {
@@ -201,6 +329,13 @@ func (q *Queue[T]) grow() {
 		q.back = q.count
 		q.front = 0
 	}
+
+	return true
+}
+
+// Converts an index relative to the front into a position in the buffer.
+func (q *Queue[T]) position(index int) int {
+	return (q.front + index) % q.cap
 }
 
 func (q *Queue[T]) nextIndex(index int) int {
@@ -211,9 +346,7 @@ func (q *Queue[T]) nextIndex(index int) int {
 }
 
 func (q *Queue[T]) zeroMemebers() {
-	// Think about how we can avoid doing memory allocation.
-	zeroBuf := make([]T, q.count)
-	copy(q.buf, zeroBuf)
+	clear(q.buf)
 
 	q.front = 0
 	q.back = 0
@@ -25,11 +25,19 @@ func pushN[T any](q *Queue[T], n int, f func(int) T) []T {
 func popN[T any](q *Queue[T], n int) []T {
 	res := make([]T, n)
 	for i := 0; i < n; i++ {
-		res[i] = q.Pop()
+		res[i] = must(q.Pop())
 	}
 	return res
 }
 
+// Unwrap the value returned by queue accessors, panics if an error occurred.
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
 func TestQueue_CreationNoCapacity(t *testing.T) {
 	q := NewQueue[string]()
 
@@ -108,17 +116,17 @@ func TestQueue_PushPop(t *testing.T) {
 
 	pushN(q, N, func(i int) string { return "push_N:" + strconv.Itoa(i) })
 
-	assert.Equal(t, q.Front(), "push_N:0")
-	assert.Equal(t, q.Back(), "push_N:7")
+	assert.Equal(t, must(q.Front()), "push_N:0")
+	assert.Equal(t, must(q.Back()), "push_N:7")
 
-	assert.Equal(t, q.Pop(), "push_N:0")
-	assert.Equal(t, q.Pop(), "push_N:1")
-	assert.Equal(t, q.Pop(), "push_N:2")
-	assert.Equal(t, q.Pop(), "push_N:3")
-	assert.Equal(t, q.Pop(), "push_N:4")
-	assert.Equal(t, q.Pop(), "push_N:5")
+	assert.Equal(t, must(q.Pop()), "push_N:0")
+	assert.Equal(t, must(q.Pop()), "push_N:1")
+	assert.Equal(t, must(q.Pop()), "push_N:2")
+	assert.Equal(t, must(q.Pop()), "push_N:3")
+	assert.Equal(t, must(q.Pop()), "push_N:4")
+	assert.Equal(t, must(q.Pop()), "push_N:5")
 
-	assert.Equal(t, q.Front(), "push_N:6")
+	assert.Equal(t, must(q.Front()), "push_N:6")
 }
 
 func TestQueue_PopN(t *testing.T) {
@@ -185,7 +193,7 @@ func TestQueue_WrapFrontIndex(t *testing.T) {
 
 	assert.EqualValues(t, q.front, N-2)
 	assert.EqualValues(t, q.back, 0)
-	assert.Equal(t, q.Front(), 128)
+	assert.Equal(t, must(q.Front()), 128)
 
 	// After push:
 	// [4 8 16 32, 0, 0, 128, 256]
@@ -193,7 +201,7 @@ func TestQueue_WrapFrontIndex(t *testing.T) {
 	//            back   front
 	pushN(q, N/2, func(i int) int { return 2 << (i + 1) })
 
-	assert.EqualValues(t, q.Back(), 32)
+	assert.EqualValues(t, must(q.Back()), 32)
 	assert.EqualValues(t, q.Left(), 2)
 
 	// After pop the front index will wrap:
@@ -204,8 +212,8 @@ func TestQueue_WrapFrontIndex(t *testing.T) {
 
 	assert.EqualValues(t, q.front, N-5)
 	assert.EqualValues(t, q.Size(), 1)
-	assert.EqualValues(t, q.Front(), 32)
-	assert.EqualValues(t, q.Back(), q.Front())
+	assert.EqualValues(t, must(q.Front()), 32)
+	assert.EqualValues(t, must(q.Back()), must(q.Front()))
 }
 
 func TestQueue_IsEmpty(t *testing.T) {
@@ -376,33 +384,54 @@ func TestQueue_Clear(t *testing.T) {
 	assert.ElementsMatch(t, q.buf, make([]int, minCap))
 }
 
-func TestQueue_ReplaceOnEmptyQueueShouldPanic(t *testing.T) {
+func TestQueue_ReplaceOnEmptyQueue(t *testing.T) {
+	skipInStrictMode(t)
+
 	const N = 4
 	q := NewQueue[string](N)
 
-	defer func() {
-		r := recover()
-		assert.True(t, r != nil)
-	}()
-
-	q.Replace(0, "NewString")
+	assert.ErrorIs(t, q.Replace(0, "NewString"), ErrQueueEmpty)
 }
 
 func TestQueue_ReplaceIndexOutOfRange(t *testing.T) {
+	skipInStrictMode(t)
+
 	const N = 4
 	q := NewQueue[string](N)
 
-	defer func() {
-		r := recover()
-		assert.True(t, r != nil)
-	}()
-
 	q.Push("push_n:0")
 	q.Push("push_n:1")
 
 	assert.Equal(t, q.count, 2)
 
-	q.Replace(3, "push_n:9999")
+	assert.ErrorIs(t, q.Replace(3, "push_n:9999"), ErrIndexOutOfRange)
+}
+
+func TestQueue_AccessEmptyQueue(t *testing.T) {
+	skipInStrictMode(t)
+
+	q := NewQueue[int]()
+
+	_, err := q.Pop()
+	assert.ErrorIs(t, err, ErrQueueEmpty)
+
+	_, err = q.Front()
+	assert.ErrorIs(t, err, ErrQueueEmpty)
+
+	_, err = q.Back()
+	assert.ErrorIs(t, err, ErrQueueEmpty)
+}
+
+func TestQueue_BackAfterWrappingNotFull(t *testing.T) {
+	const N = 4
+	q := NewQueue[int](N)
+
+	pushN(q, N, func(i int) int { return i })
+	popN(q, N-1)
+
+	// back index wrapped to 0, while the only element left is at the end of the buffer.
+	assert.EqualValues(t, q.back, 0)
+	assert.Equal(t, must(q.Back()), N-1)
 }
 
 func TestQueue_ReplaceNoWrapping(t *testing.T) {
@@ -416,7 +445,7 @@ func TestQueue_ReplaceNoWrapping(t *testing.T) {
 	assert.Equal(t, q.buf[q.front], 10<<1)
 
 	q.Replace(N-1, 12<<1)
-	assert.Equal(t, q.Back(), 12<<1)
+	assert.Equal(t, must(q.Back()), 12<<1)
 }
 
 func TestQueue_ReplaceWithWrapping(t *testing.T) {
@@ -440,5 +469,165 @@ func TestQueue_ReplaceWithWrapping(t *testing.T) {
 	fmt.Println(q.buf)
 
 	q.Replace(q.count-1, 15<<1)
-	assert.Equal(t, 15<<1, q.Back())
+	assert.Equal(t, 15<<1, must(q.Back()))
+}
+
+func TestQueue_Find(t *testing.T) {
+	const N = 8
+	q := NewQueue[int](N)
+
+	// Wrap the front so the searched element is located before it in the buffer.
+	pushN(q, N, func(i int) int { return i })
+	popN(q, N-2)
+	pushN(q, 3, func(i int) int { return 100 + i })
+
+	index, found := q.Find(func(v int) bool { return v == 101 })
+	assert.True(t, found)
+	assert.Equal(t, 3, index)
+
+	index, found = q.Find(func(v int) bool { return v > 1000 })
+	assert.False(t, found)
+	assert.Equal(t, -1, index)
+}
+
+func TestQueue_RemoveAtWithWrapping(t *testing.T) {
+	skipInStrictMode(t)
+
+	const N = 8
+	q := NewQueue[int](N)
+
+	// [100, 101, 102, 0, 0, 0, 6, 7]
+	//                |        |
+	//               back    front
+	pushN(q, N, func(i int) int { return i })
+	popN(q, N-2)
+	pushN(q, 3, func(i int) int { return 100 + i })
+
+	v, err := q.RemoveAt(1)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, v)
+
+	// [101, 102, 0, 0, 0, 0, 6, 100]
+	//            |           |
+	//           back       front
+	assert.Equal(t, 4, q.Size())
+	assert.EqualValues(t, 2, q.back)
+	assert.Equal(t, []int{6, 100, 101, 102}, popN(q, 4))
+
+	_, err = q.RemoveAt(0)
+	assert.ErrorIs(t, err, ErrQueueEmpty)
+}
+
+func TestQueue_RemoveAtFrontAndBack(t *testing.T) {
+	skipInStrictMode(t)
+
+	const N = 4
+	q := NewQueue[string](N)
+
+	pushN(q, N, func(i int) string { return "push_N:" + strconv.Itoa(i) })
+
+	assert.Equal(t, "push_N:0", must(q.RemoveAt(0)))
+	assert.Equal(t, "push_N:3", must(q.RemoveAt(q.Size()-1)))
+	assert.Equal(t, "push_N:1", must(q.Front()))
+	assert.Equal(t, "push_N:2", must(q.Back()))
+
+	_, err := q.RemoveAt(2)
+	assert.ErrorIs(t, err, ErrIndexOutOfRange)
+}
+
+func TestQueue_GrowthPolicies(t *testing.T) {
+	const N = 16
+	{
+		q := NewQueueWithPolicy[int](GrowOneAndHalf, 0, N)
+		pushN(q, N+1, func(i int) int { return i })
+		assert.Equal(t, N+N/2, q.Cap())
+	}
+
+	{
+		q := NewQueueWithPolicy[int](GrowBy(4), 0, N)
+		res := pushN(q, N+5, func(i int) int { return i })
+		assert.Equal(t, N+8, q.Cap())
+		assert.Equal(t, res, popN(q, N+5))
+	}
+
+	{
+		// A policy which doesn't grow still makes room for a single element.
+		q := NewQueueWithPolicy[int](func(cap int) int { return cap }, 0, N)
+		pushN(q, N+1, func(i int) int { return i })
+		assert.Equal(t, N+1, q.Cap())
+	}
+
+	{
+		// No policy means doubling.
+		q := NewQueueWithPolicy[int](nil, 0, N)
+		pushN(q, N+1, func(i int) int { return i })
+		assert.Equal(t, 2*N, q.Cap())
+	}
+}
+
+func TestQueue_MaxCapacity(t *testing.T) {
+	const maxCap = 24
+	q := NewQueueWithPolicy[int](GrowDouble, maxCap, 16)
+
+	pushN(q, maxCap, func(i int) int { return i })
+	assert.Equal(t, maxCap, q.Cap())
+
+	assert.ErrorIs(t, q.Push(maxCap), ErrQueueFull)
+	assert.Equal(t, maxCap, q.Size())
+
+	// Space freed by Pop can be reused.
+	popN(q, 1)
+	assert.NoError(t, q.Push(maxCap))
+
+	// Default capacity is clamped to the maximum.
+	q = NewQueueWithPolicy[int](GrowDouble, 8)
+	pushN(q, 8, func(i int) int { return i })
+	assert.Equal(t, 8, q.Cap())
+	assert.ErrorIs(t, q.Push(8), ErrQueueFull)
+}
+
+func TestQueue_FlushPartially(t *testing.T) {
+	const N = 8
+	q := NewQueue[int](N)
+
+	pushN(q, N, func(i int) int { return i })
+	popN(q, N/2)
+	pushN(q, N/2, func(i int) int { return N + i })
+
+	res := make([]int, 3)
+	assert.Equal(t, 3, q.Flush(res))
+	assert.Equal(t, []int{4, 5, 6}, res)
+	assert.Equal(t, N-3, q.Size())
+
+	// The remaining elements are kept in order.
+	res = make([]int, N)
+	assert.Equal(t, N-3, q.Flush(res))
+	assert.Equal(t, []int{7, 8, 9, 10, 11}, res[:N-3])
+	assert.True(t, q.Empty())
+	assert.Equal(t, 0, q.Flush(res))
+}
+
+func TestQueue_FlushNilDiscards(t *testing.T) {
+	q := NewQueue[string]()
+	pushN(q, 10, func(i int) string { return strconv.Itoa(i) })
+
+	assert.Equal(t, 10, q.Flush(nil))
+	assert.True(t, q.Empty())
+	assert.ElementsMatch(t, q.buf, make([]string, minCap))
+}
+
+func TestQueue_DrainTo(t *testing.T) {
+	const N = 4
+	q := NewQueue[int](N)
+
+	pushN(q, N, func(i int) int { return i })
+	popN(q, 2)
+	expected := append([]int{2, 3}, pushN(q, 2, func(i int) int { return 10 + i })...)
+
+	var drained []int
+	assert.Equal(t, N, q.DrainTo(func(v int) { drained = append(drained, v) }))
+	assert.Equal(t, expected, drained)
+	assert.True(t, q.Empty())
+	assert.EqualValues(t, 0, q.front)
+	assert.EqualValues(t, 0, q.back)
 }
@@ -0,0 +1,45 @@
+package main
+
+import "sync"
+
+// ReducingPool runs tasks producing values of type T and folds them into an aggregate of type A.
+type ReducingPool[T, A any] struct {
+	pool   *ThreadPool
+	reduce func(A, T) A
+
+	mu  sync.Mutex
+	acc A
+}
+
+// Creates a pool which combines results of all the tasks with reduce, starting from init.
+// The order in which results are reduced is unspecified, so reduce should be commutative and associative.
+func NewReducingPool[T, A any](reduce func(A, T) A, init A, numThreads ...uint32) *ReducingPool[T, A] {
+	return &ReducingPool[T, A]{
+		pool:   NewPool(numThreads...),
+		reduce: reduce,
+		acc:    init,
+	}
+}
+
+func (r *ReducingPool[T, A]) Submit(task func() T) error {
+	if task == nil {
+		return misuse(ErrNilTask)
+	}
+
+	return r.pool.SubmitTask(func() {
+		v := task()
+
+		r.mu.Lock()
+		r.acc = r.reduce(r.acc, v)
+		r.mu.Unlock()
+	})
+}
+
+// Waits for all the tasks to complete and returns the final aggregate.
+func (r *ReducingPool[T, A]) Wait() A {
+	r.pool.Wait()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.acc
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestReducingPool_ChunkSum(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	const dataSize = 4099
+	const chunkSize = 256
+
+	data := make([]int64, dataSize)
+	expected := populate(data, func(i int) int64 { return int64((i + 1) << 1) })
+
+	r := NewReducingPool(func(acc int64, v int64) int64 { return acc + v }, 0, 8)
+	for start := 0; start < dataSize; start += chunkSize {
+		chunk := data[start:min(start+chunkSize, dataSize)]
+		r.Submit(func() int64 {
+			var sum int64
+			for _, v := range chunk {
+				sum += v
+			}
+			return sum
+		})
+	}
+
+	assert.Equal(t, expected, r.Wait())
+}
+
+func TestReducingPool_WordCount(t *testing.T) {
+	skipInStrictMode(t)
+
+	defer goleak.VerifyNone(t)
+
+	lines := []string{
+		"Red lazy fox jumped over the long wooden fance",
+		"Green fatty frog was sitting near the old lake",
+	}
+
+	r := NewReducingPool(func(acc map[string]int, words []string) map[string]int {
+		for _, w := range words {
+			acc[w]++
+		}
+		return acc
+	}, map[string]int{})
+
+	for _, line := range lines {
+		line := line
+		r.Submit(func() []string { return strings.Fields(line) })
+	}
+	assert.ErrorIs(t, r.Submit(nil), ErrNilTask)
+
+	counts := r.Wait()
+	assert.Equal(t, 2, counts["the"])
+	assert.Equal(t, 1, counts["fox"])
+	assert.Len(t, counts, 17)
+}
+
+// T16xC16 - 16 threads involved to compute sum of 16 chunks
+func BenchmarkReducingAccumulate_T16xC16(b *testing.B) {
+	const maxThreads = 16
+	const chunkSize = 256
+	const dataSize = 4096
+
+	data := make([]int64, dataSize)
+	_ = populate(data, func(i int) int64 { return int64((i + 1) << 1) })
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		r := NewReducingPool(func(acc int64, v int64) int64 { return acc + v }, 0, maxThreads)
+		for start := 0; start < dataSize; start += chunkSize {
+			chunk := data[start : start+chunkSize]
+			r.Submit(func() int64 {
+				var sum int64
+				for _, v := range chunk {
+					sum += v
+				}
+				return sum
+			})
+		}
+		r.Wait()
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import "sync/atomic"
+
+type RejectReason int
+
+const (
+	// The task was submitted after Wait() was called and all the earlier submitted tasks completed.
+	RejectPoolClosed RejectReason = iota
+	// The circuit breaker of the task's group was open.
+	RejectCircuitOpen
+)
+
+func (r RejectReason) String() string {
+	switch r {
+	case RejectPoolClosed:
+		return "pool closed"
+	case RejectCircuitOpen:
+		return "circuit open"
+	}
+	return "unknown"
+}
+
+// Describes a rejected task, Task runs it, so the task can be resubmitted to another pool or persisted.
+type TaskInfo struct {
+	Name  string
+	Group string
+	Task  func()
+}
+
+// WithOnRejected registers a callback invoked for every task the pool rejects instead of running it.
+// The callback runs synchronously in the goroutine which submitted the task, before the submission returns an error.
+func WithOnRejected(fn func(task TaskInfo, reason RejectReason)) Option {
+	return func(p *ThreadPool) {
+		p.onRejected = fn
+	}
+}
+
+func (p *ThreadPool) reject(task queuedTask, reason RejectReason) {
+	atomic.AddUint32(&p.metrics.tasksRejected, 1)
+
+	if p.onRejected == nil {
+		return
+	}
+
+	info := TaskInfo{Name: task.name, Group: task.group, Task: task.fn}
+	if task.ctxFn != nil {
+		ctxFn, ctx := task.ctxFn, task.ctx
+		info.Task = func() { ctxFn(ctx) }
+	}
+	p.onRejected(info, reason)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOnRejectedReceivesRejectedTasks(t *testing.T) {
+	var rejected []TaskInfo
+	var reasons []RejectReason
+	var mu sync.Mutex
+
+	p := newTestPool(t, 2,
+		WithCircuitBreaker(BreakerConfig{ErrorRate: 1, MinTasks: 1, Window: time.Minute, Cooldown: time.Minute}),
+		WithOnRejected(func(task TaskInfo, reason RejectReason) {
+			mu.Lock()
+			defer mu.Unlock()
+			rejected = append(rejected, task)
+			reasons = append(reasons, reason)
+		}),
+	)
+
+	assert.NoError(t, p.SubmitGroup("dead-endpoint", func() error { return errors.New("connection refused") }))
+	assert.Eventually(t, func() bool {
+		return !p.breaker.allow("dead-endpoint", time.Now())
+	}, time.Second, time.Millisecond)
+
+	var rerun uint32
+	assert.ErrorIs(t, p.SubmitGroup("dead-endpoint", func() error {
+		atomic.AddUint32(&rerun, 1)
+		return nil
+	}), ErrCircuitOpen)
+
+	p.Wait()
+
+	assert.ErrorIs(t, p.SubmitNamed("late", func() { atomic.AddUint32(&rerun, 1) }), ErrPoolClosed)
+	assert.ErrorIs(t, p.SubmitTaskCtx(context.Background(), func(context.Context) { atomic.AddUint32(&rerun, 1) }), ErrPoolClosed)
+
+	assert.Equal(t, []RejectReason{RejectCircuitOpen, RejectPoolClosed, RejectPoolClosed}, reasons)
+	assert.Equal(t, "dead-endpoint", rejected[0].Group)
+	assert.Equal(t, "late", rejected[1].Name)
+	assert.EqualValues(t, 3, p.Metrics().TasksRejected)
+
+	// Rejected tasks can be run elsewhere.
+	for _, task := range rejected {
+		task.Task()
+	}
+	assert.EqualValues(t, 3, atomic.LoadUint32(&rerun))
+}
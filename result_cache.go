@@ -0,0 +1,133 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Future holds the result of a task which is computed asynchronously.
+type Future[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+// Blocks until the result is available.
+func (f *Future[V]) Wait() (V, error) {
+	<-f.done
+	return f.value, f.err
+}
+
+type cacheEntry[K comparable, V any] struct {
+	future  *Future[V]
+	expires time.Time // zero while the result is being computed
+	elem    *list.Element
+}
+
+// ResultCache deduplicates tasks computing the same key: results are kept for ttl
+// and at most maxEntries of them are stored, evicting the oldest ones.
+type ResultCache[K comparable, V any] struct {
+	ttl        time.Duration
+	maxEntries int
+	clock      Clock
+
+	mu      sync.Mutex
+	entries map[K]*cacheEntry[K, V]
+	order   *list.List // keys in insertion order, the oldest at the front
+}
+
+func NewResultCache[K comparable, V any](ttl time.Duration, maxEntries int) *ResultCache[K, V] {
+	return &ResultCache[K, V]{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		clock:      realClock{},
+		entries:    make(map[K]*cacheEntry[K, V]),
+		order:      list.New(),
+	}
+}
+
+// Returns the cached result for the key, if it was computed successfully and hasn't expired yet.
+func (c *ResultCache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, exists := c.entries[key]
+	if !exists || e.expires.IsZero() || !c.clock.Now().Before(e.expires) {
+		var zeroValue V
+		return zeroValue, false
+	}
+	return e.future.value, true
+}
+
+func (c *ResultCache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// SubmitOnce submits the task computing the key to the pool, unless the result for the key
+// is cached or is being computed already, in which case the existing result is returned without scheduling.
+// Failed results are not cached, so the next submission with the same key runs the task again.
+func (c *ResultCache[K, V]) SubmitOnce(p *ThreadPool, key K, task func() (V, error)) (*Future[V], error) {
+	if task == nil {
+		return nil, misuse(ErrNilTask)
+	}
+
+	c.mu.Lock()
+
+	if e, exists := c.entries[key]; exists {
+		if e.expires.IsZero() || c.clock.Now().Before(e.expires) {
+			c.mu.Unlock()
+			return e.future, nil
+		}
+		c.remove(key, e)
+	}
+
+	f := &Future[V]{done: make(chan struct{})}
+	e := &cacheEntry[K, V]{future: f, elem: c.order.PushBack(key)}
+	c.entries[key] = e
+
+	for len(c.entries) > c.maxEntries && c.maxEntries > 0 {
+		oldest := c.order.Front().Value.(K)
+		c.remove(oldest, c.entries[oldest])
+	}
+
+	// Submitted without holding the lock, a rejection callback may use the cache.
+	c.mu.Unlock()
+
+	err := p.SubmitTask(func() {
+		f.value, f.err = task()
+
+		c.mu.Lock()
+		if c.entries[key] == e {
+			if f.err != nil {
+				c.remove(key, e)
+			} else {
+				e.expires = c.clock.Now().Add(c.ttl)
+			}
+		}
+		c.mu.Unlock()
+
+		close(f.done)
+	})
+	if err != nil {
+		c.mu.Lock()
+		if c.entries[key] == e {
+			c.remove(key, e)
+		}
+		c.mu.Unlock()
+
+		// Callers which got the future in the meantime get the error too.
+		f.err = err
+		close(f.done)
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (c *ResultCache[K, V]) remove(key K, e *cacheEntry[K, V]) {
+	c.order.Remove(e.elem)
+	delete(c.entries, key)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestResultCache_DeduplicatesSubmissions(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	var executed uint32
+
+	p := NewPool(4)
+	c := NewResultCache[string, int](time.Minute, 16)
+
+	fetch := func() (int, error) {
+		atomic.AddUint32(&executed, 1)
+		time.Sleep(5 * time.Millisecond)
+		return 42, nil
+	}
+
+	futures := make([]*Future[int], 8)
+	for i := range futures {
+		f, err := c.SubmitOnce(p, "https://python.org/static/style.css", fetch)
+		assert.NoError(t, err)
+		futures[i] = f
+	}
+
+	for _, f := range futures {
+		v, err := f.Wait()
+		assert.NoError(t, err)
+		assert.Equal(t, 42, v)
+	}
+
+	v, cached := c.Get("https://python.org/static/style.css")
+	assert.True(t, cached)
+	assert.Equal(t, 42, v)
+
+	p.Wait()
+	assert.EqualValues(t, 1, atomic.LoadUint32(&executed))
+}
+
+func TestResultCache_ExpirationAndEviction(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	var executed uint32
+
+	p := NewPool(2)
+	c := NewResultCache[int, int](10*time.Millisecond, 2)
+	clock := NewFakeClock(time.Now())
+	c.clock = clock
+
+	square := func(k int) func() (int, error) {
+		return func() (int, error) {
+			atomic.AddUint32(&executed, 1)
+			return k * k, nil
+		}
+	}
+
+	for k := 0; k < 3; k++ {
+		f, _ := c.SubmitOnce(p, k, square(k))
+		f.Wait()
+	}
+
+	// The oldest key was evicted.
+	assert.Equal(t, 2, c.Len())
+	_, cached := c.Get(0)
+	assert.False(t, cached)
+
+	clock.Advance(10 * time.Millisecond)
+	_, cached = c.Get(2)
+	assert.False(t, cached)
+
+	f, _ := c.SubmitOnce(p, 2, square(2))
+	v, _ := f.Wait()
+	assert.Equal(t, 4, v)
+
+	p.Wait()
+	assert.EqualValues(t, 4, atomic.LoadUint32(&executed))
+}
+
+func TestResultCache_ErrorsAreNotCached(t *testing.T) {
+	skipInStrictMode(t)
+
+	defer goleak.VerifyNone(t)
+
+	errFetch := errors.New("fetch failed")
+
+	p := NewPool(2)
+	c := NewResultCache[string, string](time.Minute, 0)
+
+	f, err := c.SubmitOnce(p, "key", func() (string, error) { return "", errFetch })
+	assert.NoError(t, err)
+	_, err = f.Wait()
+	assert.ErrorIs(t, err, errFetch)
+	assert.Equal(t, 0, c.Len())
+
+	f, _ = c.SubmitOnce(p, "key", func() (string, error) { return "value", nil })
+	v, err := f.Wait()
+	assert.NoError(t, err)
+	assert.Equal(t, "value", v)
+
+	p.Wait()
+
+	_, err = c.SubmitOnce(p, "other", func() (string, error) { return "", nil })
+	assert.ErrorIs(t, err, ErrPoolClosed)
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestResultCache_RejectionCallbackUsesCache(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	c := NewResultCache[string, string](time.Minute, 0)
+
+	// The callback runs while SubmitOnce is in progress, the cache must not be locked by then.
+	var cached int
+	p := NewPoolWithOptions(1, WithOnRejected(func(TaskInfo, RejectReason) { cached = c.Len() }))
+	p.Wait()
+
+	_, err := c.SubmitOnce(p, "key", func() (string, error) { return "value", nil })
+	assert.ErrorIs(t, err, ErrPoolClosed)
+	assert.Equal(t, 1, cached)
+	assert.Equal(t, 0, c.Len())
+}
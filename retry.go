@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+type RetryPolicy struct {
+	// Maximum number of attempts including the first one, values below 1 mean a single attempt.
+	MaxAttempts int
+	// Delay before the second attempt, doubled for every following attempt up to MaxBackoff.
+	// MaxBackoff caps delays requested with RetryAfter as well.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Called once the task succeeded or gave up, with the last error and the number of attempts made.
+	OnDone func(err error, attempts int)
+}
+
+// Returns the delay before the attempt following the given one.
+func (r RetryPolicy) backoff(attempt int) time.Duration {
+	d := r.Backoff
+	for i := 1; i < attempt && (r.MaxBackoff <= 0 || d < r.MaxBackoff); i++ {
+		d *= 2
+	}
+	if r.MaxBackoff > 0 {
+		d = min(d, r.MaxBackoff)
+	}
+	return d
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks an error returned by a task submitted with SubmitRetry as not worth retrying.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+type retryAfterError struct {
+	err   error
+	delay time.Duration
+}
+
+func (e *retryAfterError) Error() string { return e.err.Error() }
+func (e *retryAfterError) Unwrap() error { return e.err }
+
+// RetryAfter makes the next attempt of a task submitted with SubmitRetry run after the given delay
+// instead of the policy's backoff, for example when a server asked to come back later.
+func RetryAfter(err error, delay time.Duration) error {
+	return &retryAfterError{err: err, delay: delay}
+}
+
+// SubmitRetry submits a task which is submitted again after a backoff if it returns an error,
+// until it succeeds, returns a Permanent error, runs out of attempts or ctx is done.
+// The attempt number is available with AttemptFromContext. Wait doesn't return while a retry is scheduled.
+func (p *ThreadPool) SubmitRetry(ctx context.Context, policy RetryPolicy, task func(ctx context.Context) error) error {
+	if task == nil {
+		return misuse(ErrNilTask)
+	}
+
+	var run func(ctx context.Context)
+	run = func(taskCtx context.Context) {
+		attempt, _ := AttemptFromContext(taskCtx)
+		err := task(taskCtx)
+
+		var permanent *permanentError
+		if err == nil || errors.As(err, &permanent) || attempt >= policy.MaxAttempts || ctx.Err() != nil {
+			if policy.OnDone != nil {
+				policy.OnDone(err, attempt)
+			}
+			return
+		}
+
+		delay := policy.backoff(attempt)
+		var retryAfter *retryAfterError
+		if errors.As(err, &retryAfter) {
+			// The delay may come from a server, it doesn't get to hold the pool open for longer than the policy allows.
+			delay = retryAfter.delay
+			if policy.MaxBackoff > 0 {
+				delay = min(delay, policy.MaxBackoff)
+			}
+		}
+
+		atomic.AddUint32(&p.metrics.tasksRetried, 1)
+		p.retryAfter(ctx, delay, queuedTask{ctxFn: run, ctx: ctx, attempt: attempt + 1}, func() {
+			if policy.OnDone != nil {
+				policy.OnDone(ctx.Err(), attempt)
+			}
+		})
+	}
+
+	return p.submit(queuedTask{ctxFn: run, ctx: ctx, attempt: 1})
+}
+
+// Submits the task again once the delay passes, or calls cancelled if ctx is done first.
+// Must be called from a running task, which keeps the pool open until the task is resubmitted.
+func (p *ThreadPool) retryAfter(ctx context.Context, delay time.Duration, task queuedTask, cancelled func()) {
+	// Keep the pool from completing while the retry is scheduled. The running task holds pending above zero already.
+	p.holdPending()
+
+	timer := p.clock.NewTimer(delay)
+	go func() {
+		defer p.releasePending()
+
+		select {
+		case <-timer.C():
+			// Pending is held above zero, so the pool accepts the task even if Wait was called.
+			p.enqueue(task)
+		case <-ctx.Done():
+			timer.Stop()
+			cancelled()
+		}
+	}()
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errTransient = errors.New("transient")
+
+func TestRetryUntilSuccess(t *testing.T) {
+	p := newTestPool(t, 0)
+
+	var attempts []int
+	var doneErr error
+	var doneAttempts int
+	policy := RetryPolicy{
+		MaxAttempts: 5,
+		Backoff:     time.Millisecond,
+		OnDone: func(err error, attempts int) {
+			doneErr, doneAttempts = err, attempts
+		},
+	}
+	p.SubmitRetry(context.Background(), policy, func(ctx context.Context) error {
+		attempt, _ := AttemptFromContext(ctx)
+		attempts = append(attempts, attempt)
+		if attempt < 3 {
+			return errTransient
+		}
+		return nil
+	})
+	// Wait doesn't return while a retry is scheduled.
+	p.Wait()
+
+	assert.Equal(t, []int{1, 2, 3}, attempts)
+	assert.NoError(t, doneErr)
+	assert.Equal(t, 3, doneAttempts)
+	assert.EqualValues(t, 2, p.Metrics().TasksRetried)
+	assertAllTasksDone(t, p, 3)
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	p := newTestPool(t, 0)
+
+	var results [2]error
+	var attempts [2]int
+	errs := []error{errTransient, Permanent(errTransient)}
+	for i := range errs {
+		i := i
+		p.SubmitRetry(context.Background(), RetryPolicy{
+			MaxAttempts: 3,
+			Backoff:     time.Millisecond,
+			OnDone:      func(err error, n int) { results[i], attempts[i] = err, n },
+		}, func(ctx context.Context) error {
+			return errs[i]
+		})
+	}
+	p.Wait()
+
+	assert.ErrorIs(t, results[0], errTransient)
+	assert.Equal(t, 3, attempts[0])
+	assert.ErrorIs(t, results[1], errTransient)
+	assert.Equal(t, 1, attempts[1])
+}
+
+func TestRetryAfterOverridesBackoff(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	p := newTestPool(t, 0, WithClock(clock))
+
+	var attempts int32
+	p.SubmitRetry(context.Background(), RetryPolicy{MaxAttempts: 2, Backoff: time.Hour}, func(ctx context.Context) error {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			return RetryAfter(errTransient, time.Second)
+		}
+		return nil
+	})
+
+	// The timer is created once the first attempt returns, advance until the retry runs.
+	assert.Eventually(t, func() bool {
+		clock.Advance(time.Second)
+		return atomic.LoadInt32(&attempts) == 2
+	}, time.Second, time.Millisecond)
+	assert.Less(t, clock.Now().Sub(time.Unix(0, 0)), time.Hour)
+}
+
+func TestRetryAfterIsCappedByMaxBackoff(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	p := newTestPool(t, 0, WithClock(clock))
+
+	var attempts int32
+	p.SubmitRetry(context.Background(), RetryPolicy{MaxAttempts: 2, Backoff: time.Second, MaxBackoff: 30 * time.Second}, func(ctx context.Context) error {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			// Retry-After: 86400
+			return RetryAfter(errTransient, 24*time.Hour)
+		}
+		return nil
+	})
+
+	assert.Eventually(t, func() bool {
+		clock.Advance(time.Second)
+		return atomic.LoadInt32(&attempts) == 2
+	}, time.Second, time.Millisecond)
+	assert.LessOrEqual(t, clock.Now().Sub(time.Unix(0, 0)), time.Minute)
+}
+
+func TestRetryCancelledDuringBackoff(t *testing.T) {
+	p := newTestPool(t, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	p.SubmitRetry(ctx, RetryPolicy{
+		MaxAttempts: 3,
+		Backoff:     time.Hour,
+		OnDone:      func(err error, n int) { done <- err },
+	}, func(ctx context.Context) error {
+		return errTransient
+	})
+
+	assert.Eventually(t, func() bool { return p.Metrics().TasksRetried == 1 }, time.Second, time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	p.Wait()
+}
+
+func TestSubmitRetryRejectsNilTask(t *testing.T) {
+	skipInStrictMode(t)
+
+	p := newTestPool(t, 1)
+	assert.ErrorIs(t, p.SubmitRetry(context.Background(), RetryPolicy{MaxAttempts: 3}, nil), ErrNilTask)
+	p.Wait()
+
+	assert.EqualValues(t, 0, p.Metrics().TasksSubmitted)
+}
+
+func TestRetryBackoff(t *testing.T) {
+	r := RetryPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	assert.Equal(t, 100*time.Millisecond, r.backoff(1))
+	assert.Equal(t, 200*time.Millisecond, r.backoff(2))
+	assert.Equal(t, 800*time.Millisecond, r.backoff(4))
+	assert.Equal(t, time.Second, r.backoff(5))
+	assert.Equal(t, time.Second, r.backoff(100))
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// Configures ExportRows.
+type RowExport struct {
+	// Query selecting the rows with keys in [lo, hi), passed as its two arguments, ordered by the key, e.g.
+	// "SELECT id, name FROM users WHERE id >= $1 AND id < $2 ORDER BY id".
+	Query string
+	// Keys of the exported rows lie in [MinKey, MaxKey).
+	MinKey int64
+	MaxKey int64
+	// Number of keys queried by a single task.
+	ChunkKeys int64
+	// Output format, "csv" (with a header) or "jsonl".
+	Format string
+	// Maximum number of queries running at once, defaults to the number of CPUs.
+	// Queries wait for the database rather than use the CPU, so it may exceed the number of CPUs.
+	MaxThreads uint32
+}
+
+// Rows of a chunk of the key range, encoded in the output format.
+type rowChunk struct {
+	columns []string
+	data    []byte
+	err     error
+}
+
+// ExportRows splits the key range into chunks, runs the range queries of the chunks in parallel
+// and writes the rows to out in key order. At most about twice the number of workers chunks are held in memory.
+// The first failed query cancels the remaining ones and is returned.
+func ExportRows(ctx context.Context, db *sql.DB, cfg RowExport, out io.Writer) error {
+	if cfg.ChunkKeys <= 0 || cfg.MaxKey < cfg.MinKey {
+		return fmt.Errorf("%w: invalid key range [%d, %d) or chunk of %d keys", errBadArguments, cfg.MinKey, cfg.MaxKey, cfg.ChunkKeys)
+	}
+	if cfg.Format != "csv" && cfg.Format != "jsonl" {
+		return fmt.Errorf("%w: unknown format %q, expected csv or jsonl", errBadArguments, cfg.Format)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	queries := cfg.MaxThreads
+	if queries == 0 {
+		queries = uint32(runtime.NumCPU())
+	}
+	p := NewPoolWithOptions(0, WithIOWorkers(queries))
+
+	// Chunks in key order, each delivering its rows once queried. The capacity limits the chunks held in memory.
+	pending := make(chan chan rowChunk, 2*queries)
+	go func() {
+		defer close(pending)
+		for lo, hi := cfg.MinKey, cfg.MinKey; lo < cfg.MaxKey; lo = hi {
+			// The difference is computed unsigned, so keys close to the limits of int64 don't overflow.
+			hi = cfg.MaxKey
+			if uint64(cfg.MaxKey)-uint64(lo) > uint64(cfg.ChunkKeys) {
+				hi = lo + cfg.ChunkKeys
+			}
+
+			lo, hi := lo, hi
+			done := make(chan rowChunk, 1)
+			select {
+			case pending <- done:
+			case <-ctx.Done():
+				return
+			}
+			err := p.SubmitTaskClass(IOBound, func() {
+				done <- queryRowChunk(ctx, db, cfg, lo, hi)
+			})
+			if err != nil {
+				done <- rowChunk{err: err}
+				return
+			}
+		}
+	}()
+
+	var err error
+	header := cfg.Format == "csv"
+	for done := range pending {
+		chunk := <-done
+		if err != nil {
+			continue
+		}
+		if chunk.err != nil {
+			err = chunk.err
+			cancel()
+			continue
+		}
+
+		if header {
+			w := csv.NewWriter(out)
+			w.Write(chunk.columns)
+			w.Flush()
+			if err = w.Error(); err != nil {
+				cancel()
+				continue
+			}
+			header = false
+		}
+		if _, err = out.Write(chunk.data); err != nil {
+			cancel()
+		}
+	}
+	p.Wait()
+
+	return err
+}
+
+func queryRowChunk(ctx context.Context, db *sql.DB, cfg RowExport, lo, hi int64) rowChunk {
+	chunk, err := encodeRowChunk(ctx, db, cfg, lo, hi)
+	if err != nil {
+		chunk.err = fmt.Errorf("keys [%d, %d): %w", lo, hi, err)
+	}
+	return chunk
+}
+
+func encodeRowChunk(ctx context.Context, db *sql.DB, cfg RowExport, lo, hi int64) (rowChunk, error) {
+	var chunk rowChunk
+
+	rows, err := db.QueryContext(ctx, cfg.Query, lo, hi)
+	if err != nil {
+		return chunk, err
+	}
+	defer rows.Close()
+
+	if chunk.columns, err = rows.Columns(); err != nil {
+		return chunk, err
+	}
+
+	values := make([]any, len(chunk.columns))
+	dest := make([]any, len(values))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	record := make([]string, len(values))
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return chunk, err
+		}
+
+		if cfg.Format == "csv" {
+			for i, v := range values {
+				record[i] = formatSQLValue(v)
+			}
+			w.Write(record)
+			continue
+		}
+
+		// Keys are written in the order of the columns, which json.Marshal of a map wouldn't keep.
+		buf.WriteByte('{')
+		for i, v := range values {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, _ := json.Marshal(chunk.columns[i])
+			buf.Write(key)
+			buf.WriteByte(':')
+			if b, isBytes := v.([]byte); isBytes {
+				v = string(b)
+			}
+			value, err := json.Marshal(v)
+			if err != nil {
+				return chunk, err
+			}
+			buf.Write(value)
+		}
+		buf.WriteString("}\n")
+	}
+	if err := rows.Err(); err != nil {
+		return chunk, err
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return chunk, err
+	}
+	chunk.data = buf.Bytes()
+	return chunk, nil
+}
+
+func formatSQLValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(v)
+	}
+}
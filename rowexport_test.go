@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// A driver serving a table of 100 rows (id, name, score) to range queries with two arguments.
+// Queries are slower for lower keys, so chunks complete out of order. The query "fail" fails for keys starting at 40.
+type fakeRowsDriver struct{}
+
+type fakeRowsConn struct{}
+
+type fakeRowsStmt struct{ query string }
+
+type fakeRows struct {
+	next, hi int64
+}
+
+func init() {
+	sql.Register("fakerows", fakeRowsDriver{})
+}
+
+func (fakeRowsDriver) Open(name string) (driver.Conn, error) { return fakeRowsConn{}, nil }
+
+func (fakeRowsConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeRowsStmt{query: query}, nil
+}
+func (fakeRowsConn) Close() error              { return nil }
+func (fakeRowsConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+func (s *fakeRowsStmt) Close() error  { return nil }
+func (s *fakeRowsStmt) NumInput() int { return 2 }
+func (s *fakeRowsStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+
+func (s *fakeRowsStmt) Query(args []driver.Value) (driver.Rows, error) {
+	lo, hi := args[0].(int64), min(args[1].(int64), 100)
+	if s.query == "fail" && lo >= 40 {
+		return nil, errors.New("connection reset")
+	}
+	time.Sleep(time.Duration(100-lo) * 20 * time.Microsecond)
+	return &fakeRows{next: lo, hi: hi}, nil
+}
+
+func (r *fakeRows) Columns() []string { return []string{"id", "name", "score"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next >= r.hi {
+		return io.EOF
+	}
+	dest[0] = r.next
+	dest[1] = []byte(fmt.Sprintf("row, %d", r.next))
+	dest[2] = nil
+	if r.next%2 == 0 {
+		dest[2] = float64(r.next) / 2
+	}
+	r.next++
+	return nil
+}
+
+func openFakeRows(t *testing.T) *sql.DB {
+	db, err := sql.Open("fakerows", "")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestExportRowsCSV(t *testing.T) {
+	db := openFakeRows(t)
+
+	var out bytes.Buffer
+	err := ExportRows(context.Background(), db, RowExport{Query: "select", MinKey: 0, MaxKey: 100, ChunkKeys: 7, Format: "csv", MaxThreads: 4}, &out)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	require.Len(t, lines, 101)
+	assert.Equal(t, "id,name,score", lines[0])
+	for id := 0; id < 100; id++ {
+		score := ""
+		if id%2 == 0 {
+			score = fmt.Sprint(float64(id) / 2)
+		}
+		assert.Equal(t, fmt.Sprintf("%d,\"row, %d\",%s", id, id, score), lines[id+1])
+	}
+}
+
+func TestExportRowsJSONL(t *testing.T) {
+	db := openFakeRows(t)
+
+	var out bytes.Buffer
+	err := ExportRows(context.Background(), db, RowExport{Query: "select", MinKey: 95, MaxKey: 200, ChunkKeys: 2, Format: "jsonl"}, &out)
+	require.NoError(t, err)
+	assert.Equal(t, `{"id":95,"name":"row, 95","score":null}
+{"id":96,"name":"row, 96","score":48}
+{"id":97,"name":"row, 97","score":null}
+{"id":98,"name":"row, 98","score":49}
+{"id":99,"name":"row, 99","score":null}
+`, out.String())
+}
+
+func TestExportRowsNearMaxKey(t *testing.T) {
+	db := openFakeRows(t)
+
+	// lo += ChunkKeys would overflow past the last chunk and never reach MaxKey.
+	var out bytes.Buffer
+	err := ExportRows(context.Background(), db, RowExport{Query: "select", MinKey: math.MaxInt64 - 10, MaxKey: math.MaxInt64,
+		ChunkKeys: 7, Format: "jsonl", MaxThreads: 2}, &out)
+	assert.NoError(t, err)
+	assert.Empty(t, out.String())
+
+	// MaxKey-MinKey exceeds math.MaxInt64.
+	err = ExportRows(context.Background(), db, RowExport{Query: "select", MinKey: -10, MaxKey: math.MaxInt64,
+		ChunkKeys: math.MaxInt64, Format: "jsonl"}, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, 110, strings.Count(out.String(), "\n"))
+}
+
+func TestExportRowsFailure(t *testing.T) {
+	db := openFakeRows(t)
+
+	var out bytes.Buffer
+	err := ExportRows(context.Background(), db, RowExport{Query: "fail", MinKey: 0, MaxKey: 100, ChunkKeys: 10, Format: "csv", MaxThreads: 2}, &out)
+	assert.ErrorContains(t, err, "keys [40, 50): connection reset")
+
+	// Chunks before the failed one are written in full, nothing after it.
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	assert.Len(t, lines, 41)
+
+	err = ExportRows(context.Background(), db, RowExport{Query: "select", MaxKey: 10, ChunkKeys: 0, Format: "csv"}, &out)
+	assert.ErrorIs(t, err, errBadArguments)
+	err = ExportRows(context.Background(), db, RowExport{Query: "select", MaxKey: 10, ChunkKeys: 1, Format: "xml"}, &out)
+	assert.ErrorIs(t, err, errBadArguments)
+}
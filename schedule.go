@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Identifies files written by Recorder.WriteTo.
+const scheduleMagic = "WPSCHED1"
+
+// Describes a single execution of a task.
+// Task IDs are assigned in the order of submission starting from 0, so they match between runs
+// as long as the tasks are submitted in the same order.
+type ScheduleEntry struct {
+	TaskID   uint64
+	WorkerID uint32
+	// Offsets from the creation of the first pool the recorder was passed to.
+	Start time.Duration
+	End   time.Duration
+}
+
+// Recorder collects the schedule of tasks executed by a pool created WithRecorder.
+type Recorder struct {
+	origin  time.Time
+	entries []ScheduleEntry
+	mu      sync.Mutex
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// WithRecorder records which worker executed each task and when, see Recorder.
+// Tasks running on the separate IO workers (see WithIOWorkers) are not recorded.
+func WithRecorder(r *Recorder) Option {
+	return func(p *ThreadPool) {
+		p.recorder = r
+	}
+}
+
+func (r *Recorder) record(taskID uint64, workerID uint32, start, end time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries = append(r.entries, ScheduleEntry{
+		TaskID:   taskID,
+		WorkerID: workerID,
+		Start:    start.Sub(r.origin),
+		End:      end.Sub(r.origin),
+	})
+}
+
+// Returns the recorded entries ordered by the start time.
+func (r *Recorder) Schedule() []ScheduleEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	schedule := make([]ScheduleEntry, len(r.entries))
+	copy(schedule, r.entries)
+	sort.SliceStable(schedule, func(i, j int) bool {
+		return schedule[i].Start < schedule[j].Start
+	})
+	return schedule
+}
+
+// Writes the recorded schedule in a compact binary form, which can be read back with ReadSchedule.
+func (r *Recorder) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	n, _ := bw.WriteString(scheduleMagic)
+
+	var buf [binary.MaxVarintLen64]byte
+	put := func(x uint64) {
+		m, _ := bw.Write(buf[:binary.PutUvarint(buf[:], x)])
+		n += m
+	}
+
+	schedule := r.Schedule()
+	put(uint64(len(schedule)))
+
+	var prevStart time.Duration
+	for _, e := range schedule {
+		// Entries are ordered by the start time, so storing deltas keeps the numbers small.
+		put(e.TaskID)
+		put(uint64(e.WorkerID))
+		put(uint64(e.Start - prevStart))
+		put(uint64(e.End - e.Start))
+		prevStart = e.Start
+	}
+
+	return int64(n), bw.Flush()
+}
+
+// Reads a schedule written by Recorder.WriteTo.
+func ReadSchedule(r io.Reader) ([]ScheduleEntry, error) {
+	br := bufio.NewReader(r)
+
+	magic := make([]byte, len(scheduleMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != scheduleMagic {
+		return nil, ErrInvalidSchedule
+	}
+
+	var err error
+	get := func() uint64 {
+		if err != nil {
+			return 0
+		}
+		var x uint64
+		x, err = binary.ReadUvarint(br)
+		return x
+	}
+
+	count := get()
+	var schedule []ScheduleEntry
+	var prevStart time.Duration
+	for i := uint64(0); i < count && err == nil; i++ {
+		e := ScheduleEntry{TaskID: get(), WorkerID: uint32(get())}
+		e.Start = prevStart + time.Duration(get())
+		e.End = e.Start + time.Duration(get())
+		prevStart = e.Start
+		schedule = append(schedule, e)
+	}
+
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSchedule, err)
+	}
+	return schedule, nil
+}
+
+// Delays the start of each task until the task which started before it in the recorded schedule has started.
+type replayer struct {
+	ranks   map[uint64]int
+	started []chan struct{}
+	maxWait time.Duration
+	clock   Clock
+}
+
+// WithReplay makes the pool start tasks in the order of the recorded schedule, reproducing the interleaving
+// of the recorded run as closely as possible. A task waits at most maxWait for its predecessor to start,
+// so the pool makes progress even if the workload diverged from the recorded one.
+// Tasks missing from the schedule start right away.
+func WithReplay(schedule []ScheduleEntry, maxWait time.Duration) Option {
+	return func(p *ThreadPool) {
+		r := &replayer{
+			ranks:   make(map[uint64]int, len(schedule)),
+			started: make([]chan struct{}, len(schedule)),
+			maxWait: maxWait,
+			clock:   realClock{},
+		}
+		for i, e := range schedule {
+			r.ranks[e.TaskID] = i
+			r.started[i] = make(chan struct{})
+		}
+		p.replayer = r
+	}
+}
+
+// Blocks until the task is allowed to start.
+func (r *replayer) await(taskID uint64) {
+	rank, exists := r.ranks[taskID]
+	if !exists {
+		return
+	}
+
+	if rank > 0 {
+		timer := r.clock.NewTimer(r.maxWait)
+		select {
+		case <-r.started[rank-1]:
+		case <-timer.C():
+		}
+		timer.Stop()
+	}
+
+	close(r.started[rank])
+}
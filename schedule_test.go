@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestRecorder_WriteAndReadSchedule(t *testing.T) {
+	r := NewRecorder()
+	r.record(1, 0, r.origin.Add(5*time.Millisecond), r.origin.Add(9*time.Millisecond))
+	r.record(0, 1, r.origin.Add(time.Millisecond), r.origin.Add(12*time.Millisecond))
+	r.record(2, 0, r.origin.Add(10*time.Millisecond), r.origin.Add(10*time.Millisecond))
+
+	var buf bytes.Buffer
+	n, err := r.WriteTo(&buf)
+	assert.Nil(t, err)
+	assert.EqualValues(t, buf.Len(), n)
+
+	schedule, err := ReadSchedule(bytes.NewReader(buf.Bytes()))
+	assert.Nil(t, err)
+	assert.Equal(t, r.Schedule(), schedule)
+	assert.EqualValues(t, 0, schedule[0].TaskID)
+	assert.EqualValues(t, 2, schedule[2].TaskID)
+
+	_, err = ReadSchedule(bytes.NewReader(buf.Bytes()[:buf.Len()-1]))
+	assert.ErrorIs(t, err, ErrInvalidSchedule)
+
+	_, err = ReadSchedule(bytes.NewReader([]byte("not a schedule")))
+	assert.ErrorIs(t, err, ErrInvalidSchedule)
+}
+
+func TestReplayer_StartsTasksInRecordedOrder(t *testing.T) {
+	const TASKS_COUNT = 16
+
+	// Tasks were recorded starting in the reverse order of submission.
+	var schedule []ScheduleEntry
+	for i := TASKS_COUNT - 1; i >= 0; i-- {
+		schedule = append(schedule, ScheduleEntry{TaskID: uint64(i)})
+	}
+
+	p := &ThreadPool{}
+	WithReplay(schedule, time.Minute)(p)
+
+	var order []uint64
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < TASKS_COUNT; i++ {
+		wg.Add(1)
+		go func(id uint64) {
+			defer wg.Done()
+			p.replayer.await(id)
+			mu.Lock()
+			order = append(order, id)
+			mu.Unlock()
+		}(uint64(i))
+	}
+	wg.Wait()
+
+	for i, e := range schedule {
+		assert.Equal(t, e.TaskID, order[i])
+	}
+}
+
+func TestRecordAndReplayPool(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	const TASKS_COUNT = 64
+
+	run := func(options ...Option) []uint64 {
+		var order []uint64
+		var mu sync.Mutex
+
+		// A single worker, so the order of appends matches the order in which tasks started.
+		p := NewPoolWithOptions(1, options...)
+		for i := 0; i < TASKS_COUNT; i++ {
+			id := uint64(i)
+			p.SubmitTask(func() {
+				mu.Lock()
+				order = append(order, id)
+				mu.Unlock()
+			})
+		}
+		p.Wait()
+		return order
+	}
+
+	r := NewRecorder()
+	recorded := run(WithRecorder(r))
+
+	schedule := r.Schedule()
+	assert.Equal(t, TASKS_COUNT, len(schedule))
+	for i, e := range schedule {
+		assert.Equal(t, recorded[i], e.TaskID)
+		assert.LessOrEqual(t, e.Start, e.End)
+	}
+
+	replayed := run(WithReplay(schedule, time.Second))
+	assert.Equal(t, recorded, replayed)
+}
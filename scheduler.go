@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Decides what happens when a job is due while its previous run hasn't completed yet.
+type OverlapPolicy int
+
+const (
+	// The due run is skipped.
+	OverlapSkip OverlapPolicy = iota
+	// The due run waits, queued runs start one after another.
+	OverlapQueue
+	// The context of the running run is cancelled and the due run starts once it returns.
+	OverlapReplace
+)
+
+func (o OverlapPolicy) String() string {
+	switch o {
+	case OverlapSkip:
+		return "skip"
+	case OverlapQueue:
+		return "queue"
+	case OverlapReplace:
+		return "replace"
+	}
+	return "unknown"
+}
+
+// Describes a job registered with a Scheduler and its last completed run.
+type JobStatus struct {
+	Name         string        `json:"name"`
+	Policy       string        `json:"policy"`
+	Running      bool          `json:"running"`
+	Queued       int           `json:"queued"`
+	Runs         int           `json:"runs"`
+	Failures     int           `json:"failures"`
+	Skipped      int           `json:"skipped"`
+	LastStart    time.Time     `json:"last_start"`
+	LastDuration time.Duration `json:"last_duration"`
+	LastError    string        `json:"last_error,omitempty"`
+	// Zero once the schedule has no more runs.
+	Next time.Time `json:"next"`
+}
+
+type job struct {
+	schedule Schedule
+	policy   OverlapPolicy
+	fn       func(ctx context.Context) error
+	status   JobStatus
+	cancel   context.CancelFunc // of the running run
+}
+
+// Scheduler runs recurring jobs on a pool, see Add. Its status is served as JSON by ServeHTTP.
+type Scheduler struct {
+	pool  *ThreadPool
+	clock Clock
+	jobs  map[string]*job
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	// Goroutines waiting for the jobs to become due.
+	loops sync.WaitGroup
+	// Runs submitted to the pool which haven't completed yet.
+	runs sync.WaitGroup
+	mu   sync.Mutex
+}
+
+// NewScheduler creates a scheduler running its jobs on p, timed by the clock of p (see WithClock).
+// p must not be waited for before the scheduler is stopped.
+func NewScheduler(p *ThreadPool) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		pool:   p,
+		clock:  p.clock,
+		jobs:   make(map[string]*job),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Add registers a job running fn on the pool whenever the schedule is due, see Every and ParseCron.
+// A run whose context is cancelled, by the overlap policy or by Stop, should return early.
+// Errors returned by fn are counted and reported by Jobs.
+func (s *Scheduler) Add(name string, schedule Schedule, policy OverlapPolicy, fn func(ctx context.Context) error) error {
+	if fn == nil {
+		return misuse(ErrNilTask)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ctx.Err() != nil {
+		return ErrSchedulerStopped
+	}
+	if _, exists := s.jobs[name]; exists {
+		return ErrDuplicateJob
+	}
+
+	j := &job{schedule: schedule, policy: policy, fn: fn, status: JobStatus{Name: name, Policy: policy.String()}}
+	s.jobs[name] = j
+
+	s.loops.Add(1)
+	go s.loop(j)
+	return nil
+}
+
+// Triggers the job whenever it is due until the scheduler is stopped.
+// Runs missed while the scheduler was delayed are not caught up.
+func (s *Scheduler) loop(j *job) {
+	defer s.loops.Done()
+
+	next := j.schedule.Next(s.clock.Now())
+	for {
+		s.mu.Lock()
+		j.status.Next = next
+		s.mu.Unlock()
+
+		if next.IsZero() {
+			return
+		}
+
+		timer := s.clock.NewTimer(next.Sub(s.clock.Now()))
+		select {
+		case <-timer.C():
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		}
+
+		s.trigger(j)
+
+		next = j.schedule.Next(next)
+		if now := s.clock.Now(); !next.IsZero() && !next.After(now) {
+			next = j.schedule.Next(now)
+		}
+	}
+}
+
+func (s *Scheduler) trigger(j *job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ctx.Err() != nil {
+		return
+	}
+
+	if !j.status.Running {
+		s.start(j)
+		return
+	}
+
+	switch j.policy {
+	case OverlapSkip:
+		j.status.Skipped++
+	case OverlapQueue:
+		j.status.Queued++
+	case OverlapReplace:
+		j.cancel()
+		j.status.Queued = 1
+	}
+}
+
+// Must be called with the mutex held.
+func (s *Scheduler) start(j *job) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	j.cancel = cancel
+	j.status.Running = true
+
+	s.runs.Add(1)
+	err := s.pool.SubmitTaskCtx(ctx, func(ctx context.Context) {
+		s.run(ctx, j)
+	})
+	if err != nil {
+		s.runs.Done()
+		cancel()
+		j.status.Running = false
+		j.status.Failures++
+		j.status.LastError = err.Error()
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context, j *job) {
+	defer s.runs.Done()
+
+	start := s.clock.Now()
+	err := j.fn(ctx)
+	end := s.clock.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	j.cancel()
+	j.status.Running = false
+	j.status.Runs++
+	j.status.LastStart = start
+	j.status.LastDuration = end.Sub(start)
+	j.status.LastError = ""
+	if err != nil {
+		j.status.Failures++
+		j.status.LastError = err.Error()
+	}
+
+	if j.status.Queued > 0 && s.ctx.Err() == nil {
+		j.status.Queued--
+		s.start(j)
+	}
+}
+
+// Jobs returns the status of all the registered jobs ordered by name.
+func (s *Scheduler) Jobs() []JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]JobStatus, 0, len(s.jobs))
+	for _, name := range sortedKeys(s.jobs) {
+		jobs = append(jobs, s.jobs[name].status)
+	}
+	return jobs
+}
+
+// ServeHTTP writes the status of the jobs as a JSON array, so the scheduler can be mounted as a debug endpoint.
+func (s *Scheduler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Jobs())
+}
+
+// Stop stops triggering the jobs, cancels the contexts of the running runs, drops the queued ones
+// and waits for the running ones to return. Jobs can't be added afterwards.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	s.cancel()
+	for _, j := range s.jobs {
+		j.status.Queued = 0
+	}
+	s.mu.Unlock()
+
+	s.loops.Wait()
+	s.runs.Wait()
+}
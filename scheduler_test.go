@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Waits until the loop of the only job of the scheduler armed its timer.
+func waitForTimer(t *testing.T, c *FakeClock) {
+	assert.Eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return len(c.timers) == 1
+	}, time.Second, time.Millisecond)
+}
+
+func waitForJob(t *testing.T, s *Scheduler, done func(JobStatus) bool) {
+	assert.Eventually(t, func() bool { return done(s.Jobs()[0]) }, time.Second, time.Millisecond)
+}
+
+func TestScheduler(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, time.March, 16, 10, 0, 0, 0, time.UTC))
+	p := newTestPool(t, 2, WithClock(clock))
+
+	s := NewScheduler(p)
+	defer s.Stop()
+
+	fail := true
+	assert.NoError(t, s.Add("cleanup", Every(time.Minute), OverlapSkip, func(ctx context.Context) error {
+		_, ok := WorkerIDFromContext(ctx)
+		assert.True(t, ok)
+		if fail {
+			return errors.New("disk is full")
+		}
+		return nil
+	}))
+	assert.ErrorIs(t, s.Add("cleanup", Every(time.Hour), OverlapSkip, func(ctx context.Context) error { return nil }), ErrDuplicateJob)
+
+	waitForTimer(t, clock)
+	assert.Equal(t, clock.Now().Add(time.Minute), s.Jobs()[0].Next)
+
+	clock.Advance(time.Minute)
+	waitForJob(t, s, func(j JobStatus) bool { return j.Runs == 1 && !j.Running })
+	waitForTimer(t, clock)
+
+	status := s.Jobs()[0]
+	assert.Equal(t, 1, status.Failures)
+	assert.Equal(t, "disk is full", status.LastError)
+	assert.Equal(t, clock.Now(), status.LastStart)
+	assert.Equal(t, clock.Now().Add(time.Minute), status.Next)
+
+	fail = false
+	clock.Advance(time.Minute)
+	waitForJob(t, s, func(j JobStatus) bool { return j.Runs == 2 && !j.Running })
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/debug/jobs", nil))
+	var jobs []JobStatus
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &jobs))
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, "cleanup", jobs[0].Name)
+	assert.Equal(t, "skip", jobs[0].Policy)
+	assert.Equal(t, 2, jobs[0].Runs)
+	assert.Equal(t, 1, jobs[0].Failures)
+	assert.Empty(t, jobs[0].LastError)
+
+	s.Stop()
+	assert.ErrorIs(t, s.Add("report", Every(time.Hour), OverlapSkip, func(ctx context.Context) error { return nil }), ErrSchedulerStopped)
+}
+
+func TestSchedulerOverlapPolicies(t *testing.T) {
+	tests := []struct {
+		policy  OverlapPolicy
+		runs    int
+		skipped int
+		// Number of runs returning because their context was cancelled.
+		cancelled int
+	}{
+		{OverlapSkip, 1, 2, 0},
+		{OverlapQueue, 3, 0, 0},
+		{OverlapReplace, 3, 0, 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.policy.String(), func(t *testing.T) {
+			clock := NewFakeClock(time.Date(2024, time.March, 16, 10, 0, 0, 0, time.UTC))
+			p := newTestPool(t, 2, WithClock(clock))
+
+			s := NewScheduler(p)
+			defer s.Stop()
+
+			release := make(chan struct{})
+			cancelled := 0
+			assert.NoError(t, s.Add("sync", Every(time.Minute), test.policy, func(ctx context.Context) error {
+				select {
+				case <-release:
+					return nil
+				case <-ctx.Done():
+					cancelled++
+					return ctx.Err()
+				}
+			}))
+
+			// The job is due three times while its first run is blocked.
+			for i := 0; i < 3; i++ {
+				waitForTimer(t, clock)
+				clock.Advance(time.Minute)
+				waitForJob(t, s, func(j JobStatus) bool { return j.Running })
+			}
+			waitForTimer(t, clock)
+
+			close(release)
+			waitForJob(t, s, func(j JobStatus) bool { return j.Runs == test.runs && !j.Running })
+
+			status := s.Jobs()[0]
+			assert.Equal(t, test.skipped, status.Skipped)
+			assert.Zero(t, status.Queued)
+			assert.Equal(t, test.cancelled, status.Failures)
+			assert.Equal(t, test.cancelled, cancelled)
+		})
+	}
+}
+
+func TestSchedulerStopCancelsRuns(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, time.March, 16, 10, 0, 0, 0, time.UTC))
+	p := newTestPool(t, 2, WithClock(clock))
+
+	s := NewScheduler(p)
+	assert.NoError(t, s.Add("backup", Every(time.Minute), OverlapQueue, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+
+	waitForTimer(t, clock)
+	clock.Advance(time.Minute)
+	waitForJob(t, s, func(j JobStatus) bool { return j.Running })
+	waitForTimer(t, clock)
+	clock.Advance(time.Minute)
+	waitForJob(t, s, func(j JobStatus) bool { return j.Queued == 1 })
+
+	// The running run is cancelled and the queued one dropped.
+	s.Stop()
+	status := s.Jobs()[0]
+	assert.Equal(t, 1, status.Runs)
+	assert.Zero(t, status.Queued)
+	assert.Equal(t, context.Canceled.Error(), status.LastError)
+}
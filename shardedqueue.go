@@ -0,0 +1,69 @@
+package main
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+// ShardedQueue spreads its elements over several Queues with separate locks, so concurrent producers and consumers
+// mostly contend for different locks. Push and TryPop walk the shards round-robin, so elements come out in the order
+// they were pushed as long as the queue is used by a single goroutine, and roughly in that order otherwise.
+type ShardedQueue[T any] struct {
+	shards []paddedQueue[T]
+	push   atomic.Uint64
+	pop    atomic.Uint64
+	// Elements in all the shards, lets TryPop and Empty skip the shards when the queue is empty.
+	count atomic.Int64
+}
+
+type paddedQueue[T any] struct {
+	Queue[T]
+	// Keeps the lock of a shard off the cache line of the next shard's fields.
+	_ [64]byte
+}
+
+// Creates an unbounded queue of the given number of shards, values below 1 mean one shard per CPU.
+func NewShardedQueue[T any](shards int) *ShardedQueue[T] {
+	if shards < 1 {
+		shards = runtime.GOMAXPROCS(0)
+	}
+	q := &ShardedQueue[T]{shards: make([]paddedQueue[T], shards)}
+	for i := range q.shards {
+		q.shards[i].growth = GrowDouble
+	}
+	return q
+}
+
+func (q *ShardedQueue[T]) Push(item T) error {
+	shard := &q.shards[(q.push.Add(1)-1)%uint64(len(q.shards))]
+	if err := shard.Push(item); err != nil {
+		return err
+	}
+	q.count.Add(1)
+	return nil
+}
+
+// Pops from the next shard in turn, or from any other one if it is empty.
+func (q *ShardedQueue[T]) TryPop(value *T) bool {
+	if q.count.Load() <= 0 {
+		return false
+	}
+
+	n := uint64(len(q.shards))
+	start := q.pop.Add(1) - 1
+	for i := uint64(0); i < n; i++ {
+		if q.shards[(start+i)%n].TryPop(value) {
+			q.count.Add(-1)
+			return true
+		}
+	}
+	return false
+}
+
+func (q *ShardedQueue[T]) Size() int {
+	return int(max(q.count.Load(), 0))
+}
+
+func (q *ShardedQueue[T]) Empty() bool {
+	return q.count.Load() <= 0
+}
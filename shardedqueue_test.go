@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShardedQueue(t *testing.T) {
+	q := NewShardedQueue[int](4)
+	assert.True(t, q.Empty())
+
+	var value int
+	assert.False(t, q.TryPop(&value))
+
+	// Used by a single goroutine, the queue is FIFO.
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, q.Push(i))
+	}
+	assert.Equal(t, 10, q.Size())
+	for i := 0; i < 10; i++ {
+		assert.True(t, q.TryPop(&value))
+		assert.Equal(t, i, value)
+	}
+	assert.True(t, q.Empty())
+
+	// Shards which run out are skipped.
+	assert.NoError(t, q.Push(1))
+	assert.True(t, q.TryPop(&value))
+	assert.NoError(t, q.Push(2))
+	assert.NoError(t, q.Push(3))
+	assert.True(t, q.TryPop(&value))
+	assert.True(t, q.TryPop(&value))
+	assert.False(t, q.TryPop(&value))
+}
+
+func TestShardedQueueConcurrent(t *testing.T) {
+	const producers = 8
+	const itemsPerProducer = 10000
+
+	q := NewShardedQueue[int](0)
+	seen := make([]atomic.Int32, producers*itemsPerProducer)
+
+	var wg sync.WaitGroup
+	var popped atomic.Int64
+	for p := 0; p < producers; p++ {
+		wg.Add(2)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < itemsPerProducer; i++ {
+				assert.NoError(t, q.Push(p*itemsPerProducer+i))
+			}
+		}(p)
+		go func() {
+			defer wg.Done()
+			var value int
+			for popped.Load() < producers*itemsPerProducer {
+				if q.TryPop(&value) {
+					seen[value].Add(1)
+					popped.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.True(t, q.Empty())
+	for i := range seen {
+		if !assert.Equal(t, int32(1), seen[i].Load(), "item %d", i) {
+			break
+		}
+	}
+}
+
+func TestPoolWithShardedQueues(t *testing.T) {
+	p := newTestPool(t, 4, WithShardedQueues(0))
+
+	const TASKS_COUNT = 10000
+	var done atomic.Int32
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < TASKS_COUNT/8; i++ {
+				assert.NoError(t, p.SubmitTask(func() { done.Add(1) }))
+			}
+		}()
+	}
+	wg.Wait()
+	p.Wait()
+
+	assert.Equal(t, int32(TASKS_COUNT), done.Load())
+}
+
+// Push and TryPop throughput of the queues with 1 to 64 goroutines each pushing and popping.
+func BenchmarkQueueContention(b *testing.B) {
+	queues := []struct {
+		name string
+		new  func() taskQueue
+	}{
+		{"Queue", func() taskQueue { return NewQueue[queuedTask]() }},
+		{"ShardedQueue", func() taskQueue { return NewShardedQueue[queuedTask](0) }},
+	}
+
+	for _, queue := range queues {
+		for _, goroutines := range []int{1, 2, 4, 8, 16, 32, 64} {
+			b.Run(fmt.Sprintf("%s/G%d", queue.name, goroutines), func(b *testing.B) {
+				q := queue.new()
+
+				var wg sync.WaitGroup
+				b.ResetTimer()
+				for g := 0; g < goroutines; g++ {
+					wg.Add(1)
+					go func(n int) {
+						defer wg.Done()
+						var task queuedTask
+						for i := 0; i < n; i++ {
+							q.Push(task)
+							q.TryPop(&task)
+						}
+					}(b.N / goroutines)
+				}
+				wg.Wait()
+			})
+		}
+	}
+}
+
+// Throughput of submitting empty tasks from many goroutines, with and without sharded queues.
+func BenchmarkSubmitContention(b *testing.B) {
+	for _, sharded := range []bool{false, true} {
+		for _, goroutines := range []int{1, 8, 64} {
+			b.Run(fmt.Sprintf("Sharded=%t/G%d", sharded, goroutines), func(b *testing.B) {
+				var options []Option
+				if sharded {
+					options = append(options, WithShardedQueues(0))
+				}
+				p := newTestPool(b, 0, options...)
+
+				var wg sync.WaitGroup
+				b.ResetTimer()
+				for g := 0; g < goroutines; g++ {
+					wg.Add(1)
+					go func(n int) {
+						defer wg.Done()
+						for i := 0; i < n; i++ {
+							p.SubmitTask(func() {})
+						}
+					}(b.N / goroutines)
+				}
+				wg.Wait()
+				p.Wait()
+			})
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/isnastish/workers_prototype/loadgen"
+)
+
+type sortOptions struct {
+	chunkSize  int    // approximate size of a chunk sorted in memory by a single task
+	maxThreads uint32 // maximum number of workers sorting chunks
+	tmpDir     string // directory for sorted runs, os.TempDir() if empty
+	tmpLimit   int64  // maximum total size of the sorted runs, 0 means no limit
+	mergeFanIn int    // maximum number of runs merged at once, maxMergeFanIn if 0
+
+	poolOptions []Option
+}
+
+// Sorts lines of in and writes them to out. The input is split into chunks aligned to line boundaries,
+// each chunk is sorted by a separate task and spilled to a temporary file (a run),
+// then the runs are merged into the output, in several passes if there are too many of them to open at once.
+func externalSort(in io.Reader, out io.Writer, opts sortOptions) error {
+	space, err := NewTempSpace(opts.tmpDir, opts.tmpLimit)
+	if err != nil {
+		return err
+	}
+	defer space.Close()
+
+	p := NewPoolWithOptions(opts.maxThreads, opts.poolOptions...)
+
+	// Limit the amount of chunks held in memory, reading stalls while all the workers are busy.
+	inFlight := make(chan struct{}, 2*p.maxThreads)
+
+	var runs []string
+	var errs []error
+	var mu sync.Mutex
+
+	var readErr error
+	reader := bufio.NewReader(in)
+	var carry []byte
+	for index := 0; readErr == nil; index++ {
+		// Stop reading once a run couldn't be written, e.g. because the temporary space is full.
+		mu.Lock()
+		failed := len(errs) != 0
+		mu.Unlock()
+		if failed {
+			break
+		}
+
+		buf := make([]byte, opts.chunkSize)
+		n, err := io.ReadFull(reader, buf)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			readErr = io.EOF
+		} else if err != nil {
+			readErr = err
+			break
+		}
+
+		chunk := append(carry, buf[:n]...)
+		carry = nil
+
+		// Keep the incomplete last line for the next chunk.
+		if readErr == nil {
+			if last := bytes.LastIndexByte(chunk, '\n'); last >= 0 {
+				carry = append(carry, chunk[last+1:]...)
+				chunk = chunk[:last+1]
+			} else {
+				carry = chunk
+				continue
+			}
+		}
+
+		if len(chunk) == 0 {
+			continue
+		}
+
+		run := fmt.Sprintf("run-%05d", index)
+		inFlight <- struct{}{}
+		p.SubmitTask(func() {
+			defer func() { <-inFlight }()
+
+			err := sortChunk(chunk, space, run)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			runs = append(runs, filepath.Join(space.Dir(), run))
+		})
+	}
+	p.Wait()
+
+	if readErr != nil && readErr != io.EOF {
+		return readErr
+	}
+	if len(errs) != 0 {
+		return errors.Join(errs...)
+	}
+
+	fanIn := opts.mergeFanIn
+	if fanIn < 2 {
+		fanIn = maxMergeFanIn
+	}
+	if runs, err = reduceRuns(runs, space, fanIn); err != nil {
+		return err
+	}
+	return mergeRuns(runs, out)
+}
+
+// Sorts lines of the chunk and writes them into the run file.
+func sortChunk(chunk []byte, space *TempSpace, run string) error {
+	lines := strings.Split(strings.TrimSuffix(string(chunk), "\n"), "\n")
+	sort.Strings(lines)
+
+	f, err := space.Create(run)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	for _, line := range lines {
+		w.WriteString(line)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Number of lines read ahead from each run while merging.
+const runReadAhead = 64
+
+// Maximum number of runs merged at once, keeps the number of open files well below the common limit of 1024.
+const maxMergeFanIn = 128
+
+// Merges groups of at most fanIn runs into intermediate runs until no more than fanIn runs are left,
+// so the final merge doesn't open more files than that. Merged runs are removed right away to free the space.
+func reduceRuns(runs []string, space *TempSpace, fanIn int) ([]string, error) {
+	for pass := 0; len(runs) > fanIn; pass++ {
+		var merged []string
+		for i := 0; i < len(runs); i += fanIn {
+			group := runs[i:min(i+fanIn, len(runs))]
+			if len(group) == 1 {
+				merged = append(merged, group[0])
+				continue
+			}
+
+			name := fmt.Sprintf("merge-%d-%05d", pass, i/fanIn)
+			if err := mergeRunsInto(group, space, name); err != nil {
+				return nil, err
+			}
+			merged = append(merged, filepath.Join(space.Dir(), name))
+		}
+		runs = merged
+	}
+	return runs, nil
+}
+
+// Merges the runs into a new run of the space and removes them.
+func mergeRunsInto(runs []string, space *TempSpace, name string) error {
+	f, err := space.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := mergeRuns(runs, f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	for _, run := range runs {
+		if err := space.Remove(filepath.Base(run)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// k-way merge of sorted runs into out.
+func mergeRuns(runs []string, out io.Writer) error {
+	readers := make([]*bufio.Reader, 0, len(runs))
+	for _, run := range runs {
+		f, err := os.Open(run)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		readers = append(readers, bufio.NewReader(f))
+	}
+
+	var errs []error
+	var mu sync.Mutex
+
+	ins := make([]<-chan string, 0, len(readers))
+	for _, r := range readers {
+		lines := make(chan string, runReadAhead)
+		go func(r *bufio.Reader) {
+			defer close(lines)
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					if err != io.EOF {
+						mu.Lock()
+						errs = append(errs, err)
+						mu.Unlock()
+					}
+					return
+				}
+				lines <- line
+			}
+		}(r)
+		ins = append(ins, lines)
+	}
+
+	// Errors of the writer are sticky, so the merge is always drained and no goroutines are left behind.
+	w := bufio.NewWriter(out)
+	for line := range MergeOrdered(func(a, b string) bool { return a < b }, ins...) {
+		w.WriteString(line)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	return errors.Join(errs...)
+}
+
+// Sorts lines of a file in parallel, possibly bigger than the available memory.
+func runSort(args []string) error {
+	fs := flag.NewFlagSet("sort", flag.ContinueOnError)
+
+	input := fs.String("in", "", "File to sort, stdin if empty")
+	outFile := fs.String("out", "", "Output file, stdout if empty")
+	chunk := fs.String("chunk", "64MiB", "Size of a chunk sorted in memory by a single task")
+	threads := fs.Uint("threads", 0, "Maximum number of workers, defaults to the number of CPUs")
+	tmpDir := fs.String("tmp", "", "Directory for temporary files, defaults to the system's temporary directory")
+	tmpLimit := fs.String("tmp-limit", "", "Maximum total size of temporary files, unlimited if empty")
+	output := addOutputFlags(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%w: %s", errBadArguments, err.Error())
+	}
+
+	chunkSize, err := loadgen.ParseSize(*chunk)
+	if err != nil || chunkSize == 0 {
+		return fmt.Errorf("%w: invalid chunk size: %q", errBadArguments, *chunk)
+	}
+
+	var tmpLimitBytes int
+	if *tmpLimit != "" {
+		if tmpLimitBytes, err = loadgen.ParseSize(*tmpLimit); err != nil || tmpLimitBytes == 0 {
+			return fmt.Errorf("%w: invalid temporary space limit: %q", errBadArguments, *tmpLimit)
+		}
+	}
+
+	poolOptions, err := output.poolOptions()
+	if err != nil {
+		return err
+	}
+
+	in := os.Stdin
+	if *input != "" {
+		if in, err = os.Open(*input); err != nil {
+			return err
+		}
+		defer in.Close()
+	}
+
+	out := os.Stdout
+	if *outFile != "" {
+		if out, err = os.Create(*outFile); err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+
+	return externalSort(in, out, sortOptions{
+		chunkSize:  chunkSize,
+		maxThreads: uint32(*threads),
+		tmpDir:     *tmpDir,
+		tmpLimit:   int64(tmpLimitBytes),
+
+		poolOptions: poolOptions,
+	})
+}
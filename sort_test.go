@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestExternalSort(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	r := rand.New(rand.NewSource(0x2373871))
+
+	const N = 5000
+	lines := make([]string, N)
+	for i := range lines {
+		lines[i] = strconv.FormatInt(r.Int63(), 36) + strings.Repeat("x", r.Intn(32))
+	}
+	input := strings.Join(lines, "\n") // no trailing newline
+
+	tmpDir := t.TempDir()
+
+	// Chunks are much smaller than the input, so many runs have to be merged.
+	var out bytes.Buffer
+	err := externalSort(strings.NewReader(input), &out, sortOptions{chunkSize: 1024, maxThreads: 4, tmpDir: tmpDir})
+	assert.NoError(t, err)
+
+	sort.Strings(lines)
+	assert.Equal(t, strings.Join(lines, "\n")+"\n", out.String())
+
+	// Temporary runs are removed.
+	entries, err := os.ReadDir(tmpDir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestExternalSortMergesInPasses(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	lines := make([]string, 1000)
+	for i := range lines {
+		lines[i] = strconv.Itoa((i * 7919) % 1000)
+	}
+	input := strings.Join(lines, "\n") + "\n"
+
+	space, err := NewTempSpace(t.TempDir(), 0)
+	assert.NoError(t, err)
+	defer space.Close()
+
+	// About 50 runs merged 3 at a time need several passes.
+	var runs []string
+	for i := 0; i < len(lines); i += 20 {
+		name := fmt.Sprintf("run-%05d", i)
+		assert.NoError(t, sortChunk([]byte(strings.Join(lines[i:i+20], "\n")+"\n"), space, name))
+		runs = append(runs, filepath.Join(space.Dir(), name))
+	}
+	runs, err = reduceRuns(runs, space, 3)
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, len(runs), 3)
+
+	// Only the runs left for the final merge remain.
+	entries, err := os.ReadDir(space.Dir())
+	assert.NoError(t, err)
+	assert.Len(t, entries, len(runs))
+
+	var out bytes.Buffer
+	assert.NoError(t, mergeRuns(runs, &out))
+	sort.Strings(lines)
+	assert.Equal(t, strings.Join(lines, "\n")+"\n", out.String())
+
+	// The whole sort with a small fan-in.
+	out.Reset()
+	assert.NoError(t, externalSort(strings.NewReader(input), &out, sortOptions{chunkSize: 64, mergeFanIn: 4, tmpDir: t.TempDir()}))
+	assert.Equal(t, strings.Join(lines, "\n")+"\n", out.String())
+}
+
+func TestExternalSortLongLinesAndEmptyInput(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	// Lines longer than a chunk are kept intact.
+	input := strings.Repeat("b", 100) + "\n" + strings.Repeat("a", 300) + "\n" + "c\n"
+
+	var out bytes.Buffer
+	assert.NoError(t, externalSort(strings.NewReader(input), &out, sortOptions{chunkSize: 16, tmpDir: t.TempDir()}))
+	assert.Equal(t, strings.Repeat("a", 300)+"\n"+strings.Repeat("b", 100)+"\n"+"c\n", out.String())
+
+	out.Reset()
+	assert.NoError(t, externalSort(strings.NewReader(""), &out, sortOptions{chunkSize: 16, tmpDir: t.TempDir()}))
+	assert.Empty(t, out.String())
+}
@@ -0,0 +1,5 @@
+//go:build workerpool_strict
+
+package main
+
+const strictMode = true
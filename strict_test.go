@@ -0,0 +1,34 @@
+//go:build workerpool_strict
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStrictModePanicsOnMisuse(t *testing.T) {
+	p := newTestPool(t, 1)
+	assert.PanicsWithValue(t, ErrNilTask, func() { p.SubmitTask(nil) })
+	assert.PanicsWithValue(t, ErrNilTask, func() { p.SubmitRetry(context.Background(), RetryPolicy{}, nil) })
+	assert.PanicsWithValue(t, ErrNilTask, func() { NewResultCache[int, int](time.Minute, 0).SubmitOnce(p, 1, nil) })
+
+	p.Wait()
+	assert.PanicsWithValue(t, ErrPoolClosed, func() { p.SubmitTask(func() {}) })
+	assert.PanicsWithValue(t, errWaitCalledTwice, func() { p.Wait() })
+
+	q := NewQueue[int]()
+	assert.PanicsWithValue(t, ErrQueueEmpty, func() { q.Pop() })
+}
+
+func TestStrictModeAllowsHandledRejections(t *testing.T) {
+	var rejected int
+	p := newTestPool(t, 1, WithOnRejected(func(TaskInfo, RejectReason) { rejected++ }))
+	p.Wait()
+
+	assert.ErrorIs(t, p.SubmitTask(func() {}), ErrPoolClosed)
+	assert.Equal(t, 1, rejected)
+}
@@ -0,0 +1,143 @@
+package main
+
+import "sync"
+
+// SubPool runs tasks on the workers of its parent pool, but never more than its own limit at once.
+// It can be waited for and shut down independently of the parent, e.g. to cap and clean up the work of a single request.
+type SubPool struct {
+	parent *ThreadPool
+	limit  int
+
+	running int
+	// Tasks waiting for one of the running tasks to complete.
+	backlog []func()
+	// Tasks which were submitted but haven't completed or been dropped yet.
+	pending int
+	closed  bool
+	doneCh  chan struct{}
+	mu      sync.Mutex
+}
+
+// SubPool creates a sub-pool running at most maxConcurrent of its tasks at once, values below 1 mean 1.
+// Tasks of the sub-pool are submitted to p, so p must not be waited for before the sub-pool.
+func (p *ThreadPool) SubPool(maxConcurrent int) *SubPool {
+	return &SubPool{
+		parent: p,
+		limit:  max(maxConcurrent, 1),
+		doneCh: make(chan struct{}),
+	}
+}
+
+// SubmitTask never blocks, tasks exceeding the limit wait in the sub-pool until a running task completes.
+// Returns ErrPoolClosed once Wait or Shutdown was called, or if the parent pool rejects the task.
+func (s *SubPool) SubmitTask(task func()) error {
+	if task == nil {
+		return misuse(ErrNilTask)
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return misuse(ErrPoolClosed)
+	}
+
+	s.pending++
+	if s.running == s.limit {
+		s.backlog = append(s.backlog, task)
+		s.mu.Unlock()
+		return nil
+	}
+
+	// Reserve the slot and submit without holding the lock: a rejection runs the parent's WithOnRejected callback,
+	// which may use the sub-pool.
+	s.running++
+	s.mu.Unlock()
+
+	if err := s.parent.SubmitTask(s.wrap(task)); err != nil {
+		s.mu.Lock()
+		s.pending--
+		s.mu.Unlock()
+
+		// Tasks could have been put to the backlog in the meantime, waiting for the reserved slot.
+		s.releaseSlot()
+		return err
+	}
+	return nil
+}
+
+// Runs the task and hands its slot to the next task in the backlog.
+func (s *SubPool) wrap(task func()) func() {
+	return func() {
+		defer s.taskDone()
+		task()
+	}
+}
+
+func (s *SubPool) taskDone() {
+	s.mu.Lock()
+	s.pending--
+	s.mu.Unlock()
+
+	s.releaseSlot()
+}
+
+// Hands a slot to the next task in the backlog, or frees it if the backlog is empty.
+func (s *SubPool) releaseSlot() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The completing task keeps the parent open, but the parent could reject the task for other reasons.
+	// A rejected task is dropped, the parent reports it to its WithOnRejected callback.
+	for len(s.backlog) != 0 {
+		next := s.backlog[0]
+		s.backlog[0] = nil
+		s.backlog = s.backlog[1:]
+
+		s.mu.Unlock()
+		err := s.parent.SubmitTask(s.wrap(next))
+		s.mu.Lock()
+
+		if err == nil {
+			return
+		}
+		s.pending--
+	}
+
+	s.running--
+	s.signalDone()
+}
+
+// Must be called with the mutex held.
+func (s *SubPool) signalDone() {
+	if s.closed && s.pending == 0 {
+		select {
+		case <-s.doneCh:
+		default:
+			close(s.doneCh)
+		}
+	}
+}
+
+// Wait blocks until all the submitted tasks complete, no more tasks could be submitted afterwards.
+func (s *SubPool) Wait() {
+	s.mu.Lock()
+	s.closed = true
+	s.signalDone()
+	s.mu.Unlock()
+
+	<-s.doneCh
+}
+
+// Shutdown drops the tasks which haven't started yet and waits for the running ones to complete.
+// Returns the number of dropped tasks.
+func (s *SubPool) Shutdown() int {
+	s.mu.Lock()
+	s.closed = true
+	dropped := len(s.backlog)
+	s.backlog = nil
+	s.pending -= dropped
+	s.mu.Unlock()
+
+	s.Wait()
+	return dropped
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubPoolLimitsConcurrency(t *testing.T) {
+	skipInStrictMode(t)
+
+	p := newTestPool(t, 8)
+	sub := p.SubPool(2)
+
+	var running, peak int32
+	const TASKS_COUNT = 50
+	for i := 0; i < TASKS_COUNT; i++ {
+		assert.NoError(t, sub.SubmitTask(func() {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				old := atomic.LoadInt32(&peak)
+				if n <= old || atomic.CompareAndSwapInt32(&peak, old, n) {
+					break
+				}
+			}
+			time.Sleep(100 * time.Microsecond)
+			atomic.AddInt32(&running, -1)
+		}))
+	}
+	sub.Wait()
+
+	assert.LessOrEqual(t, atomic.LoadInt32(&peak), int32(2))
+	assert.Zero(t, atomic.LoadInt32(&running))
+	assert.ErrorIs(t, sub.SubmitTask(func() {}), ErrPoolClosed)
+
+	// The parent is still open.
+	assert.NoError(t, p.SubmitTask(func() {}))
+	p.Wait()
+	assertAllTasksDone(t, p, TASKS_COUNT+1)
+}
+
+func TestSubPoolShutdownDropsQueuedTasks(t *testing.T) {
+	skipInStrictMode(t)
+
+	p := newTestPool(t, 4)
+	sub := p.SubPool(1)
+	other := p.SubPool(1)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	sub.SubmitTask(func() {
+		close(started)
+		<-release
+	})
+	<-started
+
+	var runs int32
+	for i := 0; i < 10; i++ {
+		sub.SubmitTask(func() { atomic.AddInt32(&runs, 1) })
+	}
+
+	dropped := make(chan int)
+	go func() { dropped <- sub.Shutdown() }()
+	assert.Eventually(t, func() bool {
+		sub.mu.Lock()
+		defer sub.mu.Unlock()
+		return sub.closed
+	}, time.Second, time.Millisecond)
+
+	close(release)
+	assert.Equal(t, 10, <-dropped)
+	assert.Zero(t, atomic.LoadInt32(&runs))
+
+	// Sub-pools are independent of each other.
+	var otherRuns int32
+	other.SubmitTask(func() { atomic.AddInt32(&otherRuns, 1) })
+	other.Wait()
+	assert.EqualValues(t, 1, atomic.LoadInt32(&otherRuns))
+	assert.ErrorIs(t, sub.SubmitTask(func() {}), ErrPoolClosed)
+}
+
+func TestSubPoolOfClosedParent(t *testing.T) {
+	skipInStrictMode(t)
+
+	p := newTestPool(t, 1)
+	sub := p.SubPool(1)
+	p.Wait()
+
+	assert.ErrorIs(t, sub.SubmitTask(func() {}), ErrPoolClosed)
+	sub.Wait()
+}
+
+func TestSubPoolDropsBacklogRejectedByParent(t *testing.T) {
+	var rejected uint32
+	p := newTestPool(t, 1, WithOnRejected(func(task TaskInfo, reason RejectReason) {
+		atomic.AddUint32(&rejected, 1)
+	}))
+	sub := p.SubPool(1)
+
+	// A running task always keeps the parent open, so simulate one completing after the parent closed.
+	sub.running = 1
+	sub.pending = 3
+	sub.backlog = []func(){func() {}, func() {}}
+	p.Wait()
+	sub.taskDone()
+
+	sub.Wait()
+	assert.EqualValues(t, 2, atomic.LoadUint32(&rejected))
+	assert.Equal(t, 0, sub.running)
+	assert.Equal(t, 0, sub.pending)
+}
+
+func TestSubPoolRejectionCallbackUsesSubPool(t *testing.T) {
+	skipInStrictMode(t)
+
+	var sub *SubPool
+	var resubmitted bool
+	var resubmitErr error
+	p := newTestPool(t, 1, WithOnRejected(func(task TaskInfo, reason RejectReason) {
+		// Runs while the rejected submission is in progress, the sub-pool must not be locked by then.
+		if !resubmitted {
+			resubmitted = true
+			resubmitErr = sub.SubmitTask(func() {})
+		}
+	}))
+	sub = p.SubPool(2)
+	p.Wait()
+
+	assert.ErrorIs(t, sub.SubmitTask(func() {}), ErrPoolClosed)
+	assert.ErrorIs(t, resubmitErr, ErrPoolClosed)
+
+	sub.Wait()
+	assert.Equal(t, 0, sub.running)
+	assert.Equal(t, 0, sub.pending)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+// TempSpace is a temporary directory of a single run, holding at most limit bytes of temporary files.
+// It is removed with all its files by Close, or by the interrupt handler if the process is interrupted.
+type TempSpace struct {
+	dir   string
+	limit int64 // 0 means no limit
+	used  int64
+	mu    sync.Mutex
+}
+
+// Temporary spaces which haven't been closed yet, removed if the process is interrupted.
+var liveTempSpaces = struct {
+	spaces map[*TempSpace]struct{}
+	mu     sync.Mutex
+}{spaces: make(map[*TempSpace]struct{})}
+
+// NewTempSpace creates a temporary directory under parent, os.TempDir() if empty.
+func NewTempSpace(parent string, limit int64) (*TempSpace, error) {
+	dir, err := os.MkdirTemp(parent, "workerpool-")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &TempSpace{dir: dir, limit: limit}
+
+	liveTempSpaces.mu.Lock()
+	liveTempSpaces.spaces[s] = struct{}{}
+	liveTempSpaces.mu.Unlock()
+
+	return s, nil
+}
+
+func (s *TempSpace) Dir() string {
+	return s.dir
+}
+
+// Create creates a temporary file in the space, writes fail with ErrTempSpaceFull once the space's limit is reached.
+func (s *TempSpace) Create(name string) (*TempFile, error) {
+	f, err := os.Create(filepath.Join(s.dir, name))
+	if err != nil {
+		return nil, err
+	}
+	return &TempFile{File: f, space: s}, nil
+}
+
+// Remove removes a closed temporary file of the space, its size no longer counts towards the limit.
+func (s *TempSpace) Remove(name string) error {
+	path := filepath.Join(s.dir, name)
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.used -= info.Size()
+	s.mu.Unlock()
+	return nil
+}
+
+// Accounts for n more bytes, fails if they don't fit into the limit.
+func (s *TempSpace) reserve(n int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.limit > 0 && s.used+n > s.limit {
+		return fmt.Errorf("%w: %d bytes used out of %d", ErrTempSpaceFull, s.used, s.limit)
+	}
+	s.used += n
+	return nil
+}
+
+// Used returns the number of bytes written to the temporary files.
+func (s *TempSpace) Used() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.used
+}
+
+// Close removes the directory with all the temporary files, it is safe to call it more than once.
+// The files have to be closed by then on platforms which don't allow removing open files.
+func (s *TempSpace) Close() error {
+	liveTempSpaces.mu.Lock()
+	delete(liveTempSpaces.spaces, s)
+	liveTempSpaces.mu.Unlock()
+
+	return os.RemoveAll(s.dir)
+}
+
+type TempFile struct {
+	*os.File
+	space *TempSpace
+}
+
+func (f *TempFile) Write(p []byte) (int, error) {
+	if err := f.space.reserve(int64(len(p))); err != nil {
+		return 0, err
+	}
+	return f.File.Write(p)
+}
+
+// WriteString and ReadFrom go through Write, the ones of the embedded file would let io.WriteString
+// and io.Copy bypass the limit.
+func (f *TempFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *TempFile) ReadFrom(r io.Reader) (int64, error) {
+	return io.Copy(struct{ io.Writer }{f}, r)
+}
+
+// Removes the temporary spaces which are still in use and exits once the process receives SIGINT or SIGTERM.
+// Returns a function which uninstalls the handler.
+func removeTempSpacesOnInterrupt(exitCode int) (stop func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-signals:
+			liveTempSpaces.mu.Lock()
+			for s := range liveTempSpaces.spaces {
+				os.RemoveAll(s.dir)
+			}
+			liveTempSpaces.mu.Unlock()
+
+			fmt.Fprintf(os.Stderr, "%s: temporary files removed\n", sig)
+			os.Exit(exitCode)
+		case <-done:
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
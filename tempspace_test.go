@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestTempSpaceLimit(t *testing.T) {
+	space, err := NewTempSpace(t.TempDir(), 10)
+	assert.NoError(t, err)
+
+	f, err := space.Create("a")
+	assert.NoError(t, err)
+	_, err = f.Write([]byte("0123456"))
+	assert.NoError(t, err)
+	_, err = f.Write([]byte("7890"))
+	assert.ErrorIs(t, err, ErrTempSpaceFull)
+	assert.NoError(t, f.Close())
+	assert.EqualValues(t, 7, space.Used())
+
+	// Copies are accounted too.
+	f, err = space.Create("b")
+	assert.NoError(t, err)
+	_, err = io.Copy(f, strings.NewReader("0123456789"))
+	assert.ErrorIs(t, err, ErrTempSpaceFull)
+	assert.NoError(t, f.Close())
+	assert.NoError(t, space.Remove("b"))
+
+	// Removed files free their space.
+	assert.NoError(t, space.Remove("a"))
+	assert.EqualValues(t, 0, space.Used())
+	assert.Error(t, space.Remove("a"))
+
+	assert.NoError(t, space.Close())
+	assert.NoError(t, space.Close())
+	_, err = os.Stat(space.Dir())
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestExternalSortTempSpaceLimit(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	tmpDir := t.TempDir()
+	input := strings.Repeat("line\n", 1000)
+
+	var out bytes.Buffer
+	err := externalSort(strings.NewReader(input), &out, sortOptions{chunkSize: 100, maxThreads: 2, tmpDir: tmpDir, tmpLimit: 1000})
+	assert.ErrorIs(t, err, ErrTempSpaceFull)
+
+	// Runs are removed on failure as well.
+	entries, err := os.ReadDir(tmpDir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
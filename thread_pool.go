@@ -1,73 +1,203 @@
 package main
 
 import (
+	"context"
 	"runtime"
 	"sync"
 	"sync/atomic"
+	"time"
+
+	"github.com/isnastish/workers_prototype/pkg/container"
 )
 
 type ThreadFunc func()
 
-type Metrics struct {
-	tasksSubmitted   uint32
-	tasksDone        uint32
-	tasksQueued      uint32
-	routinesSpawned  uint32
-	routinesFinished uint32
+// How often WaitIdle checks whether the pool ran out of tasks.
+const idleCheckInterval = 100 * time.Microsecond
+
+// A task travelling through the pending queue and the ready channel.
+// Tasks submitted with SubmitTaskCtx carry the context they were submitted with.
+type queuedTask struct {
+	fn      ThreadFunc
+	ctxFn   func(ctx context.Context)
+	ctx     context.Context
+	attempt int
+	id      uint64
+	name    string
+	group   string
+
+	// Set only if slow tasks are logged, used to report how long the task waited in the queues.
+	submitted time.Time
+
+	// Producer of the task, see SubmitFrom.
+	submitter string
+
+	// Tasks grouped by the dispatcher, see WithBatching. A batch itself is not a task and has no other fields set.
+	batch []queuedTask
+}
+
+// Implemented by Queue and InstrumentedQueue.
+type taskQueue interface {
+	Push(task queuedTask) error
+	TryPop(task *queuedTask) bool
+	Empty() bool
+	Size() int
 }
 
 type ThreadPool struct {
 	maxThreads uint32
 
-	submitQueue  *Queue[ThreadFunc]
-	waitingQueue *Queue[ThreadFunc]
-	workQueue    *Queue[ThreadFunc]
+	// Current limit of concurrently running workers, equals to maxThreads unless autoscaling is enabled.
+	threadLimit uint32
+	autoscaler  *autoscaler
+
+	// Workers spawned at construction, which stay alive waiting for tasks until the pool is closed.
+	minWorkers uint32
+	stopCh     chan struct{}
+
+	// Wakes the dispatcher parked while it has nothing to do, see park.
+	wakeCh chan struct{}
+
+	// Separate pool for IO-bound tasks, which is not limited by the number of CPUs.
+	ioPool *ThreadPool
+	// Set on the IO pool, the pool it belongs to counts its tasks as pending too.
+	cpuPool *ThreadPool
+
+	memoryGuard *memoryGuard
+
+	scheduling Scheduling
+	queueStats bool
+	sequential bool
+
+	// Number of shards of the pending queue, 0 if it isn't sharded.
+	queueShards int
+
+	// CPUs workers are pinned to, empty unless the pool was created WithCPUAffinity on a supported platform.
+	cpus []int
+
+	breaker *circuitBreaker
+	groups  *groupRegistry
+
+	recorder   *Recorder
+	replayer   *replayer
+	nextTaskID uint64
+
+	slowTaskThreshold time.Duration
+
+	batcher *batcher
+
+	history *history
+
+	metricsSink     MetricsSink
+	metricsLastTick time.Time
+
+	fair       bool
+	submitters submitterCounters
+
+	onRejected func(task TaskInfo, reason RejectReason)
+
+	clock Clock
+
+	// Submitted tasks wait in the pending queue until the dispatcher hands them over to the workers.
+	pendingQueue taskQueue
+	readyCh      chan queuedTask
+
+	// Number of tasks handed over to the workers which haven't completed yet, never exceeds threadLimit
+	// unless the limit was lowered by the autoscaler.
+	inFlight int32
 
 	wg          sync.WaitGroup
 	doneCh      chan struct{}
 	threadCount uint32
 
-	metrics Metrics
+	nextWorkerID  uint32
+	freeWorkerIDs *container.Stack[uint32]
+	heartbeats    []heartbeat
+
+	metrics counters
 
 	waiting int32
 
-	blocked bool
+	blocked atomic.Bool
+
+	// Number of tasks which were submitted but haven't completed yet.
+	pending int64
 
 	// NOTE: logsEnabled flag should be removed once I figure out how to do concurrent logging.
 	// Because currently, with logging enabled, some tests would block forewer due to the fact
 	// that the writer is not protected with a mutex and prohibits simultaneous writes.
 	// Sometimes all the logs could be displayed correctly without blocking, but sometimes they don't.
 	logsEnabled bool
+	logSampler  *logSampler
 	*Logger
 }
 
 func NewPool(numThreads ...uint32) *ThreadPool {
-	// Get a number of cores usable by the current process.
-	// This is equivalent to maximum amount of goroutines (workers) created.
-	hardwareCPU := uint32(runtime.NumCPU())
-
 	var maxThreads uint32
 	if len(numThreads) > 0 {
-		if numThreads[0] < 1 || numThreads[0] > hardwareCPU {
-			maxThreads = hardwareCPU
-		} else {
-			maxThreads = numThreads[0]
-		}
-	} else {
-		maxThreads = hardwareCPU
+		maxThreads = numThreads[0]
+	}
+	return NewPoolWithOptions(maxThreads)
+}
+
+// Creates a pool with at most maxThreads workers, configured with the supplied options.
+// maxThreads equal to 0 or exceeding the number of CPUs is clamped to the number of CPUs.
+func NewPoolWithOptions(maxThreads uint32, options ...Option) *ThreadPool {
+	p := newThreadPool(clampToCPU(maxThreads))
+
+	for _, option := range options {
+		option(p)
+	}
+
+	if p.sequential || sequentialFromEnv() {
+		p.makeSequential()
 	}
 
-	p := &ThreadPool{
-		maxThreads:   maxThreads,
-		submitQueue:  NewQueue[ThreadFunc](),
-		waitingQueue: NewQueue[ThreadFunc](),
-		workQueue:    NewQueue[ThreadFunc](),
-		wg:           sync.WaitGroup{},
-		doneCh:       make(chan struct{}),
-		Logger:       NewLogger("debug"),
+	p.initQueues()
 
-		// TODO: Uncomment this line once the logging is thread-safe
-		// logsEnabled: true,
+	// Sized once the options are applied, WithCPUWorkers may have changed the number of workers.
+	p.heartbeats = make([]heartbeat, p.maxThreads)
+	p.readyCh = make(chan queuedTask, p.maxThreads)
+	if p.ioPool != nil {
+		p.ioPool.heartbeats = make([]heartbeat, p.ioPool.maxThreads)
+		p.ioPool.readyCh = make(chan queuedTask, p.ioPool.maxThreads)
+	}
+
+	if p.autoscaler != nil {
+		p.threadLimit = min(p.autoscaler.minThreads, p.maxThreads)
+	}
+
+	p.minWorkers = min(p.minWorkers, p.maxThreads)
+	p.threadLimit = max(p.threadLimit, p.minWorkers)
+	for i := uint32(0); i < p.minWorkers; i++ {
+		p.spawnWarmWorker()
+	}
+
+	if p.recorder != nil && p.recorder.origin.IsZero() {
+		p.recorder.origin = p.clock.Now()
+	}
+
+	if p.replayer != nil {
+		p.replayer.clock = p.clock
+	}
+
+	if p.history != nil {
+		p.history.lastTick = p.clock.Now()
+	}
+
+	if p.metricsSink != nil {
+		p.metricsLastTick = p.clock.Now()
+	}
+
+	// Registered once the options are applied, so only the last of repeated WithMemoryLimit options counts.
+	if p.memoryGuard != nil {
+		p.memoryGuard.acquire()
+	}
+
+	if p.ioPool != nil {
+		p.ioPool.onRejected = p.onRejected
+		p.ioPool.clock = p.clock
+		go p.ioPool.processTasks()
 	}
 
 	go p.processTasks()
@@ -75,125 +205,631 @@ func NewPool(numThreads ...uint32) *ThreadPool {
 	return p
 }
 
-func (p *ThreadPool) SubmitTask(task func()) {
-	if nil == task {
+func newThreadPool(maxThreads uint32) *ThreadPool {
+	return &ThreadPool{
+		maxThreads:    maxThreads,
+		threadLimit:   maxThreads,
+		pendingQueue:  NewQueue[queuedTask](),
+		freeWorkerIDs: container.NewSyncStack[uint32](),
+		groups:        newGroupRegistry(),
+		wg:            sync.WaitGroup{},
+		doneCh:        make(chan struct{}),
+		wakeCh:        make(chan struct{}, 1),
+		stopCh:        make(chan struct{}),
+		clock:         realClock{},
+		Logger:        NewLogger("debug"),
+
+		// TODO: Uncomment this line once the logging is thread-safe
+		// logsEnabled: true,
+	}
+}
+
+// Get a number of cores usable by the current process.
+// This is equivalent to maximum amount of goroutines (workers) running CPU-bound tasks.
+func clampToCPU(numThreads uint32) uint32 {
+	hardwareCPU := uint32(runtime.NumCPU())
+	if numThreads < 1 || numThreads > hardwareCPU {
+		return hardwareCPU
+	}
+	return numThreads
+}
+
+// SubmitTask never blocks, so it is safe to call it from inside a running task, even when all the workers are busy.
+// After Wait() was called submissions are accepted as long as some earlier submitted task hasn't completed yet,
+// which is what lets running tasks submit more tasks, and Wait() doesn't return until they complete as well.
+// The pool can't tell which goroutine submits, so submissions from outside of the tasks are accepted then too.
+// A task must not block waiting for completion of a task it submitted, use Graph for dependent tasks instead.
+func (p *ThreadPool) SubmitTask(task func()) error {
+	return p.submit(queuedTask{fn: task, attempt: 1})
+}
+
+// SubmitNamed submits a task like SubmitTask, the name identifies the task in the logs (see WithSlowTaskLog).
+func (p *ThreadPool) SubmitNamed(name string, task func()) error {
+	return p.submit(queuedTask{fn: task, attempt: 1, name: name})
+}
+
+// SubmitTaskCtx submits a task receiving a context derived from ctx, which additionally carries
+// the ID of the worker running the task and the attempt number, see WorkerIDFromContext and AttemptFromContext.
+func (p *ThreadPool) SubmitTaskCtx(ctx context.Context, task func(ctx context.Context)) error {
+	return p.submit(queuedTask{ctxFn: task, ctx: ctx, attempt: 1})
+}
+
+func (p *ThreadPool) submit(task queuedTask) error {
+	err := p.enqueue(task)
+	if err == ErrPoolClosed {
+		p.reject(task, RejectPoolClosed)
+		// Rejections handled by the callback are expected.
+		if p.onRejected != nil {
+			return err
+		}
+	}
+	return misuse(err)
+}
+
+func (p *ThreadPool) enqueue(task queuedTask) error {
+	if nil == task.fn && nil == task.ctxFn {
 		if p.logsEnabled {
 			p.logger.Info().Msg("nil task was submitted")
 		}
-		return
+		return ErrNilTask
 	}
 
-	if p.blocked {
+	// A running task keeps pending above zero, so a submission from inside of it is never rejected.
+	if !p.holdPending() {
 		if p.logsEnabled {
 			p.logger.Info().Msg("thread pool blocked, no more tasks could be submitted")
 		}
-		return
+		return ErrPoolClosed
 	}
 
-	if p.logsEnabled {
+	if p.logEvent(EventTaskSubmitted) {
 		p.logger.Info().Msg("task has been submitted")
 	}
 
-	p.submitQueue.Push(task)
+	task.id = atomic.AddUint64(&p.nextTaskID, 1) - 1
+	if p.slowTaskThreshold > 0 || p.metricsSink != nil {
+		task.submitted = p.clock.Now()
+	}
+	if task.group != "" {
+		p.groups.queue(task.group, task.id)
+	}
+	p.submitterQueued(task)
+	p.pendingQueue.Push(task)
+	p.wake()
 	atomic.AddUint32(&p.metrics.tasksSubmitted, 1)
+	if atomic.LoadInt32(&p.inFlight) >= int32(atomic.LoadUint32(&p.threadLimit)) {
+		if p.logEvent(EventTaskQueued) {
+			p.logger.Info().Msg("all workers are busy, task waits in the pending queue")
+		}
+		atomic.AddUint32(&p.metrics.tasksQueued, 1)
+	}
+	if p.metricsSink != nil {
+		p.metricsSink.Counter(MetricTasksSubmitted, 1)
+	}
+
+	return nil
+}
+
+// Submits a task to the workers of the given class.
+// IO-bound tasks run on the CPU-bound workers unless the pool was created WithIOWorkers.
+// Tasks of both classes count as earlier submitted tasks for SubmitTask, so a running task may submit tasks
+// of either class after Wait() was called.
+func (p *ThreadPool) SubmitTaskClass(class TaskClass, task func()) error {
+	return p.workersFor(class).SubmitTask(task)
+}
+
+// Returns the pool running tasks of the given class.
+func (p *ThreadPool) workersFor(class TaskClass) *ThreadPool {
+	if class == IOBound && p.ioPool != nil {
+		return p.ioPool
+	}
+	return p
 }
 
 func (p *ThreadPool) processTasks() {
 	var running bool = true
 	for running {
-		// Firstly, process all the tasks from the waiting queue until it is empty.
-		if !p.waitingQueue.Empty() {
-			var wTask ThreadFunc
-			for p.waitingQueue.TryPop(&wTask) {
-				p.workQueue.Push(wTask)
-
-				var sTask ThreadFunc
-				if p.submitQueue.TryPop(&sTask) {
-					p.waitingQueue.Push(sTask)
-				}
-			}
-			continue
+		if p.autoscaler != nil {
+			p.autoscale()
 		}
 
-		var task ThreadFunc
-		if p.submitQueue.TryPop(&task) {
-			// New workers can be spawned only if we haven't reached the limit of maximum workers,
-			// or we've reached the limit but then some of them finished their work, in that case
-			// new could be created.
-			if atomic.LoadUint32(&p.threadCount) < p.maxThreads {
-				p.workQueue.Push(task)
+		if p.history != nil {
+			p.sampleHistory(false)
+		}
 
-				if p.logsEnabled {
-					p.logger.Info().Msg("worker created")
-				}
+		if p.metricsSink != nil {
+			p.reportGauges(false)
+		}
 
-				p.wg.Add(1)
-				go p.worker()
+		// Tasks handed over before the dispatch was paused must complete for the pause to end.
+		p.ensureWorker()
 
-				p.metrics.routinesSpawned++
-			} else {
-				// If all the workers are busy, put task into a waiting queue for further processing.
-				if p.logsEnabled {
-					p.logger.Info().Msg("all workers are busy, task is pushed to the waiting queue")
-				}
+		if p.memoryGuard != nil && p.memoryPressure() {
+			p.park()
+			continue
+		}
 
-				p.waitingQueue.Push(task)
-				p.metrics.tasksQueued++
-			}
-		} else {
-			if atomic.LoadInt32(&p.waiting) != 0 {
+		// All the workers are busy, tasks stay in the pending queue until one of them completes.
+		if atomic.LoadInt32(&p.inFlight) >= int32(atomic.LoadUint32(&p.threadLimit)) {
+			p.park()
+			continue
+		}
+
+		var task queuedTask
+		if !p.pendingQueue.TryPop(&task) {
+			if atomic.LoadInt32(&p.waiting) != 0 && atomic.LoadInt64(&p.pending) == 0 {
 				running = false
+				continue
+			}
+
+			// Nothing to dispatch until a task is submitted.
+			p.park()
+			continue
+		}
+
+		if p.batcher != nil {
+			if task = p.batcher.collect(task, p.pendingQueue); task.batch != nil {
+				atomic.AddUint32(&p.metrics.batches, 1)
 			}
 		}
+
+		// Never blocks, the channel has room for maxThreads tasks and at most threadLimit are in flight.
+		atomic.AddInt32(&p.inFlight, 1)
+		p.readyCh <- task
+		p.ensureWorker()
 	}
 
-	// Wait for all spawned workers to finish their work.
+	// Release the pre-warmed workers and wait for all spawned workers to finish their work.
+	close(p.stopCh)
 	p.wg.Wait()
 
+	if p.history != nil {
+		p.sampleHistory(true)
+	}
+
+	if p.metricsSink != nil {
+		p.reportGauges(true)
+	}
+
+	if p.memoryGuard != nil {
+		p.memoryGuard.release()
+	}
+
 	// Notify Wait() procedure that the channel was closed.
 	close(p.doneCh)
 }
 
-func (p *ThreadPool) Debug_GetMetrics() Metrics {
-	return p.metrics
+func (p *ThreadPool) spawnWorker() {
+	if p.logEvent(EventWorkerCreated) {
+		p.logger.Info().Msg("worker created")
+	}
+
+	p.wg.Add(1)
+	go p.worker(p.acquireWorker())
+}
+
+// Spawns a worker which doesn't exit once it runs out of tasks, but blocks until more tasks arrive.
+func (p *ThreadPool) spawnWarmWorker() {
+	p.wg.Add(1)
+	go p.warmWorker(p.acquireWorker())
+}
+
+// Accounts for a new worker and returns its ID.
+func (p *ThreadPool) acquireWorker() uint32 {
+	// Count the worker right away, so the limit is respected before the goroutine gets scheduled.
+	atomic.AddUint32(&p.threadCount, 1)
+	atomic.AddUint32(&p.metrics.routinesSpawned, 1)
+
+	// Reuse IDs of finished workers, so IDs of running workers are always below maxThreads.
+	var id uint32
+	if !p.freeWorkerIDs.TryPop(&id) {
+		id = p.nextWorkerID
+		p.nextWorkerID++
+	}
+	p.heartbeats[id].reset(true)
+	return id
 }
 
-func (p *ThreadPool) worker() {
-	if p.logsEnabled {
+// Accounts for a finished worker, so other workers can be spawned in its place.
+func (p *ThreadPool) releaseWorker(id uint32) {
+	p.heartbeats[id].reset(false)
+	p.freeWorkerIDs.Push(id)
+
+	// Decrement threads count so other workers can be spawned in its place.
+	atomic.AddUint32(&p.threadCount, ^uint32(0))
+	atomic.AddUint32(&p.metrics.routinesFinished, 1)
+
+	// A task could have been handed over right before the worker exited, the dispatcher spawns one for it.
+	p.wake()
+}
+
+// Spawns a worker if there are fewer workers than tasks handed over to them. A worker which saw no ready tasks
+// could have exited right before a task was handed over, so this is checked on every turn of the dispatcher,
+// and exiting workers wake it up.
+func (p *ThreadPool) ensureWorker() {
+	if atomic.LoadUint32(&p.threadCount) < uint32(atomic.LoadInt32(&p.inFlight)) {
+		p.spawnWorker()
+	}
+}
+
+// Marks a task handed over to a worker as completed, so the dispatcher can hand over the next one.
+func (p *ThreadPool) taskCompleted() {
+	atomic.AddInt32(&p.inFlight, -1)
+	p.wake()
+}
+
+// Blocks the dispatcher until the state it waits for could have changed: a task was submitted or completed,
+// a worker exited, Wait() was called or the last pending task completed, see wake. The autoscaler, the memory guard,
+// the history and the metrics sink act on time, so with any of them the dispatcher also wakes up periodically.
+func (p *ThreadPool) park() {
+	interval := p.parkInterval()
+	if interval == 0 {
+		<-p.wakeCh
+		return
+	}
+
+	timer := p.clock.NewTimer(interval)
+	defer timer.Stop()
+	select {
+	case <-p.wakeCh:
+	case <-timer.C():
+	}
+}
+
+// Returns the period of the dispatcher's time based work, 0 if it has none.
+func (p *ThreadPool) parkInterval() time.Duration {
+	var interval time.Duration
+	shorten := func(d time.Duration) {
+		if interval == 0 || d < interval {
+			interval = d
+		}
+	}
+
+	if p.memoryGuard != nil {
+		shorten(memoryCheckInterval)
+	}
+	if p.autoscaler != nil {
+		shorten(max(p.autoscaler.interval, time.Millisecond))
+	}
+	if p.history != nil {
+		shorten(historyInterval)
+	}
+	if p.metricsSink != nil {
+		shorten(metricsInterval)
+	}
+	return interval
+}
+
+// Never blocks, a wake-up sent while the dispatcher is busy is received by its next park.
+func (p *ThreadPool) wake() {
+	select {
+	case p.wakeCh <- struct{}{}:
+	default:
+	}
+}
+
+// Adjusts the worker limit once per autoscaler interval.
+func (p *ThreadPool) autoscale() {
+	a := p.autoscaler
+	now := p.clock.Now()
+	if now.Sub(a.lastTick) < a.interval {
+		return
+	}
+	a.lastTick = now
+
+	pending, ready := p.QueueDepths()
+	backlog := pending + ready
+	oldLimit := atomic.LoadUint32(&p.threadLimit)
+	newLimit := a.nextLimit(oldLimit, p.maxThreads, backlog)
+	atomic.StoreUint32(&p.threadLimit, newLimit)
+
+	if p.logsEnabled && newLimit != oldLimit {
+		p.logger.Info().Uint32("limit", newLimit).Msg("worker limit changed")
+	}
+}
+
+// Returns the number of submitted tasks waiting for a worker to become available,
+// and the number of tasks handed over to the workers which haven't started yet.
+// Both are sampled separately, so a task being handed over may be counted twice or not at all.
+func (p *ThreadPool) QueueDepths() (pending, ready int) {
+	return p.pendingQueue.Size(), len(p.readyCh)
+}
+
+// Number of workers running a task at the moment.
+func (p *ThreadPool) activeWorkers() int {
+	return max(int(atomic.LoadInt32(&p.inFlight))-len(p.readyCh), 0)
+}
+
+func (p *ThreadPool) worker(id uint32) {
+	if p.logEvent(EventWorkerStarted) {
 		p.logger.Info().Msg("worker started")
 	}
 
+	p.pinWorker(id)
+
 	defer func() {
-		if p.logsEnabled {
+		if p.logEvent(EventWorkerFinished) {
 			p.logger.Info().Msg("worker finished")
 		}
 		p.wg.Done()
 	}()
 
-	atomic.AddUint32(&p.threadCount, 1)
+	for {
+		var task queuedTask
+		select {
+		case task = <-p.readyCh:
+		default:
+			// The dispatcher hands over the next pending task as soon as it sees this worker's task completed,
+			// waiting for it is cheaper than exiting and having another worker spawned.
+			if p.pendingQueue.Empty() {
+				p.releaseWorker(id)
+				return
+			}
+			select {
+			case task = <-p.readyCh:
+			case <-p.stopCh:
+				p.releaseWorker(id)
+				return
+			}
+		}
+
+		p.execute(task, id)
+		p.taskCompleted()
+	}
+}
 
-	var task ThreadFunc
-	for !p.workQueue.Empty() {
-		if p.workQueue.TryPop(&task) {
-			atomic.AddUint32(&p.metrics.tasksDone, 1)
-			task()
+func (p *ThreadPool) warmWorker(id uint32) {
+	p.pinWorker(id)
+	defer p.wg.Done()
+
+	for {
+		select {
+		case task := <-p.readyCh:
+			p.execute(task, id)
+			p.taskCompleted()
+		case <-p.stopCh:
+			p.releaseWorker(id)
+			return
 		}
 	}
+}
 
-	// Decrement threads count so other workers can be spawned,
-	// in case the waiting queue is not empty and waiting for at least one worker to complete.
-	atomic.AddUint32(&p.threadCount, ^uint32(0))
-	atomic.AddUint32(&p.metrics.routinesFinished, 1)
+// Pins the worker's OS thread to a CPU, IDs of running workers are distinct, so are their CPUs.
+func (p *ThreadPool) pinWorker(id uint32) {
+	if len(p.cpus) == 0 {
+		return
+	}
+
+	// Never unlocked: the goroutine exits locked, so the runtime terminates the thread
+	// instead of reusing it with the changed affinity for other goroutines.
+	runtime.LockOSThread()
+
+	if err := pinThread(p.cpus[int(id)%len(p.cpus)]); err != nil && p.logsEnabled {
+		p.logger.Info().Err(err).Uint32("worker", id).Msg("failed to pin worker")
+	}
+}
+
+func (p *ThreadPool) execute(task queuedTask, workerID uint32) {
+	if task.batch != nil {
+		for _, t := range task.batch {
+			p.execute(t, workerID)
+		}
+		return
+	}
+
+	p.submitterDequeued(task, true)
+
+	if task.group != "" {
+		var cancel context.CancelFunc
+		if task.ctxFn != nil {
+			task.ctx, cancel = context.WithCancel(task.ctx)
+			defer cancel()
+		}
+		if !p.groups.start(task.group, task.id, cancel) {
+			p.skipCancelled()
+			return
+		}
+	}
+
+	atomic.AddUint32(&p.metrics.tasksDone, 1)
+
+	if p.replayer != nil {
+		p.replayer.await(task.id)
+	}
+
+	if p.recorder == nil && p.slowTaskThreshold == 0 && p.batcher == nil && p.metricsSink == nil {
+		p.runTask(task, workerID)
+		p.finishTask(task)
+		return
+	}
+
+	start := p.clock.Now()
+	p.runTask(task, workerID)
+	end := p.clock.Now()
+
+	if p.recorder != nil {
+		p.recorder.record(task.id, workerID, start, end)
+	}
+
+	if p.batcher != nil {
+		p.batcher.observe(end.Sub(start))
+	}
+
+	if p.metricsSink != nil {
+		p.metricsSink.Counter(MetricTasksCompleted, 1)
+		p.metricsSink.Histogram(MetricTaskDuration, end.Sub(start).Seconds())
+		p.metricsSink.Histogram(MetricTaskQueueWait, start.Sub(task.submitted).Seconds())
+	}
+
+	if p.slowTaskThreshold > 0 && end.Sub(start) >= p.slowTaskThreshold {
+		atomic.AddUint32(&p.metrics.slowTasks, 1)
+		p.logger.Warn().
+			Str("task", task.name).
+			Uint64("id", task.id).
+			Uint32("worker", workerID).
+			Dur("queue_wait", start.Sub(task.submitted)).
+			Dur("duration", end.Sub(start)).
+			Msg("slow task")
+	}
+
+	p.finishTask(task)
+}
+
+func (p *ThreadPool) finishTask(task queuedTask) {
+	if task.group != "" {
+		p.groups.finish(task.group, task.id)
+	}
+	p.releasePending()
+}
+
+// Accounts for a task which hasn't completed yet, returns false if the pool is closed.
+// Tasks of the IO workers are pending in the pool they belong to as well, and it decides whether the pair is closed,
+// so neither of the pools shuts down while a task on the other one could submit to it.
+func (p *ThreadPool) holdPending() bool {
+	owner := p
+	if p.cpuPool != nil {
+		owner = p.cpuPool
+	}
+	if atomic.AddInt64(&owner.pending, 1) == 1 && owner.blocked.Load() {
+		atomic.AddInt64(&owner.pending, -1)
+		return false
+	}
+	if owner != p {
+		atomic.AddInt64(&p.pending, 1)
+	}
+	return true
+}
+
+func (p *ThreadPool) releasePending() {
+	// The dispatcher of a waited for pool completes once nothing is pending.
+	if atomic.AddInt64(&p.pending, -1) == 0 {
+		p.wake()
+	}
+	if p.cpuPool != nil && atomic.AddInt64(&p.cpuPool.pending, -1) == 0 {
+		p.cpuPool.wake()
+	}
+}
+
+func (p *ThreadPool) runTask(task queuedTask, workerID uint32) {
+	h := &p.heartbeats[workerID]
+	h.started(task, p.clock.Now())
+	defer h.finished()
+
+	if task.ctxFn != nil {
+		task.ctxFn(context.WithValue(task.ctx, taskInfoKey{}, taskInfo{workerID: workerID, attempt: task.attempt}))
+		return
+	}
+	task.fn()
 }
 
 func (p *ThreadPool) Wait() {
-	// No more tasks could be submitted
-	p.blocked = true
+	// No more tasks could be submitted, except of the ones submitted by running tasks.
+	p.blocked.Store(true)
 
 	// Put the pool in a waiting state.
 	// That implies that all the earlier submitted tasks should run until their completion.
-	atomic.AddInt32(&p.waiting, 1)
+	if atomic.AddInt32(&p.waiting, 1) > 1 {
+		misuse(errWaitCalledTwice)
+	}
+	p.wake()
 
 	// Wait for all remaining tasks to complete. Shut down the pool
 	<-p.doneCh
+
+	// Pending tasks of the IO pool are counted above, so it has none left by now.
+	if p.ioPool != nil {
+		p.ioPool.Wait()
+	}
+
+	p.Logger.Sync()
+}
+
+// WaitIdle blocks until all the submitted tasks, including the ones submitted by running tasks, have completed.
+// Unlike Wait() it leaves the pool open, so it can be used as a synchronization point between phases of work.
+// Returns ctx.Err() if ctx is done before the pool became idle.
+func (p *ThreadPool) WaitIdle(ctx context.Context) error {
+	for !p.idle() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(idleCheckInterval):
+		}
+	}
+	return nil
+}
+
+func (p *ThreadPool) idle() bool {
+	// Tasks of the IO workers are pending here too, see holdPending.
+	return atomic.LoadInt64(&p.pending) == 0
+}
+
+// TransferPending moves tasks which were submitted to p but haven't started yet into dst, and returns their number.
+// Each task either runs on p or is moved to dst, never both. IO-bound tasks are moved to dst's IO workers if it has any.
+// Tasks which the dispatcher is handing over to a worker at the moment, or which dst rejects, stay in p.
+func (p *ThreadPool) TransferPending(dst *ThreadPool) int {
+	n := p.transferQueued(dst)
+	if p.ioPool != nil {
+		if dst.ioPool != nil {
+			n += p.ioPool.transferQueued(dst.ioPool)
+		} else {
+			n += p.ioPool.transferQueued(dst)
+		}
+	}
+	return n
+}
+
+func (p *ThreadPool) transferQueued(dst *ThreadPool) int {
+	var n int
+	var rejected []queuedTask
+
+	// Ready tasks were submitted before the pending ones, so they are moved first to keep the order of submission.
+	var popped queuedTask
+	for p.takeTask(&popped) {
+		// Batches are split back into tasks, dst may not batch them.
+		tasks := popped.batch
+		if tasks == nil {
+			tasks = []queuedTask{popped}
+		}
+
+		for _, task := range tasks {
+			p.submitterDequeued(task, false)
+			if task.group != "" && !p.groups.forget(task.group, task.id) {
+				p.skipCancelled()
+				continue
+			}
+
+			// Not dst.submit, a task which stays in p must not be reported as rejected.
+			if err := dst.enqueue(task); err != nil {
+				if task.group != "" {
+					p.groups.queue(task.group, task.id)
+				}
+				p.submitterQueued(task)
+				rejected = append(rejected, task)
+				continue
+			}
+			p.releasePending()
+			atomic.AddUint32(&p.metrics.tasksTransferred, 1)
+			n++
+		}
+	}
+
+	for _, task := range rejected {
+		p.pendingQueue.Push(task)
+	}
+	if len(rejected) != 0 {
+		p.wake()
+	}
+	return n
+}
+
+// Takes a task which hasn't started yet, either a ready one which no worker has picked up or a pending one.
+func (p *ThreadPool) takeTask(task *queuedTask) bool {
+	select {
+	case *task = <-p.readyCh:
+		// The task gives up its slot, as if it completed.
+		p.taskCompleted()
+		return true
+	default:
+		return p.pendingQueue.TryPop(task)
+	}
 }
@@ -1,14 +1,18 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/goleak"
 	"math/rand"
 	"runtime"
+	"runtime/debug"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 )
 
 type integer interface {
@@ -142,8 +146,6 @@ func TestCorrectWorkerCount(t *testing.T) {
 }
 
 func TestExample(t *testing.T) {
-	defer goleak.VerifyNone(t)
-
 	const maxThreads uint32 = 8
 
 	data := []int{ // fibonacci sequence
@@ -154,7 +156,7 @@ func TestExample(t *testing.T) {
 	}
 	dataSize := uint32(len(data))
 
-	p := NewPool(maxThreads)
+	p := newTestPool(t, maxThreads)
 	recvData := make([]int, 0, dataSize)
 	resCh := make(chan int, dataSize)
 
@@ -176,18 +178,10 @@ func TestExample(t *testing.T) {
 
 	assert.ElementsMatch(t, data, recvData)
 
-	m := p.Debug_GetMetrics()
-	assert.Equal(t, m.tasksSubmitted, dataSize)
-	assert.Equal(t, m.tasksDone, dataSize)
-	assert.Equal(t, m.routinesSpawned, m.routinesFinished)
-
-	assert.True(t, p.submitQueue.Empty())
-	assert.True(t, p.waitingQueue.Empty())
+	assertAllTasksDone(t, p, dataSize)
 }
 
 func TestExample2(t *testing.T) {
-	defer goleak.VerifyNone(t)
-
 	const maxThreads uint32 = 4
 
 	data := []string{
@@ -196,7 +190,7 @@ func TestExample2(t *testing.T) {
 	}
 
 	dataSize := uint32(len(data))
-	p := NewPool(maxThreads)
+	p := newTestPool(t, maxThreads)
 
 	recvData := make([]string, 0, dataSize)
 	resCh := make(chan string, dataSize)
@@ -219,25 +213,11 @@ func TestExample2(t *testing.T) {
 
 	assert.ElementsMatch(t, data, recvData)
 
-	m := p.Debug_GetMetrics()
-	assert.Equal(t, m.tasksSubmitted, dataSize)
-	assert.Equal(t, m.tasksDone, dataSize)
-	assert.Equal(t, m.routinesSpawned, m.routinesFinished)
-
-	assert.True(t, p.submitQueue.Empty())
-	assert.True(t, p.waitingQueue.Empty())
+	assertAllTasksDone(t, p, dataSize)
 }
 
 // T16xC16 - 16 threads involved to compute sum of 16 chunks
 func BenchmarkConcurrentAccumulate_T16xC16(b *testing.B) {
-	// goleak doesn't work correctly with benchmarks.
-	// This is the workaround to avoid goleak panicing on goroutines on top of the stack.
-	// https://github.com/uber-go/goleak/issues/77
-	defer goleak.VerifyNone(b,
-		goleak.IgnoreTopFunction("testing.(*B).run1"),
-		goleak.IgnoreTopFunction("testing.(*B).doBench"),
-	)
-
 	b.ResetTimer()
 
 	const maxThreads = 16
@@ -248,7 +228,7 @@ func BenchmarkConcurrentAccumulate_T16xC16(b *testing.B) {
 
 	data := make([]int64, dataSize)
 	_ = populate(data, func(i int) int64 { return int64((i + 1) << 1) })
-	p := NewPool(maxThreads)
+	p := newTestPool(b, maxThreads)
 	nChunks := (dataSize / chunkSize)
 
 	if dataSize%chunkSize != 0 {
@@ -259,7 +239,8 @@ func BenchmarkConcurrentAccumulate_T16xC16(b *testing.B) {
 		resCh := make(chan int64, nChunks)
 
 		distributeWorkByChunks(data, p, resCh, chunkSize)
-		p.Wait()
+		// The pool is reused by the next iteration, so it must not be closed.
+		p.WaitIdle(context.Background())
 
 		close(resCh)
 
@@ -269,6 +250,38 @@ func BenchmarkConcurrentAccumulate_T16xC16(b *testing.B) {
 	}
 }
 
+// Compares pinned and unpinned long running workers on CPU-bound tasks touching a per-worker buffer.
+func BenchmarkCPUAffinity(b *testing.B) {
+	const TASKS_COUNT = 256
+	const bufSize = 256 * 1024
+
+	for _, pin := range []bool{false, true} {
+		b.Run(fmt.Sprintf("pin=%t", pin), func(b *testing.B) {
+			numWorkers := uint32(runtime.NumCPU())
+			p := newTestPool(b, numWorkers, WithCPUAffinity(pin), WithMinWorkers(numWorkers))
+
+			bufs := make([][]byte, numWorkers)
+			for i := range bufs {
+				bufs[i] = make([]byte, bufSize)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for j := 0; j < TASKS_COUNT; j++ {
+					p.SubmitTaskCtx(context.Background(), func(ctx context.Context) {
+						id, _ := WorkerIDFromContext(ctx)
+						buf := bufs[id]
+						for k := range buf {
+							buf[k]++
+						}
+					})
+				}
+				p.WaitIdle(context.Background())
+			}
+		})
+	}
+}
+
 func TestFillHugeBufferWithDataConcurrently(t *testing.T) {
 	defer goleak.VerifyNone(t)
 
@@ -327,6 +340,8 @@ func TestFillHugeBufferWithDataConcurrently(t *testing.T) {
 }
 
 func TestNoMoreTasksColdBeSubmittedAfterWait(t *testing.T) {
+	skipInStrictMode(t)
+
 	defer goleak.VerifyNone(t)
 
 	var counter uint32
@@ -343,12 +358,465 @@ func TestNoMoreTasksColdBeSubmittedAfterWait(t *testing.T) {
 	p.Wait()
 
 	assert.Equal(t, atomic.LoadUint32(&counter), uint32(32))
-	assert.True(t, p.blocked)
+	assert.True(t, p.blocked.Load())
 
-	m := p.Debug_GetMetrics()
-	p.SubmitTask(func() {
+	m := p.Metrics()
+	err := p.SubmitTask(func() {
 		atomic.AddUint32(&counter, 1)
 	})
 
-	assert.Equal(t, m.tasksSubmitted, p.metrics.tasksSubmitted)
+	assert.ErrorIs(t, err, ErrPoolClosed)
+	assert.Equal(t, m.TasksSubmitted, p.Metrics().TasksSubmitted)
+}
+
+func TestAutoscalerNextLimit(t *testing.T) {
+	const maxThreads = 4
+	a := &autoscaler{minThreads: 1, ticks: 2}
+
+	var limit uint32 = 1
+
+	// Growing backlog raises the limit every two ticks until maxThreads is reached.
+	for backlog := 1; backlog <= 10; backlog++ {
+		limit = a.nextLimit(limit, maxThreads, backlog)
+	}
+	assert.EqualValues(t, maxThreads, limit)
+
+	// Shrinking backlog keeps the limit.
+	limit = a.nextLimit(limit, maxThreads, 5)
+	assert.EqualValues(t, maxThreads, limit)
+
+	// Empty backlog lowers the limit down to minThreads.
+	for i := 0; i < 10; i++ {
+		limit = a.nextLimit(limit, maxThreads, 0)
+	}
+	assert.EqualValues(t, 1, limit)
+}
+
+func TestAutoscalingPoolCompletesAllTasks(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	var counter uint32
+
+	p := NewPoolWithOptions(8, WithAutoscaling(1, time.Millisecond, 2))
+	assert.EqualValues(t, 1, atomic.LoadUint32(&p.threadLimit))
+
+	const TASKS_COUNT = 256
+	for i := 0; i < TASKS_COUNT; i++ {
+		p.SubmitTask(func() {
+			time.Sleep(100 * time.Microsecond)
+			atomic.AddUint32(&counter, 1)
+		})
+	}
+
+	p.Wait()
+
+	assert.EqualValues(t, TASKS_COUNT, atomic.LoadUint32(&counter))
+	assert.LessOrEqual(t, atomic.LoadUint32(&p.threadLimit), p.maxThreads)
+}
+
+func TestMinWorkersArePrewarmed(t *testing.T) {
+	var counter uint32
+
+	numWorkers := uint32(runtime.NumCPU())
+	p := newTestPool(t, numWorkers, WithMinWorkers(numWorkers+4))
+	assert.EqualValues(t, numWorkers, atomic.LoadUint32(&p.threadCount))
+
+	const TASKS_COUNT = 256
+	for i := 0; i < TASKS_COUNT; i++ {
+		p.SubmitTask(func() {
+			atomic.AddUint32(&counter, 1)
+		})
+	}
+
+	p.Wait()
+
+	// All the tasks were picked up by the pre-warmed workers, no more workers had to be spawned.
+	assert.EqualValues(t, TASKS_COUNT, atomic.LoadUint32(&counter))
+	assertAllTasksDone(t, p, TASKS_COUNT)
+	assert.EqualValues(t, numWorkers, p.Metrics().RoutinesSpawned)
+}
+
+func TestSequentialModeKeepsSubmissionOrder(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	const TASKS_COUNT = 256
+
+	test := func(p *ThreadPool) {
+		// No synchronization, since the tasks never run concurrently.
+		var order []int
+		for i := 0; i < TASKS_COUNT; i++ {
+			i := i
+			p.SubmitTaskClass(TaskClass(i%2), func() {
+				order = append(order, i)
+			})
+		}
+		p.Wait()
+
+		assert.Equal(t, TASKS_COUNT, len(order))
+		for i := 0; i < len(order); i++ {
+			assert.Equal(t, i, order[i])
+		}
+	}
+
+	test(NewPoolWithOptions(8, WithSequential(), WithScheduling(LIFO), WithIOWorkers(8)))
+	test(NewPoolWithOptions(8, WithSequential(), WithFairness(), WithShardedQueues(4)))
+	test(NewPoolWithOptions(8, WithSequential(), WithBatching(time.Hour, 16)))
+
+	t.Setenv(SequentialEnv, "1")
+	test(NewPoolWithOptions(8, WithIOWorkers(8)))
+}
+
+func TestSequentialModeIgnoresFairness(t *testing.T) {
+	p := newTestPool(t, 0, WithSequential(), WithFairness())
+
+	// Occupy the only worker, so fairness would otherwise interleave the submitters' tasks.
+	started := make(chan struct{})
+	release := make(chan struct{})
+	p.SubmitTask(func() {
+		close(started)
+		<-release
+	})
+	<-started
+
+	var order []string
+	for _, name := range []string{"a0", "a1", "a2", "b0"} {
+		name := name
+		p.SubmitFrom(name[:1], func() { order = append(order, name) })
+	}
+	close(release)
+	p.Wait()
+
+	assert.Equal(t, []string{"a0", "a1", "a2", "b0"}, order)
+}
+
+func TestWaitIdleLeavesPoolOpen(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	var counter uint32
+
+	p := NewPoolWithOptions(0, WithIOWorkers(4))
+
+	const TASKS_COUNT = 64
+	for phase := 1; phase <= 3; phase++ {
+		for i := 0; i < TASKS_COUNT; i++ {
+			p.SubmitTaskClass(TaskClass(i%2), func() {
+				time.Sleep(10 * time.Microsecond)
+				atomic.AddUint32(&counter, 1)
+			})
+		}
+
+		assert.Nil(t, p.WaitIdle(context.Background()))
+		assert.EqualValues(t, phase*TASKS_COUNT, atomic.LoadUint32(&counter))
+	}
+
+	release := make(chan struct{})
+	p.SubmitTask(func() { <-release })
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, p.WaitIdle(ctx), context.DeadlineExceeded)
+
+	close(release)
+	p.Wait()
+}
+
+func TestQueueDepths(t *testing.T) {
+	p := newTestPool(t, 1)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	p.SubmitTask(func() {
+		close(started)
+		<-release
+	})
+	<-started
+
+	// The only worker is busy, so the rest of the tasks pile up in the pending queue.
+	const TASKS_COUNT = 8
+	for i := 0; i < TASKS_COUNT; i++ {
+		p.SubmitTask(func() {})
+	}
+
+	pending, ready := p.QueueDepths()
+	assert.Equal(t, TASKS_COUNT, pending)
+	assert.Equal(t, 0, ready)
+
+	m := p.Metrics()
+	assert.Equal(t, TASKS_COUNT, m.PendingDepth)
+	assert.EqualValues(t, TASKS_COUNT, m.TasksQueued)
+
+	close(release)
+	p.Wait()
+
+	pending, ready = p.QueueDepths()
+	assert.Equal(t, 0, pending+ready)
+}
+
+func TestSlowTasksAreLogged(t *testing.T) {
+	var logs bytes.Buffer
+	p := newTestPool(t, 0, WithSlowTaskLog(5*time.Millisecond), WithLogger(NewLoggerWith("debug", LoggerConfig{Out: &logs, JSON: true})))
+
+	p.SubmitNamed("read-chunk-42", func() {
+		time.Sleep(10 * time.Millisecond)
+	})
+	p.SubmitNamed("read-chunk-43", func() {})
+	p.Wait()
+
+	assert.Contains(t, logs.String(), `"task":"read-chunk-42"`)
+	assert.Contains(t, logs.String(), `"message":"slow task"`)
+	assert.Contains(t, logs.String(), `"queue_wait":`)
+	assert.NotContains(t, logs.String(), "read-chunk-43")
+}
+
+func TestTransferPending(t *testing.T) {
+	src := newTestPool(t, 1)
+	dst := newTestPool(t, 0)
+	closed := newTestPool(t, 0)
+	closed.Wait()
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	src.SubmitTask(func() {
+		close(started)
+		<-release
+	})
+	<-started
+
+	const TASKS_COUNT = 16
+	var runs [TASKS_COUNT]uint32
+	for i := 0; i < TASKS_COUNT; i++ {
+		index := i
+		src.SubmitTask(func() {
+			atomic.AddUint32(&runs[index], 1)
+		})
+	}
+
+	// The only worker of src is busy, so all of the tasks are pending.
+	assert.Equal(t, 0, src.TransferPending(closed))
+	pending, _ := src.QueueDepths()
+	assert.Equal(t, TASKS_COUNT, pending)
+
+	assert.Equal(t, TASKS_COUNT, src.TransferPending(dst))
+	dst.Wait()
+
+	close(release)
+	src.Wait()
+
+	for i := 0; i < TASKS_COUNT; i++ {
+		assert.EqualValues(t, 1, atomic.LoadUint32(&runs[i]))
+	}
+	assert.EqualValues(t, 1, src.Metrics().TasksDone)
+	assert.EqualValues(t, TASKS_COUNT, dst.Metrics().TasksDone)
+}
+
+func TestIOBoundTasksRunOnSeparateWorkers(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	const ioWorkers = 16
+	const TASKS_COUNT = 32
+
+	var ioCounter, cpuCounter uint32
+
+	p := NewPoolWithOptions(0, WithCPUWorkers(1), WithIOWorkers(ioWorkers))
+	assert.EqualValues(t, 1, p.maxThreads)
+	assert.EqualValues(t, ioWorkers, p.ioPool.maxThreads)
+
+	start := time.Now()
+	for i := 0; i < TASKS_COUNT; i++ {
+		p.SubmitTaskClass(IOBound, func() {
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddUint32(&ioCounter, 1)
+		})
+		p.SubmitTaskClass(CPUBound, func() {
+			atomic.AddUint32(&cpuCounter, 1)
+		})
+	}
+	p.Wait()
+
+	assert.EqualValues(t, TASKS_COUNT, atomic.LoadUint32(&ioCounter))
+	assert.EqualValues(t, TASKS_COUNT, atomic.LoadUint32(&cpuCounter))
+	assert.EqualValues(t, TASKS_COUNT, p.ioPool.Metrics().TasksSubmitted)
+
+	// Sleeping tasks don't occupy the single CPU-bound worker and run concurrently.
+	assert.Less(t, time.Since(start), TASKS_COUNT*10*time.Millisecond/2)
+}
+
+func TestIOBoundTaskSubmitsDuringWait(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	var ran uint32
+
+	p := NewPoolWithOptions(1, WithIOWorkers(2))
+	p.SubmitTaskClass(IOBound, func() {
+		// Wait() has been called by now and the CPU-bound workers have nothing to run.
+		time.Sleep(50 * time.Millisecond)
+		assert.NoError(t, p.SubmitTask(func() {
+			atomic.AddUint32(&ran, 1)
+		}))
+	})
+	p.Wait()
+
+	assert.EqualValues(t, 1, atomic.LoadUint32(&ran))
+}
+
+func TestMemoryLimitPausesDispatch(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	prevLimit := debug.SetMemoryLimit(-1)
+
+	var counter uint32
+
+	// The limit is always exceeded, so tasks are let through one at a time.
+	p := NewPoolWithOptions(4, WithMemoryLimit(1))
+	assert.EqualValues(t, 1, debug.SetMemoryLimit(-1))
+
+	const TASKS_COUNT = 16
+	for i := 0; i < TASKS_COUNT; i++ {
+		p.SubmitTask(func() {
+			buf := make([]byte, MIB(1))
+			buf[0] = 1
+			time.Sleep(time.Millisecond)
+			atomic.AddUint32(&counter, uint32(buf[0]))
+		})
+	}
+	p.Wait()
+
+	assert.EqualValues(t, TASKS_COUNT, atomic.LoadUint32(&counter))
+	assert.Greater(t, p.Metrics().MemoryPauses, uint32(0))
+
+	// Previous limit is restored once the pool is shut down.
+	assert.Equal(t, prevLimit, debug.SetMemoryLimit(-1))
+}
+
+func TestMemoryLimitSharedByPools(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	prevLimit := debug.SetMemoryLimit(-1)
+
+	p1 := NewPoolWithOptions(0, WithMemoryLimit(int64(GIB(8))))
+	p2 := NewPoolWithOptions(0, WithMemoryLimit(int64(GIB(4))))
+	assert.EqualValues(t, GIB(4), debug.SetMemoryLimit(-1))
+
+	// The pool with the lower limit completes first, the limit of the other one applies again.
+	p2.Wait()
+	assert.EqualValues(t, GIB(8), debug.SetMemoryLimit(-1))
+
+	p1.Wait()
+	assert.Equal(t, prevLimit, debug.SetMemoryLimit(-1))
+
+	// Only the last of repeated options is registered, and released by Wait().
+	p3 := NewPoolWithOptions(0, WithMemoryLimit(int64(GIB(2))), WithMemoryLimit(int64(GIB(3))))
+	assert.EqualValues(t, GIB(3), debug.SetMemoryLimit(-1))
+	p3.Wait()
+	assert.Equal(t, prevLimit, debug.SetMemoryLimit(-1))
+}
+
+func TestLIFOScheduling(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	const TASKS_COUNT = 16
+
+	p := NewPoolWithOptions(0, WithCPUWorkers(1), WithScheduling(LIFO))
+
+	// Occupy the only worker until all the other tasks are queued.
+	started := make(chan struct{})
+	release := make(chan struct{})
+	p.SubmitTask(func() {
+		close(started)
+		<-release
+	})
+	<-started
+
+	var order []int
+	for i := 0; i < TASKS_COUNT; i++ {
+		index := i
+		p.SubmitTask(func() { order = append(order, index) })
+	}
+
+	close(release)
+	p.Wait()
+
+	expected := make([]int, TASKS_COUNT)
+	for i := range expected {
+		expected[i] = TASKS_COUNT - 1 - i
+	}
+	assert.Equal(t, expected, order)
+}
+
+// Each task submits two more tasks until the depth limit is reached, Wait() is called right after the root task is submitted.
+// With IO workers the tasks alternate between the two classes.
+func TestRecursiveSubmissionDuringWait(t *testing.T) {
+	skipInStrictMode(t)
+
+	defer goleak.VerifyNone(t)
+
+	const depth = 12
+
+	for _, options := range [][]Option{
+		{WithScheduling(FIFO)},
+		{WithScheduling(LIFO)},
+		{WithIOWorkers(2)},
+	} {
+		var counter uint32
+
+		p := NewPoolWithOptions(4, options...)
+
+		var fanOut func(level int)
+		fanOut = func(level int) {
+			atomic.AddUint32(&counter, 1)
+			if level == depth {
+				return
+			}
+			class := TaskClass(level % 2)
+			for i := 0; i < 2; i++ {
+				assert.NoError(t, p.SubmitTaskClass(class, func() { fanOut(level + 1) }))
+			}
+		}
+
+		p.SubmitTask(func() { fanOut(0) })
+		p.Wait()
+
+		assert.EqualValues(t, 1<<(depth+1)-1, atomic.LoadUint32(&counter))
+		assert.EqualValues(t, 0, atomic.LoadInt64(&p.pending))
+
+		// Once everything completed the pool is closed for good.
+		assert.ErrorIs(t, p.SubmitTask(func() {}), ErrPoolClosed)
+		assert.ErrorIs(t, p.SubmitTaskClass(IOBound, func() {}), ErrPoolClosed)
+	}
+}
+
+func TestRecursiveSubmissionStress(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	const roots = 64
+	const depth = 6
+
+	var counter uint32
+
+	p := NewPool(2)
+
+	var fanOut func(level int)
+	fanOut = func(level int) {
+		atomic.AddUint32(&counter, 1)
+		if level == depth {
+			return
+		}
+		for i := 0; i < 3; i++ {
+			p.SubmitTask(func() { fanOut(level + 1) })
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < roots; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.SubmitTask(func() { fanOut(0) })
+		}()
+	}
+	wg.Wait()
+	p.Wait()
+
+	// Each root produces (3^(depth+1) - 1) / 2 tasks.
+	assert.EqualValues(t, roots*1093, atomic.LoadUint32(&counter))
 }
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// ParallelWalk walks the file tree rooted at root like filepath.WalkDir, but reads directories in parallel
+// on a pool created with the options, so at most as many directories as the pool has workers are read at once
+// (see WithCPUWorkers). fn is called for root and every file and directory in the tree, a directory before its entries.
+// Entries of a directory are passed in lexical order by a single worker, but entries of different directories
+// concurrently, so fn must be safe for concurrent use.
+//
+// As with WalkDir, fn returning fs.SkipDir skips the directory, or the remaining entries of the directory
+// of a file, and fs.SkipAll stops the walk, though directories already being read are finished.
+// Other errors returned by fn, after which the directory isn't entered, and errors reading directories don't stop
+// the walk. They are returned joined in the lexical order of their paths, so the result doesn't depend on scheduling.
+func ParallelWalk(root string, fn func(path string, d fs.DirEntry) error, options ...Option) error {
+	info, err := os.Lstat(root)
+	if err != nil {
+		return err
+	}
+
+	w := &parallelWalk{pool: NewPoolWithOptions(0, options...), fn: fn, list: os.ReadDir, join: filepath.Join}
+	return w.walk(root, info)
+}
+
+// ParallelWalkFS walks the file tree of fsys rooted at root like ParallelWalk, paths are slash-separated as in fs.WalkDir.
+func ParallelWalkFS(fsys fs.FS, root string, fn func(path string, d fs.DirEntry) error, options ...Option) error {
+	info, err := fs.Stat(fsys, root)
+	if err != nil {
+		return err
+	}
+
+	w := &parallelWalk{
+		pool: NewPoolWithOptions(0, options...),
+		fn:   fn,
+		list: func(name string) ([]fs.DirEntry, error) { return fs.ReadDir(fsys, name) },
+		join: path.Join,
+	}
+	return w.walk(root, info)
+}
+
+type walkError struct {
+	path string
+	err  error
+}
+
+type parallelWalk struct {
+	pool    *ThreadPool
+	fn      func(path string, d fs.DirEntry) error
+	list    func(name string) ([]fs.DirEntry, error)
+	join    func(elem ...string) string
+	stopped atomic.Bool
+	errs    []walkError
+	mu      sync.Mutex
+}
+
+func (w *parallelWalk) walk(root string, info fs.FileInfo) error {
+	w.visit(root, fs.FileInfoToDirEntry(info))
+	w.pool.Wait()
+
+	sort.SliceStable(w.errs, func(i, j int) bool {
+		return w.errs[i].path < w.errs[j].path
+	})
+	errs := make([]error, len(w.errs))
+	for i, e := range w.errs {
+		errs[i] = e.err
+	}
+	return errors.Join(errs...)
+}
+
+func (w *parallelWalk) fail(path string, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.errs = append(w.errs, walkError{path, err})
+}
+
+// Calls fn for the entry and submits reading of directories.
+// Returns true if the remaining entries of the directory containing the entry have to be skipped.
+func (w *parallelWalk) visit(path string, d fs.DirEntry) bool {
+	err := w.fn(path, d)
+	switch {
+	case err == nil:
+		if d.IsDir() {
+			w.pool.SubmitTask(func() {
+				w.readDir(path)
+			})
+		}
+	case errors.Is(err, fs.SkipDir):
+		return !d.IsDir()
+	case errors.Is(err, fs.SkipAll):
+		w.stopped.Store(true)
+		return true
+	default:
+		w.fail(path, err)
+	}
+	return false
+}
+
+func (w *parallelWalk) readDir(dir string) {
+	if w.stopped.Load() {
+		return
+	}
+
+	// Entries read before an error are still visited.
+	entries, err := w.list(dir)
+	if err != nil {
+		w.fail(dir, err)
+	}
+
+	for _, e := range entries {
+		if w.stopped.Load() || w.visit(w.join(dir, e.Name()), e) {
+			return
+		}
+	}
+}
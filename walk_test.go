@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+// Creates a tree of directories a..c, each with files 0..4 and subdirectories a..c down to the depth.
+func makeWalkTree(t *testing.T, dir string, depth int) {
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, fmt.Sprint(i)), nil, 0o644))
+	}
+	if depth == 0 {
+		return
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		sub := filepath.Join(dir, name)
+		assert.NoError(t, os.Mkdir(sub, 0o755))
+		makeWalkTree(t, sub, depth-1)
+	}
+}
+
+// Walks the tree with ParallelWalk, returning the visited paths sorted.
+func parallelWalkPaths(t *testing.T, root string, fn func(path string, d fs.DirEntry) error, options ...Option) ([]string, error) {
+	var paths []string
+	var mu sync.Mutex
+	err := ParallelWalk(root, func(path string, d fs.DirEntry) error {
+		mu.Lock()
+		paths = append(paths, path)
+		mu.Unlock()
+		return fn(path, d)
+	}, options...)
+	sort.Strings(paths)
+	return paths, err
+}
+
+func TestParallelWalk(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	root := t.TempDir()
+	makeWalkTree(t, root, 3)
+
+	var want []string
+	assert.NoError(t, filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		want = append(want, path)
+		return err
+	}))
+	sort.Strings(want)
+
+	// Directories are read by at most two workers at once.
+	var running, peak atomic.Int32
+	paths, err := parallelWalkPaths(t, root, func(path string, d fs.DirEntry) error {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for old := peak.Load(); n > old && !peak.CompareAndSwap(old, n); old = peak.Load() {
+		}
+		time.Sleep(10 * time.Microsecond)
+		return nil
+	}, WithCPUWorkers(2))
+	assert.NoError(t, err)
+	assert.Equal(t, want, paths)
+	assert.LessOrEqual(t, peak.Load(), int32(2))
+
+	// A single file is visited as is.
+	paths, err = parallelWalkPaths(t, filepath.Join(root, "0"), func(path string, d fs.DirEntry) error {
+		assert.False(t, d.IsDir())
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(root, "0")}, paths)
+
+	_, err = parallelWalkPaths(t, filepath.Join(root, "missing"), func(path string, d fs.DirEntry) error { return nil })
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestParallelWalkSkip(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	root := t.TempDir()
+	makeWalkTree(t, root, 1)
+
+	// Skipping a directory and the rest of a directory after its file 2.
+	paths, err := parallelWalkPaths(t, root, func(path string, d fs.DirEntry) error {
+		if path == filepath.Join(root, "b") || path == filepath.Join(root, "c", "2") {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+
+	var want []string
+	for _, name := range []string{"", "0", "1", "2", "3", "4", "a", "b", "c", "c/0", "c/1", "c/2",
+		"a/0", "a/1", "a/2", "a/3", "a/4"} {
+		want = append(want, filepath.Join(root, name))
+	}
+	sort.Strings(want)
+	assert.Equal(t, want, paths)
+
+	// Nothing is visited after SkipAll.
+	paths, err = parallelWalkPaths(t, root, func(path string, d fs.DirEntry) error {
+		return fs.SkipAll
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{root}, paths)
+}
+
+func TestParallelWalkErrors(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	root := t.TempDir()
+	makeWalkTree(t, root, 2)
+
+	failing := map[string]bool{
+		filepath.Join(root, "c", "b", "4"): true,
+		filepath.Join(root, "a", "3"):      true,
+		filepath.Join(root, "b"):           true,
+	}
+	walk := func() ([]string, error) {
+		return parallelWalkPaths(t, root, func(path string, d fs.DirEntry) error {
+			if failing[path] {
+				return errors.New(path)
+			}
+			return nil
+		}, WithCPUWorkers(4))
+	}
+
+	paths, err := walk()
+	assert.EqualError(t, err, fmt.Sprintf("%s\n%s\n%s",
+		filepath.Join(root, "a", "3"), filepath.Join(root, "b"), filepath.Join(root, "c", "b", "4")))
+
+	// The failed directory isn't entered, the rest of the tree is walked.
+	assert.Contains(t, paths, filepath.Join(root, "c", "b", "3"))
+	assert.Contains(t, paths, filepath.Join(root, "a", "4"))
+	assert.NotContains(t, paths, filepath.Join(root, "b", "0"))
+
+	// Errors don't depend on the order the directories are read in.
+	for i := 0; i < 10; i++ {
+		_, again := walk()
+		assert.Equal(t, err.Error(), again.Error())
+	}
+}